@@ -66,15 +66,31 @@ func SetupDatabase() {
 		&entity.ReviewVoteType{},
 		&entity.ReviewReply{},
 		&entity.ReviewVote{},
+		&entity.AuthSession{},
+		&entity.RefreshToken{},
+		&entity.PasswordResetToken{},
 		&entity.NotificationType{},
+		&entity.Upload{},
+		&entity.UploadReference{},
 	)
 
+	// Borrow เปลี่ยนไปผูกกับ BookLicense แล้ว: ลบคอลัมน์ book_id (NOT NULL) ที่ค้างจาก schema เดิม
+	if db.Migrator().HasColumn(&entity.Borrow{}, "book_id") {
+		if db.Migrator().HasConstraint(&entity.Borrow{}, "fk_books_borrows") {
+			db.Migrator().DropConstraint(&entity.Borrow{}, "fk_books_borrows")
+		}
+		if err := db.Migrator().DropColumn(&entity.Borrow{}, "book_id"); err != nil {
+			log.Println("drop borrows.book_id failed:", err)
+		}
+	}
+
 	// เพิ่มข้อมูลเริ่มต้น
 	createDefaultRoles()
 	createDefaultBorrowingLimits()
 	createDefaultUsers()
 	CreateDefaultBookStatus()
-	CreateDefaultReservationStatus()		
+	CreateDefaultReservationStatus()
+	CreateDefaultNotificationTypes()
 }
 
 // createDefaultRoles สร้าง roles เริ่มต้น: user และ admin
@@ -237,6 +253,7 @@ func CreateDefaultBookStatus() {
 		{StatusName: "Available"},
 		{StatusName: "Borrowed"},
 		{StatusName: "Hold"},
+		{StatusName: "Retired"},
 	}
 
 	for _, status := range defaultBookStatuses {
@@ -261,6 +278,21 @@ func CreateDefaultReservationStatus() {
 	}
 }
 
+// CreateDefaultNotificationTypes สร้างประเภทการแจ้งเตือนที่ระบบใช้
+func CreateDefaultNotificationTypes() {
+	defaultNotificationTypes := []entity.NotificationType{
+		{TypeName: "due_soon", Description: "รายการยืมจะครบกำหนดคืนภายใน 24 ชั่วโมง"},
+		{TypeName: "borrow_auto_returned", Description: "ระบบคืน e-book ที่เลยกำหนดคืนให้อัตโนมัติ"},
+		{TypeName: "reservation_ready", Description: "หนังสือที่จองไว้ถูกกันไว้ให้ยืมแล้ว"},
+		{TypeName: "reservation_expired", Description: "การจองหมดอายุเพราะไม่ได้มายืมภายในเวลาที่กำหนด"},
+	}
+
+	for _, nt := range defaultNotificationTypes {
+		db.FirstOrCreate(&nt, entity.NotificationType{TypeName: nt.TypeName})
+		fmt.Printf("Notification type '%s' ready\n", nt.TypeName)
+	}
+}
+
 
 
 
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/PIPAT-I/G10-SA/services"
+)
+
+var store services.Storage
+
+// Storage ที่เก็บไฟล์อัปโหลด (ปก, e-book) ตามที่ตั้งค่าใน ConnectStorage
+func Storage() services.Storage {
+	return store
+}
+
+// ConnectStorage เลือก backend ของที่เก็บไฟล์จาก environment
+//
+//	STORAGE_DRIVER=local (ค่าเริ่มต้น)  STORAGE_DIR (ค่าเริ่มต้น ./storage)
+//	STORAGE_DRIVER=s3                  S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY, S3_SECRET_KEY,
+//	                                   S3_PATH_STYLE (ค่าเริ่มต้น true สำหรับ MinIO)
+//
+// secret ใช้ลงลายเซ็น URL ของ local storage
+func ConnectStorage(secret []byte) {
+	switch driver := strings.ToLower(os.Getenv("STORAGE_DRIVER")); driver {
+	case "", "local":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = services.DefaultStorageDir
+		}
+		store = &services.LocalStorage{Root: dir, BaseURL: "/api/files", Secret: secret}
+	case "s3":
+		s3 := &services.S3Storage{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PathStyle: os.Getenv("S3_PATH_STYLE") != "false",
+		}
+		if s3.Region == "" {
+			s3.Region = "us-east-1"
+		}
+		if s3.Endpoint == "" || s3.Bucket == "" || s3.AccessKey == "" || s3.SecretKey == "" {
+			log.Fatal("STORAGE_DRIVER=s3 needs S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY")
+		}
+		store = s3
+	default:
+		log.Fatalf("unknown STORAGE_DRIVER %q (use local or s3)", driver)
+	}
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/PIPAT-I/G10-SA/services"
+	"github.com/gin-gonic/gin"
+)
+
+type AccountController struct{ Svc *services.AccountService }
+
+type updateMeReq struct {
+	Firstname   *string `json:"firstname"`
+	Lastname    *string `json:"lastname"`
+	Email       *string `json:"email"`
+	PhoneNumber *string `json:"phone_number"`
+}
+
+type changePasswordReq struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type forgotPasswordReq struct {
+	Identifier string `json:"identifier" binding:"required"` // email หรือ userID
+}
+
+type resetPasswordReq struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// accountErrorStatus แปลง error ของ AccountService เป็น HTTP status
+func accountErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrWeakPassword),
+		errors.Is(err, services.ErrSamePassword),
+		errors.Is(err, services.ErrInvalidEmail),
+		errors.Is(err, services.ErrInvalidResetToken):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrWrongPassword):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrEmailTaken):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GET /user/me
+func (a *AccountController) GetMe(c *gin.Context) {
+	u, err := a.Svc.GetMe(currentUserID(c))
+	if err != nil {
+		c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+// PUT /user/me
+func (a *AccountController) UpdateMe(c *gin.Context) {
+	var in updateMeReq
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	u, err := a.Svc.UpdateMe(currentUserID(c), services.UpdateMeInput{
+		Firstname:   in.Firstname,
+		Lastname:    in.Lastname,
+		Email:       in.Email,
+		PhoneNumber: in.PhoneNumber,
+	})
+	if err != nil {
+		c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+// POST /user/me/avatar  (multipart: file)
+func (a *AccountController) UploadAvatar(c *gin.Context) {
+	url, err := saveUploadedFile(c, "avatars", services.AvatarUploadPolicy)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": "upload avatar failed", "detail": err.Error()})
+		return
+	}
+	u, err := a.Svc.SetAvatar(currentUserID(c), url)
+	if err != nil {
+		c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
+
+// PUT /user/me/password
+func (a *AccountController) ChangePassword(c *gin.Context) {
+	var in changePasswordReq
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	if err := a.Svc.ChangePassword(currentUserID(c), currentSessionID(c), in.OldPassword, in.NewPassword); err != nil {
+		c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "password changed"})
+}
+
+// POST /auth/password/forgot
+func (a *AccountController) ForgotPassword(c *gin.Context) {
+	var in forgotPasswordReq
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	err := a.Svc.RequestPasswordResetFrom(in.Identifier, c.ClientIP())
+	if errors.Is(err, services.ErrTooManyAttempts) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(a.Svc.ResetRetryAfter(in.Identifier, c.ClientIP()).Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many password reset requests, try again later"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// ตอบเหมือนกันทุกกรณี ไม่บอกว่ามีบัญชีนี้หรือไม่
+	c.JSON(http.StatusOK, gin.H{"message": "if the account exists, a reset link has been sent"})
+}
+
+// POST /auth/password/reset
+func (a *AccountController) ResetPassword(c *gin.Context) {
+	var in resetPasswordReq
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	if err := a.Svc.ResetPassword(in.Token, in.NewPassword); err != nil {
+		c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "password has been reset"})
+}
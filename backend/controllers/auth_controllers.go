@@ -1,7 +1,10 @@
 package controllers
 
 import (
+    "errors"
+    "math"
     "net/http"
+    "strconv"
     "github.com/PIPAT-I/G10-SA/services"
     "github.com/gin-gonic/gin"
 )
@@ -19,21 +22,96 @@ func (a *AuthController) Login(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
         return
     }
-    out, err := a.Svc.Login(services.LoginInput{Identifier: in.Identifier, Password: in.Password})
+    out, err := a.Svc.Login(services.LoginInput{
+        Identifier: in.Identifier,
+        Password:   in.Password,
+        UserAgent:  c.Request.UserAgent(),
+        IPAddress:  c.ClientIP(),
+    })
+    if errors.Is(err, services.ErrTooManyAttempts) {
+        c.Header("Retry-After", strconv.Itoa(int(math.Ceil(a.Svc.RetryAfter(in.Identifier, c.ClientIP()).Seconds()))))
+        c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+        return
+    }
     if err != nil {
         c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
         return
     }
-    c.JSON(http.StatusOK, gin.H{
-        "token": out.Token,
+    c.JSON(http.StatusOK, tokenResponse(out))
+}
+
+type refreshReq struct {
+    RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// POST /auth/refresh
+func (a *AuthController) Refresh(c *gin.Context) {
+    var in refreshReq
+    if err := c.ShouldBindJSON(&in); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+        return
+    }
+    out, err := a.Svc.Refresh(services.RefreshInput{
+        RefreshToken: in.RefreshToken,
+        UserAgent:    c.Request.UserAgent(),
+        IPAddress:    c.ClientIP(),
+    })
+    if err != nil {
+        if errors.Is(err, services.ErrInvalidRefreshToken) ||
+            errors.Is(err, services.ErrRefreshTokenReused) ||
+            errors.Is(err, services.ErrSessionRevoked) ||
+            errors.Is(err, services.ErrAccountDisabled) {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, tokenResponse(out))
+}
+
+// POST /auth/logout
+func (a *AuthController) Logout(c *gin.Context) {
+    var in refreshReq
+    if err := c.ShouldBindJSON(&in); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+        return
+    }
+    if err := a.Svc.Logout(in.RefreshToken); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+func tokenResponse(out *services.LoginOutput) gin.H {
+    return gin.H{
+        "token":         out.Token,
+        "refresh_token": out.RefreshToken,
+        "expires_at":    out.ExpiresAt,
         "user": gin.H{
             // ใช้ camelCase ให้ตรงกับฝั่ง frontend
-            "userID":    out.User.UserID,
-            "email":     out.User.Email,
-            "firstname": out.User.Firstname,
-            "lastname":  out.User.Lastname,
-            "phone":     out.User.PhoneNumber,
-            "role":      out.Role, // "user" | "admin"
+            "userID":             out.User.UserID,
+            "email":              out.User.Email,
+            "firstname":          out.User.Firstname,
+            "lastname":           out.User.Lastname,
+            "phone":              out.User.PhoneNumber,
+            "role":               out.Role, // "user" | "admin"
+            "mustChangePassword": out.User.MustChangePassword,
         },
-    })
+    }
+}
+
+// currentSessionID ดึง SessionID (claim "sid") ที่ middlewares.AuthRequired ใส่ไว้ใน context
+func currentSessionID(c *gin.Context) string {
+    v, _ := c.Get("sessionID")
+    s, _ := v.(string)
+    return s
+}
+
+// currentUserID ดึง userID ที่ middlewares.AuthRequired ใส่ไว้ใน context
+func currentUserID(c *gin.Context) string {
+    v, _ := c.Get("userID")
+    s, _ := v.(string)
+    return s
 }
@@ -1,12 +1,15 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	config "github.com/PIPAT-I/G10-SA/config"
 	"github.com/PIPAT-I/G10-SA/entity"
+	"github.com/PIPAT-I/G10-SA/services"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type BookWithAuthors struct {
@@ -46,54 +49,25 @@ func CreateBook(c *gin.Context) {
 		}
 	}
 
-	if err := db.Create(&body).Error; err != nil {
+	if err := services.ApplyCoverThumbnails(config.Storage(), &body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusCreated, body)
-}
 
-// GET /books   (รองรับ ?publisher_id= ?file_type_id= ?language_id=)
-// รวมรายชื่อผู้แต่งใน author_names (รวมด้วย Go : พกพาได้ทุก DB)
-func FindBooks(c *gin.Context) {
-	db := config.DB()
-
-	var rows []entity.Book
-	q := db.Model(&entity.Book{}).
-		Preload("Publisher").
-		Preload("FileType").
-		Preload("Language").
-		Preload("Authors") // <<-- ใช้ความสัมพันธ์ตรง ๆ
-
-	if v := c.Query("publisher_id"); v != "" {
-		q = q.Where("publisher_id = ?", v)
-	}
-	if v := c.Query("file_type_id"); v != "" {
-		q = q.Where("file_type_id = ?", v)
-	}
-	if v := c.Query("language_id"); v != "" {
-		q = q.Where("language_id = ?", v)
-	}
-
-	if err := q.Find(&rows).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
-		return
-	}
-
-	// build response แปลง []Book -> []BookWithAuthors
-	resp := make([]BookWithAuthors, 0, len(rows))
-	for _, b := range rows {
-		names := make([]string, 0, len(b.Authors))
-		for _, a := range b.Authors {
-			names = append(names, a.AuthorName) // <<-- ใช้ฟิลด์จริงในโมเดล
+	// สร้างหนังสือพร้อมหมวดหมู่ (ถ้าส่ง category มา) แล้วนับจำนวนหนังสือของหมวดหมู่ใหม่ใน transaction เดียว
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&body).Error; err != nil {
+			return err
 		}
-		resp = append(resp, BookWithAuthors{
-			Book:        b,
-			AuthorNames: strings.Join(names, ", "),
-		})
+		if err := services.SyncUploadReferences(tx, services.UploadOwnerBook, body.ID); err != nil {
+			return err
+		}
+		return services.SyncBookCategoryStatics(tx, body.ID)
+	}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-
-	c.JSON(http.StatusOK, resp)
+	c.JSON(http.StatusCreated, body)
 }
 
 // PUT /book/update
@@ -112,10 +86,35 @@ func UpdateBook(c *gin.Context) {
 		return
 	}
 
+	oldCover := existing.CoverImage
+
 	// กันไม่ให้เขียนค่า field ระบบทับโดยไม่ตั้งใจ
-	if err := db.Model(&existing).
-		Omit("ID", "CreatedAt", "UpdatedAt", "DeletedAt").
-		Updates(body).Error; err != nil {
+	// (category ใน body จะถูกเพิ่มเข้าไป ไม่ได้แทนที่ของเดิม ใช้ PUT /admin/books/:id/categories ถ้าต้องการแทนที่)
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&existing).
+			Omit("ID", "CreatedAt", "UpdatedAt", "DeletedAt", "CoverSmall", "CoverMedium", "CoverLarge").
+			Updates(body).Error; err != nil {
+			return err
+		}
+		// เปลี่ยนปก: สร้างภาพย่อใหม่ (ใช้ map เพราะปกภายนอกต้องล้างภาพย่อเดิมเป็นค่าว่าง)
+		if body.CoverImage != "" && body.CoverImage != oldCover {
+			if err := services.ApplyCoverThumbnails(config.Storage(), &body); err != nil {
+				return err
+			}
+			if err := tx.Model(&entity.Book{}).Where("id = ?", existing.ID).Updates(map[string]any{
+				"cover_small":  body.CoverSmall,
+				"cover_medium": body.CoverMedium,
+				"cover_large":  body.CoverLarge,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		// ปก/e-book เดิมที่ถูกแทนที่จะไม่มีใครอ้างถึงและถูกเก็บกวาดภายหลัง
+		if err := services.SyncUploadReferences(tx, services.UploadOwnerBook, existing.ID); err != nil {
+			return err
+		}
+		return services.SyncBookCategoryStatics(tx, existing.ID)
+	}); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -163,10 +162,30 @@ func DeleteBookById(c *gin.Context) {
 	// ถ้าไม่ได้ตั้ง OnDelete:CASCADE และอยากให้ pivot สะอาด ให้เคลียร์ก่อน
 	// _ = db.Model(&book).Association("Authors").Clear()
 
-	if tx := db.Delete(&book); tx.RowsAffected == 0 {
+	// ลบหนังสือพร้อมนับจำนวนหนังสือของหมวดหมู่และปล่อยไฟล์ใน transaction เดียว ถ้าขั้นใดล้มเหลวหนังสือจะไม่ถูกลบ
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&book)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		// หนังสือที่ถูกลบไม่นับใน BookCount ของหมวดหมู่
+		if err := services.SyncBookCategoryStatics(tx, book.ID); err != nil {
+			return err
+		}
+		// ไฟล์ของหนังสือที่ถูกลบไม่มีใครอ้างถึงแล้ว
+		return services.SyncUploadReferences(tx, services.UploadOwnerBook, book.ID)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "id not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "deleted successful"})
 }
 
@@ -202,6 +221,10 @@ func AddAuthorToBook(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := services.TouchBooks(db, book.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	c.JSON(http.StatusCreated, gin.H{"message": "linked"})
 }
 
@@ -234,5 +257,9 @@ func RemoveAuthorFromBook(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := services.TouchBooks(db, book.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "unlinked"})
 }
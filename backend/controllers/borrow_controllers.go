@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/PIPAT-I/G10-SA/services"
+	"github.com/gin-gonic/gin"
+)
+
+type BorrowController struct{ Svc *services.BorrowService }
+
+type checkoutReq struct {
+	BookID uint `json:"book_id" binding:"required"`
+}
+
+// serviceErrorStatus แปลง error จาก services (ยืม/คืน/จอง) เป็น HTTP status
+func serviceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrBookNotFound),
+		errors.Is(err, services.ErrBorrowNotFound),
+		errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, services.ErrLimitNotFound),
+		errors.Is(err, services.ErrReservationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrNoAvailableLicense),
+		errors.Is(err, services.ErrAlreadyBorrowed),
+		errors.Is(err, services.ErrAlreadyReturned),
+		errors.Is(err, services.ErrBorrowLimitReached),
+		errors.Is(err, services.ErrAlreadyReserved),
+		errors.Is(err, services.ErrReservationClosed):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// POST /user/borrows
+func (b *BorrowController) Checkout(c *gin.Context) {
+	var in checkoutReq
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	out, err := b.Svc.Checkout(services.CheckoutInput{UserID: currentUserID(c), BookID: in.BookID})
+	if err != nil {
+		c.JSON(serviceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, out)
+}
+
+// GET /user/borrows  (รองรับ ?active=true)
+func (b *BorrowController) FindMyBorrows(c *gin.Context) {
+	items, err := b.Svc.ListBorrows(currentUserID(c), c.Query("active") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// GET /user/borrows/:id
+func (b *BorrowController) FindMyBorrowById(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	out, err := b.Svc.GetBorrow(currentUserID(c), uint(id))
+	if err != nil {
+		c.JSON(serviceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// POST /user/borrows/:id/return
+func (b *BorrowController) Return(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	out, err := b.Svc.Return(currentUserID(c), uint(id))
+	if err != nil {
+		c.JSON(serviceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+type setBorrowingLimitReq struct {
+	BorrowingLimitID uint `json:"borrowing_limit_id" binding:"required"`
+}
+
+// GET /admin/borrowing-limits
+func (b *BorrowController) FindBorrowingLimits(c *gin.Context) {
+	items, err := b.Svc.ListBorrowingLimits()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// PUT /admin/users/:userId/borrowing-limit
+func (b *BorrowController) UpdateUserBorrowingLimit(c *gin.Context) {
+	var in setBorrowingLimitReq
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	u, err := b.Svc.SetBorrowingLimit(c.Param("userId"), in.BorrowingLimitID)
+	if err != nil {
+		c.JSON(serviceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":            u.UserID,
+		"borrowing_limit_id": u.BorrowingLimitID,
+		"borrowing_limit":    u.BorrowingLimit,
+	})
+}
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/PIPAT-I/G10-SA/services"
+	"github.com/gin-gonic/gin"
+)
+
+type CatalogController struct{ Svc *services.CatalogService }
+
+// catalogErrorStatus แปลง error ของ CatalogService เป็น HTTP status
+func catalogErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrEmptySearchQuery),
+		errors.Is(err, services.ErrInvalidSort),
+		errors.Is(err, services.ErrInvalidOrder),
+		errors.Is(err, services.ErrInvalidCursor),
+		errors.Is(err, services.ErrInvalidRange):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// idListParam อ่าน id หลายค่าจาก query ส่งได้ทั้ง ?x=1,2 และ ?x=1&x=2
+func idListParam(c *gin.Context, name string) ([]uint, error) {
+	var ids []uint
+	for _, v := range c.QueryArray(name) {
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			n, err := strconv.ParseUint(part, 10, 64)
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("invalid %s %q", name, part)
+			}
+			ids = append(ids, uint(n))
+		}
+	}
+	return ids, nil
+}
+
+// browseInput แปลง query string ของ FindBooks เป็น BrowseBooksInput
+func browseInput(c *gin.Context) (services.BrowseBooksInput, error) {
+	in := services.BrowseBooksInput{
+		Sort:   c.Query("sort"),
+		Order:  strings.ToLower(c.Query("order")),
+		Cursor: c.Query("cursor"),
+	}
+	lists := []struct {
+		name string
+		dest *[]uint
+	}{
+		{"category_id", &in.CategoryIDs},
+		{"author_id", &in.AuthorIDs},
+		{"publisher_id", &in.PublisherIDs},
+		{"language_id", &in.LanguageIDs},
+		{"file_type_id", &in.FileTypeIDs},
+	}
+	for _, l := range lists {
+		ids, err := idListParam(c, l.name)
+		if err != nil {
+			return in, err
+		}
+		*l.dest = ids
+	}
+
+	for name, dest := range map[string]*uint{"year_from": &in.YearFrom, "year_to": &in.YearTo} {
+		if v := c.Query(name); v != "" {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return in, fmt.Errorf("invalid %s %q", name, v)
+			}
+			*dest = uint(n)
+		}
+	}
+	if v := c.Query("available"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return in, fmt.Errorf("invalid available %q", v)
+		}
+		in.Available = &b
+	}
+	if v := c.Query("min_rating"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 5 {
+			return in, fmt.Errorf("invalid min_rating %q", v)
+		}
+		in.MinRating = &f
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > services.MaxBrowseLimit {
+			return in, fmt.Errorf("limit must be between 1 and %d", services.MaxBrowseLimit)
+		}
+		in.Limit = n
+	}
+	return in, nil
+}
+
+// GET /catalog/books
+// filter: ?category_id= ?author_id= ?publisher_id= ?language_id= ?file_type_id= (หลายค่าคั่นด้วย ,)
+// ?year_from= ?year_to= ?available=true|false ?min_rating=
+// เรียง: ?sort=title|year|popularity|rating ?order=asc|desc  หน้าถัดไป: ?cursor=<next_cursor> ?limit=
+func (ct *CatalogController) FindBooks(c *gin.Context) {
+	in, err := browseInput(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	out, err := ct.Svc.Browse(in)
+	if err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GET /catalog/search?q=  (รองรับ ?page=  ?page_size=)
+func (ct *CatalogController) SearchBooks(c *gin.Context) {
+	page, pageSize := pageParams(c)
+	out, err := ct.Svc.Search(c.Query("q"), page, pageSize)
+	if err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GET /catalog/categories/:id/books  หนังสือในหมวดนี้และหมวดย่อยทุกระดับ
+// รับ query string เดียวกับ /catalog/books (category_id ใน query จะถูกแทนด้วย :id)
+func (ct *CatalogController) FindCategoryBooks(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	in, err := browseInput(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	in.CategoryIDs = []uint{id}
+	out, err := ct.Svc.Browse(in)
+	if err != nil {
+		c.JSON(catalogErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
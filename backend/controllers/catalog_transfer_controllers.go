@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/services"
+	"github.com/gin-gonic/gin"
+)
+
+const maxCatalogImportBytes = 32 << 20
+
+type CatalogTransferController struct {
+	Svc *services.CatalogTransferService
+}
+
+// catalogTransferErrorStatus แปลง error ของ CatalogTransferService เป็น HTTP status
+func catalogTransferErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCatalogFormat),
+		errors.Is(err, services.ErrCatalogImportHeader),
+		errors.Is(err, services.ErrCatalogImportEmpty),
+		errors.Is(err, services.ErrCatalogImportTooLarge),
+		errors.Is(err, services.ErrCatalogImportMalformed):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// catalogFormat ใช้ ?format= ถ้ามี ไม่เช่นนั้นเดาจากนามสกุลไฟล์หรือ Content-Type
+func catalogFormat(c *gin.Context, filename, contentType string) string {
+	if f := strings.ToLower(c.Query("format")); f != "" {
+		return f
+	}
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		return services.CatalogFormatCSV
+	case ".json":
+		return services.CatalogFormatJSON
+	}
+	mt, _, _ := mime.ParseMediaType(contentType)
+	switch mt {
+	case "text/csv":
+		return services.CatalogFormatCSV
+	case "application/json", "application/marc+json":
+		return services.CatalogFormatJSON
+	}
+	return ""
+}
+
+// POST /admin/catalog/import  (ส่งไฟล์ใน field "file" หรือเป็น body ตรง ๆ; ?format=csv|json
+// ค่าเริ่มต้นตรวจอย่างเดียว ต้องส่ง ?mode=commit จึงจะบันทึก)
+func (t *CatalogTransferController) ImportCatalog(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCatalogImportBytes)
+
+	var r io.Reader = c.Request.Body
+	format := catalogFormat(c, "", c.ContentType())
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+		r = f
+		format = catalogFormat(c, fh.Filename, fh.Header.Get("Content-Type"))
+	}
+
+	out, err := t.Svc.Import(r, services.ImportCatalogInput{
+		Format: format,
+		DryRun: c.Query("mode") != "commit",
+		UserID: currentUserID(c),
+	})
+	if errors.Is(err, services.ErrCatalogImportHasErrors) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "result": out})
+		return
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "catalog file is too large"})
+			return
+		}
+		c.JSON(catalogTransferErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GET /admin/catalog/export  (?format=csv|json ค่าเริ่มต้น csv) ส่งทั้งแค็ตตาล็อกแบบ stream
+func (t *CatalogTransferController) ExportCatalog(c *gin.Context) {
+	format := c.DefaultQuery("format", services.CatalogFormatCSV)
+	contentType, ext := "text/csv; charset=utf-8", "csv"
+	switch format {
+	case services.CatalogFormatCSV:
+	case services.CatalogFormatJSON:
+		contentType, ext = "application/json", "json"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrCatalogFormat.Error()})
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="catalog-%s.%s"`, time.Now().Format("20060102"), ext))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	if err := t.Svc.Export(c.Writer, format, c.Writer.Flush); err != nil {
+		// ส่ง header ไปแล้วจึงเปลี่ยน status ไม่ได้ ไฟล์ที่ได้จะไม่ครบ
+		log.Printf("export catalog: %v", err)
+		c.Abort()
+	}
+}
@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/PIPAT-I/G10-SA/services"
+	"github.com/gin-gonic/gin"
+)
+
+type CategoryController struct{ Svc *services.CategoryService }
+
+type createCategoryReq struct {
+	CategoryName string `json:"category_name" binding:"required"`
+	CategoryCode string `json:"category_code" binding:"required"`
+	Description  string `json:"description"`
+	ParentID     *uint  `json:"parent_id"`
+}
+
+type updateCategoryReq struct {
+	CategoryName *string `json:"category_name"`
+	CategoryCode *string `json:"category_code"`
+	Description  *string `json:"description"`
+	ParentID     *uint   `json:"parent_id"` // 0 = ย้ายเป็นหมวดหมู่ระดับบนสุด
+}
+
+type bookCategoriesReq struct {
+	CategoryIDs []uint `json:"category_ids"`
+}
+
+// categoryErrorStatus แปลง error ของ CategoryService เป็น HTTP status
+func categoryErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCategoryNotFound),
+		errors.Is(err, services.ErrBookNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrCategoryNameRequired),
+		errors.Is(err, services.ErrInvalidCategoryCode):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrCategoryCodeTaken),
+		errors.Is(err, services.ErrCategoryInUse),
+		errors.Is(err, services.ErrCategoryCycle),
+		errors.Is(err, services.ErrCategoryHasChildren):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// idParam อ่าน path parameter ที่เป็น id (ตอบ 400 ให้เองถ้าไม่ถูกต้อง)
+func idParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GET /catalog/categories  (รองรับ ?q=)
+func (ct *CategoryController) FindCategories(c *gin.Context) {
+	cats, err := ct.Svc.List(c.Query("q"))
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, cats)
+}
+
+// GET /catalog/categories/tree
+func (ct *CategoryController) FindCategoryTree(c *gin.Context) {
+	tree, err := ct.Svc.Tree()
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tree)
+}
+
+// GET /catalog/categories/:id  (รวมหมวดย่อยระดับถัดไปและ path สำหรับ breadcrumb)
+func (ct *CategoryController) FindCategoryById(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	cat, err := ct.Svc.Get(id)
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, cat)
+}
+
+// POST /admin/categories
+func (ct *CategoryController) CreateCategory(c *gin.Context) {
+	var in createCategoryReq
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	cat, err := ct.Svc.Create(currentUserID(c), services.CategoryInput{
+		CategoryName: in.CategoryName,
+		CategoryCode: in.CategoryCode,
+		Description:  in.Description,
+		ParentID:     in.ParentID,
+	})
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, cat)
+}
+
+// PUT /admin/categories/:id
+func (ct *CategoryController) UpdateCategory(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var in updateCategoryReq
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	cat, err := ct.Svc.Update(id, services.UpdateCategoryInput{
+		CategoryName: in.CategoryName,
+		CategoryCode: in.CategoryCode,
+		Description:  in.Description,
+		ParentID:     in.ParentID,
+	})
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, cat)
+}
+
+// DELETE /admin/categories/:id
+func (ct *CategoryController) DeleteCategory(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	if err := ct.Svc.Delete(id); err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "deleted successful"})
+}
+
+// GET /catalog/books/:id/categories
+func (ct *CategoryController) FindBookCategories(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	cats, err := ct.Svc.BookCategories(id)
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, cats)
+}
+
+// POST /admin/books/:id/categories  {"category_ids": [..]}  ผูกหมวดหมู่เพิ่ม
+func (ct *CategoryController) AttachCategories(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var in bookCategoriesReq
+	if err := c.ShouldBindJSON(&in); err != nil || len(in.CategoryIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "category_ids is required"})
+		return
+	}
+	cats, err := ct.Svc.AttachCategories(id, in.CategoryIDs)
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, cats)
+}
+
+// PUT /admin/books/:id/categories  {"category_ids": [..]}  แทนที่หมวดหมู่ทั้งหมด
+func (ct *CategoryController) SetBookCategories(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var in bookCategoriesReq
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	cats, err := ct.Svc.SetBookCategories(id, in.CategoryIDs)
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, cats)
+}
+
+// DELETE /admin/books/:id/categories/:categoryId
+func (ct *CategoryController) DetachCategory(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	categoryID, ok := idParam(c, "categoryId")
+	if !ok {
+		return
+	}
+	cats, err := ct.Svc.DetachCategory(id, categoryID)
+	if err != nil {
+		c.JSON(categoryErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, cats)
+}
@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/PIPAT-I/G10-SA/services"
+	"github.com/gin-gonic/gin"
+)
+
+type CoverController struct{ Svc *services.CoverService }
+
+// coverErrorStatus แปลง error ของ CoverService เป็น HTTP status
+func coverErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrBookNotFound),
+		errors.Is(err, services.ErrCoverNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidCoverSize):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GET /catalog/books/:id/cover?size=small|medium|large|original  redirect ไปยังไฟล์ภาพใน /static
+func (ct *CoverController) FindBookCover(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	url, err := ct.Svc.CoverURL(id, c.Query("size"))
+	if err != nil {
+		c.JSON(coverErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Redirect(http.StatusFound, url)
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/PIPAT-I/G10-SA/services"
+	"github.com/gin-gonic/gin"
+)
+
+type EbookController struct {
+	Svc    *services.EbookDeliveryService
+	Drafts *services.BookDraftService
+}
+
+// ebookErrorStatus แปลง error ของ EbookDeliveryService เป็น HTTP status
+func ebookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrBookNotFound),
+		errors.Is(err, services.ErrEbookNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrNoActiveBorrow),
+		errors.Is(err, services.ErrInvalidDownloadURL):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// POST /admin/uploads/ebook  (multipart field "file") ไฟล์ถูกเก็บใน Storage จึงดาวน์โหลดตรง ๆ ไม่ได้
+// คืน draft: ข้อมูลหนังสือที่อ่านจาก metadata ของไฟล์ (ชื่อเรื่อง, ISBN, จำนวนหน้า, ผู้แต่ง, ปก ฯลฯ)
+// draft.book ใช้เป็น body ของ POST /admin/books ได้หลังตรวจ/แก้ไขแล้ว
+func (e *EbookController) UploadEbook(c *gin.Context) {
+	up, err := openUploadedFile(c, services.EbookUploadPolicy)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": "upload ebook failed", "detail": err.Error()})
+		return
+	}
+	defer up.Close()
+
+	// อ่าน metadata ก่อนบันทึกไฟล์ ถ้าผิดพลาดกลางทางจะไม่มีไฟล์ค้างใน Storage
+	md, mdErr := services.ExtractEbookMetadata(up, up.Size, up.ContentType)
+	key, err := up.store(c, e.Svc.Store, services.UploadStoreMain, "ebooks")
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": "upload ebook failed", "detail": err.Error()})
+		return
+	}
+	draft, err := e.Drafts.Draft(md, mdErr, key, currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ebook_file": key, "draft": draft})
+}
+
+// GET /user/books/:id/download  ออกลิงก์ดาวน์โหลดอายุสั้น (ต้องยืมหนังสือเล่มนี้อยู่)
+func (e *EbookController) DownloadLink(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	link, err := e.Svc.IssueLink(currentUserID(c), id)
+	if err != nil {
+		c.JSON(ebookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+// GET /download/ebooks/:id?u=&exp=&sig=  สิทธิ์มาจากลายเซ็นในลิงก์
+// ผ่านแล้ว redirect ไปยัง signed URL อายุสั้นของ Storage ซึ่งรองรับ Range
+func (e *EbookController) Download(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	exp, err := strconv.ParseInt(c.Query("exp"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": services.ErrInvalidDownloadURL.Error()})
+		return
+	}
+	url, err := e.Svc.Open(id, c.Query("u"), exp, c.Query("sig"))
+	if err != nil {
+		c.JSON(ebookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "private, no-store")
+	c.Redirect(http.StatusFound, url)
+}
@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/PIPAT-I/G10-SA/services"
+	"github.com/gin-gonic/gin"
+)
+
+type FileController struct{ Store *services.LocalStorage }
+
+// GET /files/*key?exp=&sig=  ส่งไฟล์จาก LocalStorage ตาม signed URL (รองรับ Range)
+func (f *FileController) ServeFile(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	exp, err := strconv.ParseInt(c.Query("exp"), 10, 64)
+	if err != nil || f.Store.Verify(key, exp, c.Query("sig")) != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": services.ErrInvalidFileLink.Error()})
+		return
+	}
+	obj, err := f.Store.Get(key)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrObjectNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	defer obj.Body.Close()
+
+	c.Header("Cache-Control", "private")
+	c.Header("Content-Type", obj.ContentType)
+	// ServeContent จัดการ Range / If-Range / If-Modified-Since ให้
+	http.ServeContent(c.Writer, c.Request, "", obj.ModTime, obj.Body.(io.ReadSeeker))
+}
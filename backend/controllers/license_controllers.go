@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/services"
+	"github.com/gin-gonic/gin"
+)
+
+type LicenseController struct{ Svc *services.LicenseService }
+
+type addLicensesReq struct {
+	Count        int        `json:"count"`
+	LicenseModel string     `json:"license_model"` // perpetual (ค่าเริ่มต้น), time_limited, metered
+	ExpiresAt    *time.Time `json:"expires_at"`
+	MaxCheckouts *uint      `json:"max_checkouts"`
+}
+
+type retireLicensesReq struct {
+	LicenseIDs []uint `json:"license_ids" binding:"required"`
+}
+
+type setLicenseStatusReq struct {
+	Status string `json:"status" binding:"required"` // ชื่อสถานะ เช่น Available, Retired
+}
+
+// licenseErrorStatus แปลง error ของ LicenseService เป็น HTTP status
+func licenseErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrBookNotFound),
+		errors.Is(err, services.ErrLicenseNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidLicenseCount),
+		errors.Is(err, services.ErrLicenseStatusNotFound),
+		errors.Is(err, services.ErrLicenseManualStatus),
+		errors.Is(err, services.ErrInvalidLicenseModel),
+		errors.Is(err, services.ErrInvalidLicenseTerms):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrLicenseBorrowed),
+		errors.Is(err, services.ErrLicenseSpent):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GET /catalog/books/:id/availability
+func (l *LicenseController) FindAvailability(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	out, err := l.Svc.Summary(id)
+	if err != nil {
+		c.JSON(licenseErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GET /admin/books/:id/licenses  (รองรับ ?status=)
+func (l *LicenseController) FindLicenses(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	out, err := l.Svc.Inventory(id, c.Query("status"))
+	if err != nil {
+		c.JSON(licenseErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// POST /admin/books/:id/licenses  {"count": n, "license_model": "metered", "max_checkouts": 26}
+func (l *LicenseController) AddLicenses(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var in addLicensesReq
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	out, err := l.Svc.Add(id, services.AddLicensesInput{
+		Count:        in.Count,
+		Model:        in.LicenseModel,
+		ExpiresAt:    in.ExpiresAt,
+		MaxCheckouts: in.MaxCheckouts,
+	})
+	if err != nil {
+		c.JSON(licenseErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, out)
+}
+
+// POST /admin/books/:id/licenses/retire  {"license_ids": [..]}
+func (l *LicenseController) RetireLicenses(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	var in retireLicensesReq
+	if err := c.ShouldBindJSON(&in); err != nil || len(in.LicenseIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "license_ids is required"})
+		return
+	}
+	out, err := l.Svc.Retire(id, in.LicenseIDs)
+	if err != nil {
+		c.JSON(licenseErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// PUT /admin/books/:id/licenses/:licenseId/status  {"status": "Available"}
+func (l *LicenseController) SetLicenseStatus(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	licenseID, ok := idParam(c, "licenseId")
+	if !ok {
+		return
+	}
+	var in setLicenseStatusReq
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	out, err := l.Svc.SetStatus(id, licenseID, in.Status)
+	if err != nil {
+		c.JSON(licenseErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GET /admin/licenses/expiring?days=30&remaining=3
+// license ที่จะหมดอายุภายใน days วัน หรือเหลือจำนวนครั้งที่ยืมได้ไม่เกิน remaining
+func (l *LicenseController) FindExpiringLicenses(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid days"})
+		return
+	}
+	remaining, err := strconv.ParseUint(c.DefaultQuery("remaining", "3"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid remaining"})
+		return
+	}
+	out, err := l.Svc.ExpiringReport(time.Duration(days)*24*time.Hour, uint(remaining))
+	if err != nil {
+		c.JSON(licenseErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/services"
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationController struct{ Svc *services.NotificationService }
+
+// ส่ง comment เปล่าเป็นระยะ กัน proxy/เบราว์เซอร์ตัดการเชื่อมต่อที่เงียบนาน
+const sseHeartbeatInterval = 25 * time.Second
+
+func notificationErrorStatus(err error) int {
+	if errors.Is(err, services.ErrNotificationNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// GET /user/notifications  (รองรับ ?unread=true  ?page=  ?page_size=)
+func (n *NotificationController) FindMyNotifications(c *gin.Context) {
+	page, pageSize := pageParams(c)
+	out, err := n.Svc.List(currentUserID(c), c.Query("unread") == "true", page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GET /user/notifications/unread-count
+func (n *NotificationController) UnreadCount(c *gin.Context) {
+	count, err := n.Svc.UnreadCount(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unread": count})
+}
+
+// PUT /user/notifications/:id/read
+func (n *NotificationController) MarkRead(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := n.Svc.MarkRead(currentUserID(c), uint(id)); err != nil {
+		c.JSON(notificationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "marked as read"})
+}
+
+// PUT /user/notifications/read-all
+func (n *NotificationController) MarkAllRead(c *gin.Context) {
+	updated, err := n.Svc.MarkAllRead(currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "marked as read", "updated": updated})
+}
+
+// DELETE /user/notifications/:id
+func (n *NotificationController) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	if err := n.Svc.Delete(currentUserID(c), uint(id)); err != nil {
+		c.JSON(notificationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "deleted successful"})
+}
+
+// POST /user/notifications/stream-ticket  ออก ticket ใช้ครั้งเดียวสำหรับเปิด stream
+func (n *NotificationController) StreamTicket(c *gin.Context) {
+	hub := n.Svc.Hub
+	if hub == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "real-time notifications are disabled"})
+		return
+	}
+	ticket, exp, err := hub.IssueStreamTicket(currentUserID(c), currentSessionID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ticket": ticket, "expires_at": exp})
+}
+
+// GET /user/notifications/stream?ticket=  (Server-Sent Events: notification, announcement)
+// ไม่ผ่าน AuthRequired: สิทธิ์มาจาก ticket ของ /user/notifications/stream-ticket
+// ตรวจ session ของ ticket ซ้ำก่อนส่งทุก event และทุก heartbeat: logout, เปลี่ยนรหัสผ่าน หรือปิดบัญชีจะปิด stream ด้วย
+func (n *NotificationController) Stream(c *gin.Context) {
+	hub := n.Svc.Hub
+	if hub == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "real-time notifications are disabled"})
+		return
+	}
+	userID, sessionID, ok := hub.RedeemStreamTicket(c.Query("ticket"))
+	if !ok || !services.SessionActive(n.Svc.DB, userID, sessionID) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired stream ticket"})
+		return
+	}
+	sub := hub.Subscribe(userID)
+	defer hub.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	unread, _ := n.Svc.UnreadCount(userID)
+	c.SSEvent("ready", gin.H{"unread": unread})
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-sub.C:
+			if !ok {
+				// รับไม่ทันจนถูกตัด: ปิดสตรีมให้ client ต่อใหม่แล้วโหลดกล่องแจ้งเตือนเอง
+				return
+			}
+			if !services.SessionActive(n.Svc.DB, userID, sessionID) {
+				return
+			}
+			c.SSEvent(ev.Name, ev.Data)
+			c.Writer.Flush()
+		case <-heartbeat.C:
+			if !services.SessionActive(n.Svc.DB, userID, sessionID) {
+				return
+			}
+			fmt.Fprint(c.Writer, ": ping\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+
+	"github.com/PIPAT-I/G10-SA/services"
+	"github.com/gin-gonic/gin"
+)
+
+type OAIController struct {
+	Svc *services.OAIService
+	// BaseURL ที่ประกาศใน Identify (ว่าง = สร้างจาก URL ของคำขอ ใช้เมื่ออยู่หลัง reverse proxy)
+	BaseURL string
+}
+
+// requestBaseURL URL ของ endpoint ที่ถูกเรียก (ไม่รวม query string)
+func (o *OAIController) requestBaseURL(c *gin.Context) string {
+	if o.BaseURL != "" {
+		return o.BaseURL
+	}
+	return requestOrigin(c) + c.Request.URL.Path
+}
+
+// requestOrigin scheme และ host ของคำขอ เช่น https://library.example.ac.th
+func requestOrigin(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// writeXML ส่ง XML พร้อม XML declaration
+func writeXML(c *gin.Context, v any) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "text/xml; charset=utf-8", append([]byte(xml.Header), data...))
+}
+
+// GET|POST /oai  OAI-PMH 2.0 (Identify, ListMetadataFormats, GetRecord, ListRecords, ListIdentifiers)
+// error ของโปรโตคอล (badVerb, noRecordsMatch ฯลฯ) ตอบเป็น XML พร้อม status 200 ตามข้อกำหนด
+func (o *OAIController) Handle(c *gin.Context) {
+	args := c.Request.URL.Query()
+	if c.Request.Method == http.MethodPost {
+		if err := c.Request.ParseForm(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		args = c.Request.PostForm
+	}
+	out, err := o.Svc.Handle(o.requestBaseURL(c), args)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writeXML(c, out)
+}
+
+// GET /catalog/books/:id/dc  ข้อมูลหนังสือแบบ Dublin Core (oai_dc)
+func (o *OAIController) FindBookDublinCore(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	dc, err := o.Svc.BookDublinCore(id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrBookNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	writeXML(c, dc)
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+
+	"github.com/PIPAT-I/G10-SA/services"
+	"github.com/gin-gonic/gin"
+)
+
+type OPDSController struct {
+	Svc     *services.OPDSService
+	Borrows *services.BorrowService
+	Ebooks  *services.EbookDeliveryService
+	// BaseURL URL ของ /api ที่ใช้ในลิงก์ของฟีด (ว่าง = สร้างจาก URL ของคำขอ ใช้เมื่ออยู่หลัง reverse proxy)
+	BaseURL string
+}
+
+// opdsErrorStatus แปลง error ของ OPDSService เป็น HTTP status
+func opdsErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCategoryNotFound),
+		errors.Is(err, services.ErrAuthorNotFound),
+		errors.Is(err, services.ErrBookNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrEmptySearchQuery):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (o *OPDSController) request(c *gin.Context) services.OPDSRequest {
+	base := o.BaseURL
+	if base == "" {
+		base = requestOrigin(c) + "/api"
+	}
+	page, _ := pageParams(c)
+	return services.OPDSRequest{BaseURL: base, UserID: currentUserID(c), Page: page}
+}
+
+// writeOPDS ส่งเอกสาร Atom ของ OPDS พร้อม XML declaration
+func writeOPDS(c *gin.Context, status int, contentType string, v any) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// ฟีดขึ้นกับผู้ใช้ (ลิงก์ยืม/ดาวน์โหลด) จึงห้าม cache ร่วมกัน
+	c.Header("Cache-Control", "private, no-cache")
+	c.Data(status, contentType+"; charset=utf-8", append([]byte(xml.Header), data...))
+}
+
+func (o *OPDSController) writeFeed(c *gin.Context, f *services.OPDSFeed, err error) {
+	if err != nil {
+		c.JSON(opdsErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	writeOPDS(c, http.StatusOK, f.Kind, f)
+}
+
+// GET /opds  หน้าแรกของแค็ตตาล็อก OPDS (ใส่ URL นี้ในแอปอ่าน e-book)
+func (o *OPDSController) Root(c *gin.Context) {
+	o.writeFeed(c, o.Svc.Root(o.request(c)), nil)
+}
+
+// GET /opds/categories  หมวดหมู่ระดับบนสุด
+func (o *OPDSController) Categories(c *gin.Context) {
+	f, err := o.Svc.Categories(o.request(c), 0)
+	o.writeFeed(c, f, err)
+}
+
+// GET /opds/categories/:id  หมวดย่อยของหมวดหมู่
+func (o *OPDSController) Category(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	f, err := o.Svc.Categories(o.request(c), id)
+	o.writeFeed(c, f, err)
+}
+
+// GET /opds/categories/:id/books?page=  หนังสือในหมวดหมู่ (รวมหมวดย่อย)
+func (o *OPDSController) CategoryBooks(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	f, err := o.Svc.CategoryBooks(o.request(c), id)
+	o.writeFeed(c, f, err)
+}
+
+// GET /opds/authors?page=
+func (o *OPDSController) Authors(c *gin.Context) {
+	f, err := o.Svc.Authors(o.request(c))
+	o.writeFeed(c, f, err)
+}
+
+// GET /opds/authors/:id/books?page=
+func (o *OPDSController) AuthorBooks(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	f, err := o.Svc.AuthorBooks(o.request(c), id)
+	o.writeFeed(c, f, err)
+}
+
+// GET /opds/new?page=  หนังสือที่เพิ่มล่าสุด
+func (o *OPDSController) NewBooks(c *gin.Context) {
+	f, err := o.Svc.NewBooks(o.request(c))
+	o.writeFeed(c, f, err)
+}
+
+// GET /opds/shelf  หนังสือที่ผู้ใช้ยืมอยู่
+func (o *OPDSController) Shelf(c *gin.Context) {
+	f, err := o.Svc.Shelf(o.request(c))
+	o.writeFeed(c, f, err)
+}
+
+// GET /opds/search?q=&page=
+func (o *OPDSController) Search(c *gin.Context) {
+	f, err := o.Svc.Search(o.request(c), c.Query("q"))
+	o.writeFeed(c, f, err)
+}
+
+// GET /opds/opensearch.xml
+func (o *OPDSController) OpenSearch(c *gin.Context) {
+	writeOPDS(c, http.StatusOK, services.OpenSearchType, o.Svc.OpenSearch(o.request(c)))
+}
+
+// GET /opds/books/:id/borrow  ยืมหนังสือ (แอปอ่าน e-book ทำตามลิงก์ด้วย GET)
+// คืน entry ของหนังสือที่มีลิงก์ดาวน์โหลด ถ้ายืมอยู่แล้วคืน entry เดิมโดยไม่ยืมซ้ำ
+func (o *OPDSController) Borrow(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	status := http.StatusCreated
+	_, err := o.Borrows.Checkout(services.CheckoutInput{UserID: currentUserID(c), BookID: id})
+	if errors.Is(err, services.ErrAlreadyBorrowed) {
+		status, err = http.StatusOK, nil
+	}
+	if err != nil {
+		c.JSON(serviceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	e, err := o.Svc.BookEntry(o.request(c), id)
+	if err != nil {
+		c.JSON(opdsErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	writeOPDS(c, status, services.OPDSEntryType, e)
+}
+
+// GET /opds/books/:id/download  ต้องยืมอยู่ redirect ไปยังลิงก์ลงลายเซ็นของ /download/ebooks/:id
+func (o *OPDSController) Download(c *gin.Context) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return
+	}
+	link, err := o.Ebooks.IssueLink(currentUserID(c), id)
+	if err != nil {
+		c.JSON(ebookErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "private, no-store")
+	c.Redirect(http.StatusFound, link.URL)
+}
@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageParams อ่าน ?page= และ ?page_size= (ค่าเริ่มต้น 1 และ 20, page_size สูงสุด 200)
+func pageParams(c *gin.Context) (page, pageSize int) {
+	page, pageSize = 1, 20
+	if v := c.Query("page_size"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 200 {
+			pageSize = n
+		}
+	}
+	if v := c.Query("page"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			page = n
+		}
+	}
+	return page, pageSize
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/PIPAT-I/G10-SA/services"
+	"github.com/gin-gonic/gin"
+)
+
+type ReservationController struct{ Svc *services.ReservationService }
+
+type reserveReq struct {
+	BookID uint `json:"book_id" binding:"required"`
+}
+
+// POST /user/reservations
+func (r *ReservationController) Reserve(c *gin.Context) {
+	var in reserveReq
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	out, err := r.Svc.Reserve(currentUserID(c), in.BookID)
+	if err != nil {
+		c.JSON(serviceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, out)
+}
+
+// GET /user/reservations  (รองรับ ?active=true)
+func (r *ReservationController) FindMyReservations(c *gin.Context) {
+	items, err := r.Svc.ListReservations(currentUserID(c), c.Query("active") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// GET /user/reservations/:id
+func (r *ReservationController) FindMyReservationById(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	out, err := r.Svc.GetReservation(currentUserID(c), uint(id))
+	if err != nil {
+		c.JSON(serviceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// POST /user/reservations/:id/cancel
+func (r *ReservationController) Cancel(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	out, err := r.Svc.Cancel(currentUserID(c), uint(id))
+	if err != nil {
+		c.JSON(serviceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GET /admin/books/:id/reservations  (คิวการจองที่ยังเปิดอยู่)
+func (r *ReservationController) FindBookQueue(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	items, err := r.Svc.BookQueue(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
@@ -1,73 +1,143 @@
 package controllers
 
 import (
+	"errors"
+	"io"
+	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
 	"time"
 
+	"github.com/PIPAT-I/G10-SA/config"
+	"github.com/PIPAT-I/G10-SA/services"
 	"github.com/gin-gonic/gin"
 )
 
-func ensureDir(dir string) error {
-	return os.MkdirAll(dir, os.ModePerm)
+// staticDir โฟลเดอร์ไฟล์สาธารณะที่เสิร์ฟที่ /static (รูปโปรไฟล์)
+const staticDir = "static"
+
+// publicFiles ไฟล์ใน ./static ซึ่งใครก็เปิดได้ ส่วนปกและ e-book อยู่ใน config.Storage()
+var publicFiles = &services.LocalStorage{Root: staticDir}
+
+// multipartOverhead เผื่อขนาด header ของ multipart form นอกเหนือจากตัวไฟล์
+const multipartOverhead = 1 << 20
+
+// uploadErrorStatus แปลง error ของการอัปโหลดเป็น HTTP status
+func uploadErrorStatus(err error) int {
+	var tooBig *http.MaxBytesError
+	switch {
+	case errors.Is(err, services.ErrUploadTooLarge), errors.As(err, &tooBig):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrUploadUnsupportedType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, services.ErrUploadMissing),
+		errors.Is(err, services.ErrUploadCorrupt):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
 }
 
-func saveUploadedFile(c *gin.Context, subdir string, allowExts []string) (string, error) {
-	file, err := c.FormFile("file")
+func saveUploadedFile(c *gin.Context, subdir string, policy services.UploadPolicy) (string, error) {
+	key, err := storeUploadedFile(c, publicFiles, services.UploadStorePublic, subdir, policy)
 	if err != nil {
 		return "", err
 	}
 
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	ok := false
-	for _, a := range allowExts {
-		if ext == a {
-			ok = true
-			break
+	// URL ที่ฝั่งเว็บจะเรียก
+	url := "/" + staticDir + "/" + key
+	return url, nil
+}
+
+// checkedUpload ไฟล์จากฟอร์ม field "file" ที่ตรวจชนิดตาม policy แล้ว แต่ยังไม่ได้บันทึก
+type checkedUpload struct {
+	multipart.File
+	Size        int64
+	ContentType string
+}
+
+// openUploadedFile เปิดไฟล์จากฟอร์ม field "file" และตรวจชนิดไฟล์จากเนื้อไฟล์จริงตาม policy
+// ผู้เรียกต้อง Close เอง
+func openUploadedFile(c *gin.Context, policy services.UploadPolicy) (*checkedUpload, error) {
+	// จำกัดขนาด body ก่อน parse form กันไฟล์ใหญ่ถูกเขียนลง temp จนเต็ม
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, policy.MaxBytes+multipartOverhead)
+	file, err := c.FormFile("file")
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			return nil, services.ErrUploadTooLarge
 		}
+		return nil, services.ErrUploadMissing
 	}
-	if !ok {
-		return "", gin.Error{
-			Err:  http.ErrNotSupported,
-			Type: gin.ErrorTypeBind,
-			Meta: "invalid file type",
-		}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	contentType, err := policy.Check(src, file.Size)
+	if err != nil {
+		src.Close()
+		return nil, err
 	}
+	return &checkedUpload{File: src, Size: file.Size, ContentType: contentType}, nil
+}
 
-	dir := filepath.Join("static", subdir)
-	if err := ensureDir(dir); err != nil {
+// store บันทึกไฟล์ลง store ใต้ prefix ด้วยชื่อสุ่มใหม่ คืน key ของไฟล์ (ชื่อไฟล์จาก client ไม่ถูกใช้เลย)
+// ไฟล์ถูกบันทึกใน Upload (storeName คือ services.UploadStore*) เพื่อเก็บกวาดถ้าไม่มีระเบียนใดนำไปใช้
+func (u *checkedUpload) store(c *gin.Context, store services.Storage, storeName, prefix string) (string, error) {
+	newName, err := services.RandomUploadName(u.ContentType)
+	if err != nil {
 		return "", err
 	}
-
-	// ตั้งชื่อไฟล์ใหม่กันชนกัน
-	newName := time.Now().Format("20060102150405") + "_" + strings.ReplaceAll(file.Filename, " ", "_")
-	dst := filepath.Join(dir, newName)
-
-	if err := c.SaveUploadedFile(file, dst); err != nil {
+	key := prefix + "/" + newName
+	if err := store.Put(key, io.NewSectionReader(u.File, 0, u.Size), u.Size, u.ContentType); err != nil {
+		return "", err
+	}
+	if err := services.TrackUpload(config.DB(), storeName, key, u.ContentType, u.Size, currentUserID(c)); err != nil {
 		return "", err
 	}
+	return key, nil
+}
 
-	// URL ที่ฝั่งเว็บจะเรียก
-	url := "/" + filepath.ToSlash(filepath.Join("static", subdir, newName))
-	return url, nil
+// storeUploadedFile ตรวจแล้วบันทึกไฟล์จากฟอร์ม field "file" ลง store ใต้ prefix คืน key ของไฟล์ที่ตั้งชื่อใหม่
+func storeUploadedFile(c *gin.Context, store services.Storage, storeName, prefix string, policy services.UploadPolicy) (string, error) {
+	up, err := openUploadedFile(c, policy)
+	if err != nil {
+		return "", err
+	}
+	defer up.Close()
+	return up.store(c, store, storeName, prefix)
 }
 
+// POST /admin/uploads/cover  คืน key ของภาพต้นฉบับและภาพย่อทุกขนาด (ใช้เป็นค่า cover_image ของหนังสือ)
+// พร้อม url ชั่วคราวสำหรับแสดงตัวอย่าง
 func UploadCover(c *gin.Context) {
-	url, err := saveUploadedFile(c, "covers", []string{".png", ".jpg", ".jpeg", ".webp"})
+	store := config.Storage()
+	key, err := storeUploadedFile(c, store, services.UploadStoreMain, "covers", services.CoverUploadPolicy)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "upload cover failed", "detail": err.Error()})
+		c.JSON(uploadErrorStatus(err), gin.H{"error": "upload cover failed", "detail": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"url": url})
-}
-
-func UploadEbook(c *gin.Context) {
-	url, err := saveUploadedFile(c, "ebooks", []string{".pdf", ".epub"})
+	thumbs, err := services.GenerateCoverThumbnails(store, key)
+	if err != nil {
+		c.JSON(uploadErrorStatus(err), gin.H{"error": "upload cover failed", "detail": err.Error()})
+		return
+	}
+	for _, t := range []string{thumbs.Small, thumbs.Medium, thumbs.Large} {
+		if err := services.TrackUpload(config.DB(), services.UploadStoreMain, t, services.ContentTypeJPEG, 0, currentUserID(c)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	url, err := store.SignedURL(key, time.Hour)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "upload ebook failed", "detail": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"url": url})
+	c.JSON(http.StatusOK, gin.H{
+		"cover_image":  key,
+		"cover_small":  thumbs.Small,
+		"cover_medium": thumbs.Medium,
+		"cover_large":  thumbs.Large,
+		"url":          url,
+	})
 }
@@ -0,0 +1,44 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/services"
+	"github.com/gin-gonic/gin"
+)
+
+type UploadController struct{ Svc *services.UploadService }
+
+type collectGarbageReq struct {
+	DryRun     *bool    `json:"dry_run"`     // ค่าเริ่มต้น true: ต้องส่ง false จึงจะลบไฟล์จริง
+	GraceHours *float64 `json:"grace_hours"` // ค่าเริ่มต้น 168 (7 วัน)
+}
+
+// POST /admin/uploads/gc  ลบไฟล์ที่ไม่มีหนังสือ/โปรไฟล์/issue/ไฟล์แนบใดอ้างถึงนานกว่า grace_hours
+func (u *UploadController) CollectGarbage(c *gin.Context) {
+	var req collectGarbageReq
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	in := services.GarbageInput{DryRun: true, Grace: services.DefaultUploadGracePeriod}
+	if req.DryRun != nil {
+		in.DryRun = *req.DryRun
+	}
+	if req.GraceHours != nil {
+		in.Grace = time.Duration(*req.GraceHours * float64(time.Hour))
+	}
+	out, err := u.Svc.CollectGarbage(in)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidGracePeriod) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
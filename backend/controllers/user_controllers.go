@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/PIPAT-I/G10-SA/services"
+	"github.com/gin-gonic/gin"
+)
+
+type UserController struct{ Svc *services.UserService }
+
+// ขนาดไฟล์ CSV สูงสุดที่รับสำหรับ import
+const maxUserImportBytes = 5 << 20
+
+type createUserReq struct {
+	UserID           string `json:"user_id" binding:"required"`
+	Password         string `json:"password" binding:"required"`
+	Firstname        string `json:"firstname" binding:"required"`
+	Lastname         string `json:"lastname" binding:"required"`
+	Email            string `json:"email" binding:"required"`
+	PhoneNumber      string `json:"phone_number"`
+	RoleID           uint   `json:"role_id"`
+	BorrowingLimitID uint   `json:"borrowing_limit_id"`
+}
+
+type updateUserReq struct {
+	Firstname        *string `json:"firstname"`
+	Lastname         *string `json:"lastname"`
+	Email            *string `json:"email"`
+	PhoneNumber      *string `json:"phone_number"`
+	Password         *string `json:"password"`
+	RoleID           *uint   `json:"role_id"`
+	BorrowingLimitID *uint   `json:"borrowing_limit_id"`
+}
+
+type setRoleReq struct {
+	RoleID uint `json:"role_id" binding:"required"`
+}
+
+// userErrorStatus แปลง error ของ UserService เป็น HTTP status
+func userErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, services.ErrRoleNotFound),
+		errors.Is(err, services.ErrLimitNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidUserID),
+		errors.Is(err, services.ErrInvalidEmail),
+		errors.Is(err, services.ErrWeakPassword),
+		errors.Is(err, services.ErrImportHeader),
+		errors.Is(err, services.ErrImportEmpty),
+		errors.Is(err, services.ErrImportTooLarge),
+		errors.Is(err, services.ErrImportPasswordMode):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrUserIDTaken),
+		errors.Is(err, services.ErrEmailTaken),
+		errors.Is(err, services.ErrLastAdmin),
+		errors.Is(err, services.ErrUserHasActiveBorrows):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GET /admin/users  (รองรับ ?q=  ?role_id=  ?disabled=true|false  ?page=  ?page_size=)
+func (u *UserController) FindUsers(c *gin.Context) {
+	page, pageSize := pageParams(c)
+	in := services.ListUsersInput{Q: c.Query("q"), Page: page, PageSize: pageSize}
+	if v := c.Query("role_id"); v != "" {
+		if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+			in.RoleID = uint(n)
+		}
+	}
+	if v := c.Query("disabled"); v != "" {
+		disabled := v == "true"
+		in.Disabled = &disabled
+	}
+
+	out, err := u.Svc.List(in)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GET /admin/users/:userId
+func (u *UserController) FindUserById(c *gin.Context) {
+	out, err := u.Svc.Get(c.Param("userId"))
+	if err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// POST /admin/users
+func (u *UserController) CreateUser(c *gin.Context) {
+	var in createUserReq
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	out, err := u.Svc.Create(services.CreateUserInput{
+		UserID:           in.UserID,
+		Password:         in.Password,
+		Firstname:        in.Firstname,
+		Lastname:         in.Lastname,
+		Email:            in.Email,
+		PhoneNumber:      in.PhoneNumber,
+		RoleID:           in.RoleID,
+		BorrowingLimitID: in.BorrowingLimitID,
+	})
+	if err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, out)
+}
+
+// PUT /admin/users/:userId
+func (u *UserController) UpdateUser(c *gin.Context) {
+	var in updateUserReq
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	out, err := u.Svc.Update(c.Param("userId"), services.UpdateUserInput{
+		Firstname:        in.Firstname,
+		Lastname:         in.Lastname,
+		Email:            in.Email,
+		PhoneNumber:      in.PhoneNumber,
+		Password:         in.Password,
+		RoleID:           in.RoleID,
+		BorrowingLimitID: in.BorrowingLimitID,
+	})
+	if err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// PUT /admin/users/:userId/role
+func (u *UserController) UpdateUserRole(c *gin.Context) {
+	var in setRoleReq
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	out, err := u.Svc.SetRole(c.Param("userId"), in.RoleID)
+	if err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// POST /admin/users/:userId/disable
+func (u *UserController) DisableUser(c *gin.Context) {
+	out, err := u.Svc.SetDisabled(c.Param("userId"), true)
+	if err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// POST /admin/users/:userId/enable
+func (u *UserController) EnableUser(c *gin.Context) {
+	out, err := u.Svc.SetDisabled(c.Param("userId"), false)
+	if err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// DELETE /admin/users/:userId
+func (u *UserController) DeleteUser(c *gin.Context) {
+	if err := u.Svc.Delete(c.Param("userId")); err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// POST /admin/users/import  (multipart: file หรือ body เป็น text/csv)
+// ?mode=commit เพื่อสร้างจริง (ค่าเริ่มต้นคือ dry-run)  ?password_mode=otp|reset
+func (u *UserController) ImportUsers(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUserImportBytes)
+
+	var r io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+		r = f
+	}
+
+	out, err := u.Svc.Import(r, services.ImportUsersInput{
+		DryRun:       c.Query("mode") != "commit",
+		PasswordMode: c.Query("password_mode"),
+	})
+	if errors.Is(err, services.ErrImportHasErrors) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "result": out})
+		return
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "csv file is too large"})
+			return
+		}
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if out.DryRun {
+		c.JSON(http.StatusOK, out)
+		return
+	}
+	c.JSON(http.StatusCreated, out)
+}
+
+// GET /admin/roles
+func (u *UserController) FindRoles(c *gin.Context) {
+	items, err := u.Svc.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
@@ -0,0 +1,22 @@
+package entity
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AuthSession การเข้าสู่ระบบหนึ่งครั้ง (หนึ่งอุปกรณ์) access token ทุกใบอ้างถึง SessionID ผ่าน claim "sid"
+type AuthSession struct {
+	gorm.Model
+	SessionID    string     `gorm:"uniqueIndex;not null" json:"session_id"`
+	UserID       string     `gorm:"index;not null" json:"user_id"`
+	User         *User      `gorm:"foreignKey:UserID;references:UserID" json:"-"`
+	UserAgent    string     `json:"user_agent"`
+	IPAddress    string     `json:"ip_address"`
+	LastUsedAt   time.Time  `json:"last_used_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	RevokeReason string     `json:"revoke_reason"`
+
+	RefreshTokens []RefreshToken `gorm:"foreignKey:SessionID;references:SessionID" json:"-"`
+}
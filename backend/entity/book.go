@@ -10,7 +10,12 @@ type Book struct {
 	TotalPage       uint   `gorm:"not null" json:"total_page"`
 	Synopsis        string `gorm:"type:text" json:"synopsis"`
 	Isbn            string `gorm:"unique;not null" json:"isbn"`
+	// CoverImage / EbookFile เป็น key ของไฟล์ใน Storage เช่น covers/x.jpg, ebooks/x.epub (ปกอาจเป็น URL ภายนอกได้)
 	CoverImage      string `json:"cover_image"`
+	// ภาพย่อของปก (JPEG) สร้างอัตโนมัติจาก CoverImage
+	CoverSmall      string `json:"cover_small"`
+	CoverMedium     string `json:"cover_medium"`
+	CoverLarge      string `json:"cover_large"`
 	EbookFile       string `json:"ebook_file"`
 	PublishedYear   uint   `gorm:"not null" json:"published_year"`
 
@@ -1,6 +1,8 @@
 package entity
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -12,6 +14,12 @@ type BookLicense struct {
     BookStatusID  uint        `gorm:"not null" json:"book_status_id"`
     BookStatus    *BookStatus `gorm:"foreignKey:BookStatusID" json:"book_status"`
 
+    // รูปแบบ license: perpetual (ใช้ได้ตลอด), time_limited (ถึง ExpiresAt), metered (ยืมได้ MaxCheckouts ครั้ง อาจมี ExpiresAt ด้วย)
+    LicenseModel  string     `gorm:"not null;default:perpetual" json:"license_model"`
+    ExpiresAt     *time.Time `json:"expires_at"`
+    MaxCheckouts  *uint      `json:"max_checkouts"`
+    CheckoutCount uint       `gorm:"not null;default:0" json:"checkout_count"`
+
     // Back-reference for borrows of this specific license
     Borrows        []Borrow   `gorm:"foreignKey:BookLicenseID" json:"borrows"`
 }
@@ -14,8 +14,9 @@ type Borrow struct {
     UserID     string     `gorm:"not null" json:"user_id"`
     User       *User      `gorm:"foreignKey:UserID;references:UserID" json:"user"`
     // Borrow now ties to a specific license (copy) of a book
+    // (no foreignKey tag: BookLicense has its own BookLicenseID field, which makes GORM guess has-one)
     BookLicenseID uint         `gorm:"not null" json:"book_license_id"`
-    BookLicense   *BookLicense `gorm:"foreignKey:BookLicenseID;references:ID" json:"book_license"`
+    BookLicense   *BookLicense `json:"book_license"`
 
     // Relationships
     ReadingActivities []ReadingActivity `gorm:"foreignKey:BorrowID" json:"reading_activities"`
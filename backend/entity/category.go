@@ -8,8 +8,13 @@ type Category struct {
 	CategoryCode string `gorm:"not null;unique" json:"category_code"`
 	Description  string `gorm:"type:text" json:"description"`
 
+	// หมวดหมู่แม่ (nil = หมวดหมู่ระดับบนสุด)
+	ParentID *uint      `gorm:"index" json:"parent_id"`
+	Parent   *Category  `gorm:"foreignKey:ParentID" json:"parent,omitempty"`
+	Children []Category `gorm:"foreignKey:ParentID" json:"children,omitempty"`
+
 	UserID string `gorm:"not null" json:"user_id"`
-	User   User   `gorm:"foreignKey:UserID;references:UserID" json:"user"`
+	User   *User  `gorm:"foreignKey:UserID;references:UserID" json:"user"`
 
 	// ความสัมพันธ์ 1-1 กับ CategoryStatics
 	CategoryStaticsID *uint              `gorm:"uniqueIndex" json:"category_statics_id"`
@@ -7,8 +7,9 @@ import (
 
 type CategoryStatics struct {
     gorm.Model
-    BookCount  int       `json:"book_count"`
-    LastUpdate time.Time `json:"last_update"`
+    BookCount        int       `json:"book_count"`         // หนังสือที่อยู่ในหมวดนี้โดยตรง
+    SubtreeBookCount int       `json:"subtree_book_count"` // รวมหมวดย่อยทุกระดับ (หนังสือเล่มเดียวกันนับครั้งเดียว)
+    LastUpdate       time.Time `json:"last_update"`
 
     // back-reference: บอกว่า FK อยู่ที่ Category.CategoryStaticsID
     Category *Category `gorm:"foreignKey:CategoryStaticsID" json:"category"`
@@ -0,0 +1,16 @@
+package entity
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PasswordResetToken token สำหรับตั้งรหัสผ่านใหม่ เก็บเฉพาะ hash และใช้ได้ครั้งเดียว
+type PasswordResetToken struct {
+	gorm.Model
+	TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	UserID    string     `gorm:"index;not null" json:"user_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
@@ -0,0 +1,17 @@
+package entity
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken เก็บเฉพาะ hash ของ token; ใช้ได้ครั้งเดียว (UsedAt != nil คือถูกหมุนไปแล้ว)
+type RefreshToken struct {
+	gorm.Model
+	TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	SessionID string     `gorm:"index;not null" json:"session_id"`
+	UserID    string     `gorm:"index;not null" json:"user_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
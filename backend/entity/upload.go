@@ -0,0 +1,31 @@
+package entity
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Upload ไฟล์หนึ่งไฟล์ในที่เก็บไฟล์ ใช้ติดตามว่ามีระเบียนใดอ้างถึงอยู่ เพื่อเก็บกวาดไฟล์ที่ไม่มีใครใช้แล้ว
+type Upload struct {
+	gorm.Model
+	// Store ที่เก็บไฟล์: storage (config.Storage ปก/e-book) หรือ static (ไฟล์สาธารณะใต้ ./static เช่นรูปโปรไฟล์)
+	Store       string `gorm:"not null;uniqueIndex:idx_upload_store_key" json:"store"`
+	Key         string `gorm:"not null;uniqueIndex:idx_upload_store_key" json:"key"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	UploadedBy  string `json:"uploaded_by"`
+	// OrphanedAt เวลาที่เริ่มไม่มีระเบียนใดอ้างถึง (nil = ยังถูกใช้อยู่)
+	OrphanedAt *time.Time `gorm:"index" json:"orphaned_at"`
+
+	References []UploadReference `gorm:"foreignKey:UploadID" json:"references,omitempty"`
+}
+
+// UploadReference ระเบียนที่อ้างถึงไฟล์: OwnerType/OwnerID คือตารางและ id เจ้าของ Field คือคอลัมน์ที่เก็บ key
+type UploadReference struct {
+	ID        uint   `gorm:"primarykey" json:"id"`
+	UploadID  uint   `gorm:"not null;index" json:"upload_id"`
+	OwnerType string `gorm:"not null;uniqueIndex:idx_upload_ref_owner" json:"owner_type"`
+	OwnerID   uint   `gorm:"not null;uniqueIndex:idx_upload_ref_owner" json:"owner_id"`
+	Field     string `gorm:"not null;uniqueIndex:idx_upload_ref_owner" json:"field"`
+}
@@ -19,6 +19,11 @@ type User struct {
 	Role			*Role            `gorm:"foreignKey:RoleID" json:"role"`
 	Profile		*Profile         `gorm:"foreignKey:UserID;references:UserID" json:"profile"`
 
+	// ถูกปิดบัญชีโดย admin (nil = ใช้งานได้)
+	DisabledAt *time.Time `json:"disabled_at"`
+	// ต้องตั้งรหัสผ่านใหม่ก่อนใช้งาน (บัญชีที่ import หรือได้รหัสผ่านชั่วคราว)
+	MustChangePassword bool `gorm:"default:false" json:"must_change_password"`
+
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 
@@ -8,13 +8,7 @@ require (
 	github.com/gin-gonic/gin v1.10.1
 	github.com/golang-jwt/jwt/v5 v5.3.0
 	golang.org/x/crypto v0.41.0
-	gorm.io/driver/sqlite v1.6.0
-	gorm.io/gorm v1.30.1
-)
-
-require (
-	github.com/gin-gonic/gin v1.10.1
-	golang.org/x/crypto v0.41.0
+	golang.org/x/image v0.25.0
 	gorm.io/driver/sqlite v1.6.0
 	gorm.io/gorm v1.30.2
 )
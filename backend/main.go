@@ -1,6 +1,11 @@
 package main
 
 import (
+	"context"
+	"log"
+	"os"
+	"strings"
+
 	"github.com/gin-gonic/gin"
 
 	"github.com/PIPAT-I/G10-SA/config"
@@ -17,13 +22,95 @@ func main() {
 	config.SetupDatabase()
 
 	//  สร้าง Services
-	authSvc := &services.AuthService{DB: config.DB()}
+	authSvc := &services.AuthService{DB: config.DB(), Throttle: &services.LoginThrottle{}}
 	authCtl := &controllers.AuthController{Svc: authSvc}
+	accountSvc := &services.AccountService{
+		DB:       config.DB(),
+		Sender:   services.LogSender{},
+		ResetURL: os.Getenv("PASSWORD_RESET_URL"),
+		// ขอลืมรหัสผ่านได้ 5 ครั้งต่อ 15 นาที ทั้งต่อบัญชีปลายทางและต่อ IP
+		ResetThrottle: &services.LoginThrottle{},
+	}
+	accountCtl := &controllers.AccountController{Svc: accountSvc}
+	notificationHub := &services.Hub{}
+	notificationSvc := &services.NotificationService{DB: config.DB(), Hub: notificationHub}
+	if err := notificationSvc.RegisterCallbacks(); err != nil {
+		log.Fatal("register notification callbacks: ", err)
+	}
+	notificationCtl := &controllers.NotificationController{Svc: notificationSvc}
+	borrowSvc := &services.BorrowService{DB: config.DB(), Notifications: notificationSvc}
+	borrowCtl := &controllers.BorrowController{Svc: borrowSvc}
+	reservationSvc := &services.ReservationService{DB: config.DB(), Notifications: notificationSvc}
+	reservationCtl := &controllers.ReservationController{Svc: reservationSvc}
+	userSvc := &services.UserService{DB: config.DB(), Notifications: notificationSvc, Accounts: accountSvc}
+	userCtl := &controllers.UserController{Svc: userSvc}
+	// ค้นหาด้วย LIKE เมื่อไม่มี FTS5 ต้องเปิดเองอย่างชัดเจน (build ปกติใช้ -tags sqlite_fts5 ดู Makefile)
+	catalogSvc := &services.CatalogService{DB: config.DB(), AllowLikeSearch: os.Getenv("CATALOG_SEARCH_FALLBACK") == "like"}
+	if err := catalogSvc.EnsureSearchIndex(); err != nil {
+		log.Fatal("build catalog search index: ", err)
+	}
+	catalogCtl := &controllers.CatalogController{Svc: catalogSvc}
+	categorySvc := &services.CategoryService{DB: config.DB()}
+	if err := categorySvc.RecountAll(); err != nil {
+		log.Fatal("recount category statics: ", err)
+	}
+	categoryCtl := &controllers.CategoryController{Svc: categorySvc}
+	licenseSvc := &services.LicenseService{DB: config.DB(), Notifications: notificationSvc}
+	licenseCtl := &controllers.LicenseController{Svc: licenseSvc}
+	downloadSecret := os.Getenv("DOWNLOAD_URL_SECRET")
+	if downloadSecret == "" {
+		downloadSecret = os.Getenv("JWT_SECRET")
+	}
+	if downloadSecret == "" {
+		downloadSecret = "CHANGE_ME_DEV_ONLY"
+	}
+	config.ConnectStorage([]byte(downloadSecret))
+	if err := services.MigrateFilesToStorage(config.DB(), config.Storage(), "static", services.DefaultStorageDir); err != nil {
+		log.Fatal("move uploads into storage: ", err)
+	}
+	coverSvc := &services.CoverService{DB: config.DB(), Store: config.Storage()}
+	if err := coverSvc.Backfill(); err != nil {
+		log.Fatal("generate cover thumbnails: ", err)
+	}
+	coverCtl := &controllers.CoverController{Svc: coverSvc}
+	ebookSvc := &services.EbookDeliveryService{DB: config.DB(), Store: config.Storage(), Secret: []byte(downloadSecret)}
+	bookDraftSvc := &services.BookDraftService{DB: config.DB(), Store: config.Storage()}
+	ebookCtl := &controllers.EbookController{Svc: ebookSvc, Drafts: bookDraftSvc}
+	oaiSvc := &services.OAIService{
+		DB:                   config.DB(),
+		RepositoryName:       os.Getenv("OAI_REPOSITORY_NAME"),
+		RepositoryIdentifier: os.Getenv("OAI_REPOSITORY_ID"),
+	}
+	if v := os.Getenv("OAI_ADMIN_EMAIL"); v != "" {
+		oaiSvc.AdminEmails = strings.Split(v, ",")
+	}
+	oaiCtl := &controllers.OAIController{Svc: oaiSvc, BaseURL: os.Getenv("OAI_BASE_URL")}
+	opdsCtl := &controllers.OPDSController{
+		Svc:     &services.OPDSService{DB: config.DB(), Catalog: catalogSvc, Title: os.Getenv("OAI_REPOSITORY_NAME")},
+		Borrows: borrowSvc,
+		Ebooks:  ebookSvc,
+		BaseURL: os.Getenv("OPDS_BASE_URL"),
+	}
+	catalogTransferCtl := &controllers.CatalogTransferController{Svc: &services.CatalogTransferService{DB: config.DB(), Store: config.Storage()}}
+	uploadSvc := &services.UploadService{DB: config.DB(), Store: config.Storage(), Public: &services.LocalStorage{Root: "static"}}
+	uploadCtl := &controllers.UploadController{Svc: uploadSvc}
+
+	// งานเบื้องหลัง: คืน e-book ที่เลยกำหนด, ปิดการจองที่หมดเวลา, แจ้งเตือนใกล้ครบกำหนด
+	scheduler := &services.Scheduler{DB: config.DB(), Notifications: notificationSvc}
+	go scheduler.Start(context.Background())
 
 	r := gin.Default()
+	// ClientIP ใช้จำกัดการ login ต่อ IP จึงเชื่อ X-Forwarded-For เฉพาะจาก proxy ที่ระบุใน TRUSTED_PROXIES (คั่นด้วย ,)
+	var proxies []string
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		proxies = strings.Split(v, ",")
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		log.Fatal("TRUSTED_PROXIES: ", err)
+	}
 	r.Use(CORSMiddleware())
 
-	// เสิร์ฟไฟล์สาธารณะ (ภาพปก/อีบุ๊ก)
+	// เสิร์ฟไฟล์สาธารณะ (รูปโปรไฟล์) ส่วนปกและ e-book อยู่ใน config.Storage()
 	r.Static("/static", "./static")
 
 	//  API Routes
@@ -34,12 +121,54 @@ func main() {
 		// Authentication
 		auth := api.Group("/auth")
 		auth.POST("/login", authCtl.Login)
+		auth.POST("/refresh", authCtl.Refresh)
+		auth.POST("/logout", authCtl.Logout)
+		auth.POST("/password/forgot", accountCtl.ForgotPassword)
+		auth.POST("/password/reset", accountCtl.ResetPassword)
+
+		// Catalog (อ่านอย่างเดียว)
+		catalog := api.Group("/catalog")
+		catalog.GET("/books", catalogCtl.FindBooks)
+		catalog.GET("/books/:id", controllers.FindBookById)
+		catalog.GET("/books/:id/categories", categoryCtl.FindBookCategories)
+		catalog.GET("/books/:id/availability", licenseCtl.FindAvailability)
+		catalog.GET("/books/:id/cover", coverCtl.FindBookCover)
+		catalog.GET("/books/:id/dc", oaiCtl.FindBookDublinCore)
+		catalog.GET("/categories", categoryCtl.FindCategories)
+		catalog.GET("/categories/tree", categoryCtl.FindCategoryTree)
+		catalog.GET("/categories/:id", categoryCtl.FindCategoryById)
+		catalog.GET("/categories/:id/books", catalogCtl.FindCategoryBooks)
+		catalog.GET("/authors", controllers.FindAuthors)
+		catalog.GET("/languages", controllers.FindLanguages)
+		catalog.GET("/publishers", controllers.FindPublishers)
+		catalog.GET("/search", catalogCtl.SearchBooks)
+
+		// ดาวน์โหลด e-book ด้วยลิงก์ลงลายเซ็นจาก /user/books/:id/download
+		api.GET("/download/ebooks/:id", ebookCtl.Download)
+		// ไฟล์ใน local storage ผ่าน signed URL (backend s3 ให้ URL ของ bucket แทน)
+		if local, ok := config.Storage().(*services.LocalStorage); ok {
+			fileCtl := &controllers.FileController{Store: local}
+			api.GET("/files/*key", fileCtl.ServeFile)
+		}
+
+		// SSE ของการแจ้งเตือน ยืนยันตัวตนด้วย ticket จาก /user/notifications/stream-ticket
+		api.GET("/user/notifications/stream", notificationCtl.Stream)
+
+		// OAI-PMH ให้ห้องสมุดอื่นเก็บเกี่ยวแค็ตตาล็อก (Dublin Core)
+		api.GET("/oai", oaiCtl.Handle)
+		api.POST("/oai", oaiCtl.Handle)
 	}
 
 	/*  USER ROUTES - ต้อง Login เป็น User */
 	user := api.Group("/user")
 	user.Use(middlewares.AuthRequired())
 	{
+		//  My Account
+		user.GET("/me", accountCtl.GetMe)
+		user.PUT("/me", accountCtl.UpdateMe)
+		user.POST("/me/avatar", accountCtl.UploadAvatar)
+		user.PUT("/me/password", accountCtl.ChangePassword)
+
 		//  User Book Activities
 		user.POST("/reading-activities", controllers.CreateReadingActivity)
 		user.GET("/reading-activities", controllers.FindReadingActivities)
@@ -47,6 +176,45 @@ func main() {
 		user.PUT("/reading-activities/:id", controllers.UpdateReadingActivity)
 		user.DELETE("/reading-activities/:id", controllers.DeleteReadingActivityById)
 
+		//  Borrowing
+		user.POST("/borrows", borrowCtl.Checkout)
+		user.GET("/borrows", borrowCtl.FindMyBorrows)
+		user.GET("/borrows/:id", borrowCtl.FindMyBorrowById)
+		user.POST("/borrows/:id/return", borrowCtl.Return)
+		user.GET("/books/:id/download", ebookCtl.DownloadLink)
+
+		//  Reservations
+		user.POST("/reservations", reservationCtl.Reserve)
+		user.GET("/reservations", reservationCtl.FindMyReservations)
+		user.GET("/reservations/:id", reservationCtl.FindMyReservationById)
+		user.POST("/reservations/:id/cancel", reservationCtl.Cancel)
+
+		//  Notifications
+		user.GET("/notifications", notificationCtl.FindMyNotifications)
+		user.GET("/notifications/unread-count", notificationCtl.UnreadCount)
+		user.POST("/notifications/stream-ticket", notificationCtl.StreamTicket)
+		user.PUT("/notifications/read-all", notificationCtl.MarkAllRead)
+		user.PUT("/notifications/:id/read", notificationCtl.MarkRead)
+		user.DELETE("/notifications/:id", notificationCtl.Delete)
+
+	}
+
+	/*  OPDS - แค็ตตาล็อกสำหรับแอปอ่าน e-book (Login ด้วย JWT หรือ HTTP Basic) */
+	opds := api.Group("/opds")
+	opds.Use(middlewares.AuthRequiredOrBasic(authSvc, "E-book library"))
+	{
+		opds.GET("", opdsCtl.Root)
+		opds.GET("/opensearch.xml", opdsCtl.OpenSearch)
+		opds.GET("/search", opdsCtl.Search)
+		opds.GET("/new", opdsCtl.NewBooks)
+		opds.GET("/shelf", opdsCtl.Shelf)
+		opds.GET("/categories", opdsCtl.Categories)
+		opds.GET("/categories/:id", opdsCtl.Category)
+		opds.GET("/categories/:id/books", opdsCtl.CategoryBooks)
+		opds.GET("/authors", opdsCtl.Authors)
+		opds.GET("/authors/:id/books", opdsCtl.AuthorBooks)
+		opds.GET("/books/:id/borrow", opdsCtl.Borrow)
+		opds.GET("/books/:id/download", opdsCtl.Download)
 	}
 
 	/*  ADMIN ROUTES - ต้อง Login เป็น Admin */
@@ -59,6 +227,22 @@ func main() {
 		admin.DELETE("/books/:id", controllers.DeleteBookById)
 		admin.POST("/books/:id/authors", controllers.AddAuthorToBook)
 		admin.DELETE("/books/:id/authors/:authorId", controllers.RemoveAuthorFromBook)
+		admin.GET("/books/:id/reservations", reservationCtl.FindBookQueue)
+		admin.POST("/books/:id/categories", categoryCtl.AttachCategories)
+		admin.PUT("/books/:id/categories", categoryCtl.SetBookCategories)
+		admin.DELETE("/books/:id/categories/:categoryId", categoryCtl.DetachCategory)
+
+		//  License (Copy) Inventory
+		admin.GET("/books/:id/licenses", licenseCtl.FindLicenses)
+		admin.POST("/books/:id/licenses", licenseCtl.AddLicenses)
+		admin.POST("/books/:id/licenses/retire", licenseCtl.RetireLicenses)
+		admin.PUT("/books/:id/licenses/:licenseId/status", licenseCtl.SetLicenseStatus)
+		admin.GET("/licenses/expiring", licenseCtl.FindExpiringLicenses)
+
+		//  Category Management
+		admin.POST("/categories", categoryCtl.CreateCategory)
+		admin.PUT("/categories/:id", categoryCtl.UpdateCategory)
+		admin.DELETE("/categories/:id", categoryCtl.DeleteCategory)
 
 		//  Author Management
 		admin.POST("/authors", controllers.CreateAuthor)
@@ -82,7 +266,28 @@ func main() {
 
 		//  File Uploads
 		admin.POST("/uploads/cover", controllers.UploadCover)
-		admin.POST("/uploads/ebook", controllers.UploadEbook)
+		admin.POST("/uploads/ebook", ebookCtl.UploadEbook)
+		admin.POST("/uploads/gc", uploadCtl.CollectGarbage)
+
+		//  Catalog Import / Export
+		admin.POST("/catalog/import", catalogTransferCtl.ImportCatalog)
+		admin.GET("/catalog/export", catalogTransferCtl.ExportCatalog)
+
+		//  Borrowing Limits
+		admin.GET("/borrowing-limits", borrowCtl.FindBorrowingLimits)
+		admin.PUT("/users/:userId/borrowing-limit", borrowCtl.UpdateUserBorrowingLimit)
+
+		//  User Management
+		admin.GET("/roles", userCtl.FindRoles)
+		admin.GET("/users", userCtl.FindUsers)
+		admin.POST("/users", userCtl.CreateUser)
+		admin.POST("/users/import", userCtl.ImportUsers)
+		admin.GET("/users/:userId", userCtl.FindUserById)
+		admin.PUT("/users/:userId", userCtl.UpdateUser)
+		admin.DELETE("/users/:userId", userCtl.DeleteUser)
+		admin.PUT("/users/:userId/role", userCtl.UpdateUserRole)
+		admin.POST("/users/:userId/disable", userCtl.DisableUser)
+		admin.POST("/users/:userId/enable", userCtl.EnableUser)
 	}
 
 	r.Run(":" + PORT)
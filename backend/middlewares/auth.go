@@ -1,11 +1,17 @@
 package middlewares
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 
+	"github.com/PIPAT-I/G10-SA/config"
+	"github.com/PIPAT-I/G10-SA/services"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -17,27 +23,130 @@ func AuthRequired() gin.HandlerFunc {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
 			return
 		}
-		tokenStr := strings.TrimPrefix(h, "Bearer ")
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" { secret = "CHANGE_ME_DEV_ONLY" }
+		if msg := verifyAccessToken(c, strings.TrimPrefix(h, "Bearer ")); msg != "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": msg})
+			return
+		}
+		if abortIfPasswordChangeRequired(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// passwordChangeRoutes route ที่ผู้ใช้ซึ่งต้องเปลี่ยนรหัสผ่าน (User.MustChangePassword) ยังเรียกได้
+// /auth/refresh และ /auth/logout ไม่ผ่าน AuthRequired จึงใช้ได้อยู่แล้ว
+var passwordChangeRoutes = map[string]bool{
+	"PUT /api/user/me/password": true,
+}
 
-		tok, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("bad signing method")
+// abortIfPasswordChangeRequired ตอบ 403 ถ้าผู้ใช้ที่ยืนยันตัวตนแล้วยังต้องเปลี่ยนรหัสผ่านและ route นี้ไม่อยู่ใน passwordChangeRoutes
+func abortIfPasswordChangeRequired(c *gin.Context) bool {
+	if passwordChangeRoutes[c.Request.Method+" "+c.FullPath()] || !services.MustChangePassword(config.DB(), c.GetString("userID")) {
+		return false
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "password change required", "must_change_password": true})
+	return true
+}
+
+// verifyAccessToken ตรวจ JWT และ session แล้วใส่ข้อมูลผู้ใช้ลง context คืนข้อความ error ถ้าไม่ผ่าน
+func verifyAccessToken(c *gin.Context, tokenStr string) string {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" { secret = "CHANGE_ME_DEV_ONLY" }
+
+	tok, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("bad signing method")
+		}
+		return []byte(secret), nil
+	})
+	if err != nil || !tok.Valid {
+		return "invalid token"
+	}
+	claims := tok.Claims.(jwt.MapClaims)
+	// token ที่ session ถูกเพิกถอนแล้ว (logout, เปลี่ยนรหัสผ่าน, ปิดบัญชี) ใช้ไม่ได้แม้ยังไม่หมดอายุ
+	sub, _ := claims["sub"].(string)
+	sid, _ := claims["sid"].(string)
+	if !services.SessionActive(config.DB(), sub, sid) {
+		return "session revoked"
+	}
+	c.Set("userID", claims["sub"])
+	c.Set("role",   claims["role"])
+	c.Set("sessionID", sid)
+	return ""
+}
+
+// AuthRequiredOrBasic เหมือน AuthRequired แต่รับ HTTP Basic (email/user_id + รหัสผ่าน) ได้ด้วย
+// สำหรับแอปอ่าน e-book ที่ไม่รองรับการ login แบบ JWT ถ้าไม่ผ่านจะตอบ WWW-Authenticate ให้แอปถามรหัสผ่าน
+func AuthRequiredOrBasic(auth *services.AuthService, realm string) gin.HandlerFunc {
+	challenge := fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, realm)
+	return func(c *gin.Context) {
+		h := c.GetHeader("Authorization")
+		msg := "missing credentials"
+		switch {
+		case strings.HasPrefix(h, "Bearer "):
+			msg = verifyAccessToken(c, strings.TrimPrefix(h, "Bearer "))
+		case strings.HasPrefix(h, "Basic "):
+			// เบราว์เซอร์แนบ Basic ที่จำไว้ไปกับทุกคำขอ แม้มาจากเว็บอื่น (เช่นลิงก์ยืมแบบ GET) จึงรับเฉพาะคำขอที่ไม่ได้มาจาก origin อื่น
+			if crossSiteRequest(c) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "basic auth is not accepted from cross-site requests"})
+				return
+			}
+			id, password, ok := c.Request.BasicAuth()
+			if !ok {
+				msg = "invalid basic credentials"
+				break
 			}
-			return []byte(secret), nil
-		})
-		if err != nil || !tok.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			u, err := auth.Authenticate(id, password, c.ClientIP())
+			if errors.Is(err, services.ErrTooManyAttempts) {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(auth.RetryAfter(id, c.ClientIP()).Seconds()))))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				msg = err.Error()
+				break
+			}
+			role := ""
+			if u.Role != nil {
+				role = u.Role.Name
+			}
+			c.Set("userID", u.UserID)
+			c.Set("role", role)
+			msg = ""
+		}
+		if msg != "" {
+			c.Header("WWW-Authenticate", challenge)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": msg})
+			return
+		}
+		if abortIfPasswordChangeRequired(c) {
 			return
 		}
-		claims := tok.Claims.(jwt.MapClaims)
-		c.Set("userID", claims["sub"])
-		c.Set("role",   claims["role"])
 		c.Next()
 	}
 }
 
+// crossSiteRequest คำขอที่เบราว์เซอร์ส่งมาจากหน้าเว็บของ origin อื่น
+// ดูจาก Sec-Fetch-Site ก่อน (หน้าเว็บปิดไม่ได้) แล้วจึงเทียบ host ของ Origin/Referer กับ host ของคำขอ
+// แอปอ่าน e-book ไม่ส่ง header เหล่านี้จึงไม่ถูกกระทบ
+func crossSiteRequest(c *gin.Context) bool {
+	if site := c.GetHeader("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+		return true
+	}
+	for _, h := range []string{"Origin", "Referer"} {
+		v := c.GetHeader(h)
+		if v == "" {
+			continue
+		}
+		u, err := url.Parse(v)
+		if err != nil || !strings.EqualFold(u.Host, c.Request.Host) {
+			return true
+		}
+	}
+	return false
+}
+
 func RequireRoles(roles ...string) gin.HandlerFunc {
 	allowed := map[string]struct{}{}
 	for _, r := range roles { allowed[r] = struct{}{} }
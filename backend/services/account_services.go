@@ -0,0 +1,303 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MinPasswordLength       = 6
+	DefaultPasswordResetTTL = 30 * time.Minute
+)
+
+var (
+	ErrWrongPassword     = errors.New("current password is incorrect")
+	ErrWeakPassword      = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	ErrSamePassword      = errors.New("new password must be different from the current one")
+	ErrEmailTaken        = errors.New("email is already in use")
+	ErrInvalidEmail      = errors.New("invalid email address")
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+)
+
+// AccountService ให้ผู้ใช้จัดการบัญชีของตัวเอง: ข้อมูลส่วนตัว รูปโปรไฟล์ และรหัสผ่าน
+// Sender ใช้ส่งลิงก์ตั้งรหัสผ่านใหม่ (nil = LogSender)
+// ResetURL หน้าเว็บสำหรับตั้งรหัสผ่านใหม่ ระบบจะต่อท้ายด้วย ?token=...
+type AccountService struct {
+	DB       *gorm.DB
+	Sender   MessageSender
+	ResetURL string
+	ResetTTL time.Duration
+	// ResetThrottle จำกัดคำขอลืมรหัสผ่านจากภายนอก ทั้งต่อ identifier และต่อ IP ของผู้ส่ง (nil = ไม่จำกัด)
+	ResetThrottle *LoginThrottle
+}
+
+// UpdateMeInput ฟิลด์ที่เป็น nil จะไม่ถูกแก้ไข
+type UpdateMeInput struct {
+	Firstname   *string
+	Lastname    *string
+	Email       *string
+	PhoneNumber *string
+}
+
+func (s *AccountService) sender() MessageSender {
+	if s.Sender != nil {
+		return s.Sender
+	}
+	return LogSender{}
+}
+
+func (s *AccountService) resetTTL() time.Duration {
+	if s.ResetTTL > 0 {
+		return s.ResetTTL
+	}
+	return DefaultPasswordResetTTL
+}
+
+// hashPassword ตรวจความยาวขั้นต่ำแล้ว hash ด้วย bcrypt (cost เดียวกับ seed ใน config)
+func hashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrWeakPassword
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	if err != nil {
+		return "", err
+	}
+	return string(h), nil
+}
+
+// normalizeEmail ตัดช่องว่าง ตรวจรูปแบบ และแปลงเป็นตัวพิมพ์เล็ก
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(email), nil
+}
+
+// GetMe ข้อมูลของผู้ใช้ที่ login อยู่ พร้อม Role, BorrowingLimit และ Profile
+func (s *AccountService) GetMe(userID string) (*entity.User, error) {
+	var u entity.User
+	if err := s.DB.Preload("Role").Preload("BorrowingLimit").Preload("Profile").
+		Where("user_id = ?", userID).
+		First(&u).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+// UpdateMe แก้ไขข้อมูลส่วนตัว (role, borrowing limit และรหัสผ่านแก้ผ่านช่องทางอื่น)
+func (s *AccountService) UpdateMe(userID string, in UpdateMeInput) (*entity.User, error) {
+	updates := map[string]any{}
+	if in.Firstname != nil {
+		updates["firstname"] = strings.TrimSpace(*in.Firstname)
+	}
+	if in.Lastname != nil {
+		updates["lastname"] = strings.TrimSpace(*in.Lastname)
+	}
+	if in.PhoneNumber != nil {
+		updates["phone_number"] = strings.TrimSpace(*in.PhoneNumber)
+	}
+	if in.Email != nil {
+		email, err := normalizeEmail(*in.Email)
+		if err != nil {
+			return nil, err
+		}
+		if err := ensureEmailFree(s.DB, email, userID); err != nil {
+			return nil, err
+		}
+		updates["email"] = email
+	}
+
+	if len(updates) > 0 {
+		res := s.DB.Model(&entity.User{}).Where("user_id = ?", userID).Updates(updates)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			return nil, ErrUserNotFound
+		}
+	}
+	return s.GetMe(userID)
+}
+
+// SetAvatar บันทึก AvatarURL ลง Profile (สร้าง Profile ให้ถ้ายังไม่มี)
+func (s *AccountService) SetAvatar(userID, url string) (*entity.User, error) {
+	var p entity.Profile
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var n int64
+		if err := tx.Model(&entity.User{}).Where("user_id = ?", userID).Count(&n).Error; err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrUserNotFound
+		}
+		if err := tx.Where(entity.Profile{UserID: userID}).FirstOrInit(&p).Error; err != nil {
+			return err
+		}
+		p.AvatarURL = url
+		if err := tx.Omit(clause.Associations).Save(&p).Error; err != nil {
+			return err
+		}
+		return SyncUploadReferences(tx, UploadOwnerProfile, p.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetMe(userID)
+}
+
+// ChangePassword เปลี่ยนรหัสผ่านโดยยืนยันรหัสเดิม แล้วเพิกถอน session อื่นทั้งหมด
+// (session ปัจจุบัน keepSessionID ยังใช้งานต่อได้)
+func (s *AccountService) ChangePassword(userID, keepSessionID, oldPassword, newPassword string) error {
+	var u entity.User
+	if err := s.DB.Where("user_id = ?", userID).First(&u).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(oldPassword)); err != nil {
+		return ErrWrongPassword
+	}
+	if oldPassword == newPassword {
+		return ErrSamePassword
+	}
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.User{}).Where("user_id = ?", userID).
+			Updates(map[string]any{"password": hash, "must_change_password": false}).Error; err != nil {
+			return err
+		}
+		return RevokeUserSessions(tx, userID, RevokeReasonPasswordChange, keepSessionID)
+	})
+}
+
+// resetThrottleKeys key ของ ResetThrottle: นับต่อปลายทาง (กันส่งข้อความถล่มบัญชีเดียว) และต่อ IP (กันไล่ส่งหลายบัญชี)
+func resetThrottleKeys(identifier, clientIP string) []string {
+	return []string{ThrottleKey("identifier", identifier), ThrottleKey("ip", clientIP)}
+}
+
+// ResetRetryAfter เวลาที่ต้องรอก่อนขอลืมรหัสผ่านให้ identifier จาก clientIP ได้อีกครั้ง
+func (s *AccountService) ResetRetryAfter(identifier, clientIP string) time.Duration {
+	var wait time.Duration
+	for _, k := range resetThrottleKeys(identifier, clientIP) {
+		wait = max(wait, s.ResetThrottle.RetryAfter(k))
+	}
+	return wait
+}
+
+// RequestPasswordResetFrom RequestPasswordReset สำหรับคำขอจากภายนอก (POST /auth/password/forgot)
+// นับทุกคำขอไม่ว่าจะมีบัญชีหรือไม่ เกินที่ ResetThrottle กำหนดจะคืน ErrTooManyAttempts โดยไม่ออก token หรือส่งข้อความ
+func (s *AccountService) RequestPasswordResetFrom(identifier, clientIP string) error {
+	if s.ResetRetryAfter(identifier, clientIP) > 0 {
+		return ErrTooManyAttempts
+	}
+	for _, k := range resetThrottleKeys(identifier, clientIP) {
+		s.ResetThrottle.Fail(k)
+	}
+	return s.RequestPasswordReset(identifier)
+}
+
+// RequestPasswordReset ออก reset token แล้วส่งให้ผู้ใช้ทาง Sender
+// ถ้าไม่พบบัญชีจะคืน nil เหมือนกรณีสำเร็จ เพื่อไม่ให้ใช้ตรวจว่ามีอีเมล/รหัสผู้ใช้นี้ในระบบหรือไม่
+func (s *AccountService) RequestPasswordReset(identifier string) error {
+	identifier = strings.TrimSpace(identifier)
+	var u entity.User
+	q := s.DB
+	if strings.Contains(identifier, "@") {
+		q = q.Where("LOWER(email) = ?", strings.ToLower(identifier))
+	} else {
+		q = q.Where("user_id = ?", identifier)
+	}
+	if err := q.First(&u).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+	expires := time.Now().Add(s.resetTTL())
+	if err := s.DB.Create(&entity.PasswordResetToken{
+		TokenHash: hashToken(token),
+		UserID:    u.UserID,
+		ExpiresAt: expires,
+	}).Error; err != nil {
+		return err
+	}
+
+	link := token
+	if s.ResetURL != "" {
+		link = s.ResetURL + "?token=" + token
+	}
+	return s.sender().Send(OutgoingMessage{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nUse the following to set a new password (valid until %s):\n%s\n\nIf you did not request this, you can ignore this message.",
+			u.Firstname, expires.Format("2006-01-02 15:04"), link),
+	})
+}
+
+// ResetPassword ตั้งรหัสผ่านใหม่ด้วย reset token แล้วเพิกถอนทุก session ของผู้ใช้
+func (s *AccountService) ResetPassword(token, newPassword string) error {
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var rt entity.PasswordResetToken
+		if err := tx.Where("token_hash = ?", hashToken(token)).First(&rt).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+		now := time.Now()
+		if rt.UsedAt != nil || now.After(rt.ExpiresAt) {
+			return ErrInvalidResetToken
+		}
+
+		res := tx.Model(&entity.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", rt.ID).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		// token อื่นที่ยังไม่ได้ใช้ของผู้ใช้คนนี้ถือว่าหมดอายุไปด้วย
+		if err := tx.Model(&entity.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", rt.UserID).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&entity.User{}).Where("user_id = ?", rt.UserID).
+			Updates(map[string]any{"password": hash, "must_change_password": false}).Error; err != nil {
+			return err
+		}
+		return RevokeUserSessions(tx, rt.UserID, RevokeReasonPasswordChange, "")
+	})
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// recordingSender เก็บข้อความที่ถูกส่งไว้ตรวจในการทดสอบ
+type recordingSender struct{ sent []OutgoingMessage }
+
+func (r *recordingSender) Send(msg OutgoingMessage) error {
+	r.sent = append(r.sent, msg)
+	return nil
+}
+
+func newAccountTestService(t *testing.T) (*AccountService, *recordingSender) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&entity.User{}, &entity.PasswordResetToken{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"S001", "S002", "S003", "S004"} {
+		mustCreate(t, db, &entity.User{UserID: id, Password: "x", Firstname: id, Lastname: id, Email: id + "@example.com"})
+	}
+	sender := &recordingSender{}
+	return &AccountService{
+		DB:            db,
+		Sender:        sender,
+		ResetThrottle: &LoginThrottle{MaxFailures: 2, Window: time.Minute},
+	}, sender
+}
+
+func resetTokenCount(t *testing.T, s *AccountService) int64 {
+	t.Helper()
+	var n int64
+	if err := s.DB.Model(&entity.PasswordResetToken{}).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRequestPasswordResetFromThrottlesPerIdentifier(t *testing.T) {
+	s, sender := newAccountTestService(t)
+
+	// ส่งถึงบัญชีเดียวจากหลาย IP
+	for i := 1; i <= 2; i++ {
+		if err := s.RequestPasswordResetFrom("S001@example.com", fmt.Sprintf("203.0.113.%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.RequestPasswordResetFrom("s001@EXAMPLE.com", "203.0.113.3"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("err = %v, want ErrTooManyAttempts", err)
+	}
+	if len(sender.sent) != 2 || resetTokenCount(t, s) != 2 {
+		t.Errorf("sent %d messages, %d tokens; want 2 each", len(sender.sent), resetTokenCount(t, s))
+	}
+	if d := s.ResetRetryAfter("S001@example.com", "203.0.113.9"); d <= 0 {
+		t.Errorf("ResetRetryAfter = %v, want > 0", d)
+	}
+
+	// บัญชีอื่นจาก IP ใหม่ยังขอได้
+	if err := s.RequestPasswordResetFrom("S002", "198.51.100.7"); err != nil {
+		t.Errorf("other account err = %v", err)
+	}
+}
+
+func TestRequestPasswordResetFromThrottlesPerIP(t *testing.T) {
+	s, sender := newAccountTestService(t)
+	const ip = "203.0.113.9"
+
+	// IP เดียวไล่ขอหลายบัญชี รวมบัญชีที่ไม่มีอยู่จริง (ต้องนับเหมือนกันเพื่อไม่ให้ใช้ตรวจว่ามีบัญชีหรือไม่)
+	if err := s.RequestPasswordResetFrom("nobody@example.com", ip); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RequestPasswordResetFrom("S001", ip); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RequestPasswordResetFrom("S002", ip); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("err = %v, want ErrTooManyAttempts", err)
+	}
+	if len(sender.sent) != 1 {
+		t.Errorf("sent %d messages, want 1", len(sender.sent))
+	}
+
+	// การส่งจากระบบ (เช่นนำเข้าผู้ใช้) ไม่ถูกจำกัด
+	if err := s.RequestPasswordReset("S003"); err != nil {
+		t.Errorf("RequestPasswordReset err = %v", err)
+	}
+}
@@ -1,6 +1,10 @@
 package services
 
 import(
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"os"
 	"strings"
@@ -11,63 +15,333 @@ import(
 	"gorm.io/gorm"
 )
 
+// อายุเริ่มต้นของ token ถ้าไม่ได้กำหนดใน AuthService
+const (
+	DefaultAccessTokenTTL  = time.Hour
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// เหตุผลที่ session ถูกเพิกถอน (บันทึกไว้ใน AuthSession.RevokeReason)
+const (
+	RevokeReasonLogout         = "logout"
+	RevokeReasonRefreshReuse   = "refresh token reuse"
+	RevokeReasonPasswordChange = "password changed"
+	RevokeReasonUserDisabled   = "account disabled"
+	RevokeReasonRoleChanged    = "role changed"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token already used, session revoked")
+	ErrSessionRevoked      = errors.New("session has been revoked")
+	ErrAccountDisabled     = errors.New("account is disabled")
+)
+
 type AuthService struct {
-	DB *gorm.DB
+	DB         *gorm.DB
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	// Throttle จำกัดการใส่รหัสผ่านผิดต่อ identifier+IP ของผู้ส่ง (nil = ไม่จำกัด)
+	// นับแยกตาม IP เพื่อไม่ให้คนอื่นใส่รหัสผิดจนเจ้าของบัญชี login จากเครื่องตัวเองไม่ได้
+	Throttle *LoginThrottle
 }
 
 type LoginInput struct {
-	Identifier    string 
-	Password     string 
+	Identifier    string
+	Password     string
+	UserAgent    string
+	IPAddress    string
 }
 type LoginOutput struct {
-	Token string
-	User  entity.User
-	Role  string // ชื่อ role: "user" | "admin"
+	Token        string
+	RefreshToken string
+	ExpiresAt    time.Time // เวลาหมดอายุของ Token (access)
+	User         entity.User
+	Role         string // ชื่อ role: "user" | "admin"
+}
+
+// RefreshInput token ที่ได้จาก Login/Refresh ครั้งก่อน พร้อมข้อมูลอุปกรณ์
+type RefreshInput struct {
+	RefreshToken string
+	UserAgent    string
+	IPAddress    string
+}
+
+func (s *AuthService) accessTTL() time.Duration {
+	if s.AccessTTL > 0 {
+		return s.AccessTTL
+	}
+	return DefaultAccessTokenTTL
 }
 
+func (s *AuthService) refreshTTL() time.Duration {
+	if s.RefreshTTL > 0 {
+		return s.RefreshTTL
+	}
+	return DefaultRefreshTokenTTL
+}
 
-func issueJWT(userID, role string) (string, error) {
+func issueJWT(userID, role, sessionID string, exp time.Time) (string, error) {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
 		secret = "CHANGE_ME_DEV_ONLY"
-	}	
+	}
 	claims := jwt.MapClaims{
 		"sub":  userID,
 		"role": role,
+		"sid":  sessionID,
 		"iat":  time.Now().Unix(),
-		"exp":  time.Now().Add(24 * time.Hour).Unix(),
+		"exp":  exp.Unix(),
 	}
 	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
 }
 
+// randomToken สุ่มค่า 32 ไบต์ในรูป base64url (ใช้เป็น refresh token และ SessionID)
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken เก็บเฉพาะ SHA-256 ของ refresh token ในฐานข้อมูล
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+
+// Authenticate ตรวจ email/user_id และรหัสผ่าน โดยไม่สร้าง session
+// ใช้กับ Login และกับ HTTP Basic ของ client ที่ส่งรหัสผ่านมาทุกคำขอ (เช่นแอปอ่าน e-book ผ่าน OPDS)
+// ถ้าใส่ผิดจาก clientIP เดิมเกินที่ Throttle กำหนดจะคืน ErrTooManyAttempts โดยไม่ตรวจรหัสผ่าน
+func (s *AuthService) Authenticate(identifier, password, clientIP string) (*entity.User, error) {
+	key := ThrottleKey(identifier, clientIP)
+	if s.Throttle.RetryAfter(key) > 0 {
+		return nil, ErrTooManyAttempts
+	}
 
-func (s *AuthService) Login(in LoginInput) (*LoginOutput, error) {
 	var u entity.User
 	q := s.DB.Preload("Role")
 
-	if strings.Contains(in.Identifier, "@") {
-		if err := q.Where("email = ?", in.Identifier).First(&u).Error; err != nil {
+	if strings.Contains(identifier, "@") {
+		if err := q.Where("email = ?", identifier).First(&u).Error; err != nil {
+			s.Throttle.Fail(key)
 			return nil, errors.New("email or password incorrect")
 		}
 	} else {
-		if err := q.Where("user_id = ?", in.Identifier).First(&u).Error; err != nil {
+		if err := q.Where("user_id = ?", identifier).First(&u).Error; err != nil {
+			s.Throttle.Fail(key)
 			return nil, errors.New("userID or password incorrect")
 		}
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(in.Password)); err != nil {
+	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)); err != nil {
+		s.Throttle.Fail(key)
 		return nil, errors.New("email/userID or password incorrect")
 	}
+	s.Throttle.Reset(key)
+	if u.DisabledAt != nil {
+		return nil, ErrAccountDisabled
+	}
+	return &u, nil
+}
+
+// RetryAfter เวลาที่ identifier ต้องรอก่อน login จาก clientIP นี้ได้อีกครั้ง
+func (s *AuthService) RetryAfter(identifier, clientIP string) time.Duration {
+	return s.Throttle.RetryAfter(ThrottleKey(identifier, clientIP))
+}
+
+func (s *AuthService) Login(in LoginInput) (*LoginOutput, error) {
+	u, err := s.Authenticate(in.Identifier, in.Password, in.IPAddress)
+	if err != nil {
+		return nil, err
+	}
 
+	var out *LoginOutput
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		sessionID, err := randomToken()
+		if err != nil {
+			return err
+		}
+		sess := entity.AuthSession{
+			SessionID:  sessionID,
+			UserID:     u.UserID,
+			UserAgent:  in.UserAgent,
+			IPAddress:  in.IPAddress,
+			LastUsedAt: time.Now(),
+		}
+		if err := tx.Create(&sess).Error; err != nil {
+			return err
+		}
+		out, err = s.issueTokens(tx, u, sessionID)
+		return err
+	})
+	if err != nil {
+		return nil, errors.New("cannot issue token")
+	}
+	return out, nil
+}
+
+// issueTokens ออก access token และ refresh token ใบใหม่ให้ session
+func (s *AuthService) issueTokens(tx *gorm.DB, u *entity.User, sessionID string) (*LoginOutput, error) {
 	roleName := ""
 	if u.Role != nil {
 		roleName = u.Role.Name // สมมติ Role.Name = "user" | "admin"
 	}
 
-	tok, err := issueJWT(u.UserID, roleName)
+	refresh, err := randomToken()
 	if err != nil {
-		return nil, errors.New("cannot issue token")
+		return nil, err
+	}
+	now := time.Now()
+	if err := tx.Create(&entity.RefreshToken{
+		TokenHash: hashToken(refresh),
+		SessionID: sessionID,
+		UserID:    u.UserID,
+		ExpiresAt: now.Add(s.refreshTTL()),
+	}).Error; err != nil {
+		return nil, err
 	}
 
-	return &LoginOutput{Token: tok, User: u, Role: roleName}, nil
+	exp := now.Add(s.accessTTL())
+	tok, err := issueJWT(u.UserID, roleName, sessionID, exp)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginOutput{Token: tok, RefreshToken: refresh, ExpiresAt: exp, User: *u, Role: roleName}, nil
+}
+
+// Refresh หมุน refresh token: ใบเดิมใช้ไม่ได้อีก และได้ access/refresh token ชุดใหม่
+// ถ้ามีคนนำใบที่ถูกหมุนไปแล้วมาใช้ซ้ำ ถือว่า token รั่ว จะเพิกถอนทั้ง session
+func (s *AuthService) Refresh(in RefreshInput) (*LoginOutput, error) {
+	var out *LoginOutput
+	reused := ""
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var rt entity.RefreshToken
+		if err := tx.Where("token_hash = ?", hashToken(in.RefreshToken)).First(&rt).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		var sess entity.AuthSession
+		if err := tx.Where("session_id = ?", rt.SessionID).First(&sess).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if sess.RevokedAt != nil {
+			return ErrSessionRevoked
+		}
+
+		now := time.Now()
+		if rt.UsedAt != nil {
+			reused = rt.SessionID
+			return ErrRefreshTokenReused
+		}
+		if now.After(rt.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		// อัปเดตแบบมีเงื่อนไข: ถ้าสอง request ใช้ token เดียวกันพร้อมกัน ตัวที่แพ้ถือว่าเป็นการใช้ซ้ำ
+		res := tx.Model(&entity.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", rt.ID).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			reused = rt.SessionID
+			return ErrRefreshTokenReused
+		}
+
+		if err := tx.Model(&sess).Updates(map[string]any{
+			"last_used_at": now,
+			"user_agent":   in.UserAgent,
+			"ip_address":   in.IPAddress,
+		}).Error; err != nil {
+			return err
+		}
+
+		// โหลด role ใหม่ทุกครั้ง ถ้า admin เปลี่ยน role ไว้ token ใบใหม่จะได้ค่าล่าสุด
+		var u entity.User
+		if err := tx.Preload("Role").Where("user_id = ?", rt.UserID).First(&u).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if u.DisabledAt != nil {
+			return ErrAccountDisabled
+		}
+		var err error
+		out, err = s.issueTokens(tx, &u, rt.SessionID)
+		return err
+	})
+	if reused != "" {
+		// ทำนอก transaction ด้านบนซึ่งถูก rollback ไปแล้ว
+		if rerr := revokeSession(s.DB, reused, RevokeReasonRefreshReuse); rerr != nil {
+			return nil, rerr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Logout เพิกถอน session ของ refresh token นี้ (token ที่ไม่รู้จักถือว่าออกจากระบบแล้ว)
+func (s *AuthService) Logout(refreshToken string) error {
+	var rt entity.RefreshToken
+	if err := s.DB.Where("token_hash = ?", hashToken(refreshToken)).First(&rt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return revokeSession(s.DB, rt.SessionID, RevokeReasonLogout)
+}
+
+func revokeSession(tx *gorm.DB, sessionID, reason string) error {
+	return tx.Model(&entity.AuthSession{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Updates(map[string]any{"revoked_at": time.Now(), "revoke_reason": reason}).Error
+}
+
+// RevokeUserSessions เพิกถอนทุก session ของผู้ใช้ (ยกเว้น exceptSessionID ถ้าระบุ)
+// ใช้เมื่อเปลี่ยนรหัสผ่านหรือปิดบัญชี เพื่อให้ token ที่ออกไปแล้วใช้ไม่ได้ทันที
+func RevokeUserSessions(tx *gorm.DB, userID, reason, exceptSessionID string) error {
+	q := tx.Model(&entity.AuthSession{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if exceptSessionID != "" {
+		q = q.Where("session_id <> ?", exceptSessionID)
+	}
+	return q.Updates(map[string]any{"revoked_at": time.Now(), "revoke_reason": reason}).Error
+}
+
+// SessionActive ตรวจว่า session ของ access token ยังไม่ถูกเพิกถอน (ใช้ใน middlewares.AuthRequired)
+func SessionActive(db *gorm.DB, userID, sessionID string) bool {
+	if sessionID == "" {
+		return false
+	}
+	var n int64
+	if err := db.Model(&entity.AuthSession{}).
+		Where("session_id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Count(&n).Error; err != nil {
+		return false
+	}
+	return n > 0
+}
+
+// MustChangePassword ผู้ใช้ต้องเปลี่ยนรหัสผ่านก่อนใช้งานอื่น (เช่นบัญชีที่นำเข้าพร้อมรหัสผ่านชั่วคราว)
+func MustChangePassword(db *gorm.DB, userID string) bool {
+	var n int64
+	if err := db.Model(&entity.User{}).
+		Where("user_id = ? AND must_change_password = ?", userID, true).
+		Count(&n).Error; err != nil {
+		return false
+	}
+	return n > 0
 }
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newAuthTestService(t *testing.T) *AuthService {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&entity.Role{}, &entity.User{}, &entity.AuthSession{}, &entity.RefreshToken{}); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct-horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	role := &entity.Role{Name: "admin"}
+	mustCreate(t, db, role)
+	mustCreate(t, db, &entity.User{
+		UserID: "S010", Password: string(hash), Firstname: "Admin", Lastname: "Admin",
+		Email: "admin@example.com", RoleID: role.ID,
+	})
+	return &AuthService{DB: db, Throttle: &LoginThrottle{MaxFailures: 3, Window: time.Minute}}
+}
+
+// การเดารหัสผ่านผิดจาก IP หนึ่งต้องไม่ทำให้เจ้าของบัญชี login จากเครื่องอื่นไม่ได้
+func TestLoginThrottleDoesNotLockOutOtherClients(t *testing.T) {
+	s := newAuthTestService(t)
+	const attacker, owner = "203.0.113.9", "198.51.100.7"
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.Login(LoginInput{Identifier: "admin@example.com", Password: "guess", IPAddress: attacker}); err == nil ||
+			errors.Is(err, ErrTooManyAttempts) {
+			t.Fatalf("attempt %d err = %v, want wrong password", i+1, err)
+		}
+	}
+	// ผู้โจมตีถูกล็อกแม้จะใส่รหัสผ่านถูก (ไม่ตรวจ bcrypt ระหว่างถูกล็อก)
+	if _, err := s.Login(LoginInput{Identifier: "ADMIN@example.com ", Password: "correct-horse", IPAddress: attacker}); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("locked client err = %v, want ErrTooManyAttempts", err)
+	}
+	if d := s.RetryAfter("admin@example.com", attacker); d <= 0 || d > time.Minute {
+		t.Errorf("RetryAfter = %v, want within the window", d)
+	}
+
+	out, err := s.Login(LoginInput{Identifier: "admin@example.com", Password: "correct-horse", IPAddress: owner})
+	if err != nil {
+		t.Fatalf("login from a clean client err = %v", err)
+	}
+	if out.User.UserID != "S010" || out.Token == "" {
+		t.Errorf("login from a clean client = %+v", out)
+	}
+	if _, err := s.Authenticate("S010", "correct-horse", owner); err != nil {
+		t.Errorf("basic auth from a clean client err = %v", err)
+	}
+}
+
+func TestLoginThrottleResetsAfterWindow(t *testing.T) {
+	s := newAuthTestService(t)
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	s.Throttle.Clock = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		s.Authenticate("S010", "guess", "203.0.113.9")
+	}
+	if _, err := s.Authenticate("S010", "correct-horse", "203.0.113.9"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("err = %v, want ErrTooManyAttempts", err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := s.Authenticate("S010", "correct-horse", "203.0.113.9"); err != nil {
+		t.Fatalf("after window err = %v", err)
+	}
+}
@@ -0,0 +1,349 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+)
+
+// knownLanguages รหัสภาษา (ISO 639-1, ISO 639-2) กับชื่อที่อาจใช้ในตาราง Languages
+// ชื่อแรกใช้เมื่อเสนอให้สร้างแถวใหม่ รหัสตัวแรกใช้ใน Dublin Core ตัวที่สองใช้ใน field 041 ของ MARC
+var knownLanguages = []struct {
+	Codes []string
+	Names []string
+}{
+	{[]string{"th", "tha"}, []string{"ไทย", "ภาษาไทย", "Thai"}},
+	{[]string{"en", "eng"}, []string{"อังกฤษ", "ภาษาอังกฤษ", "English"}},
+	{[]string{"zh", "chi", "zho"}, []string{"จีน", "ภาษาจีน", "Chinese"}},
+	{[]string{"ja", "jpn"}, []string{"ญี่ปุ่น", "ภาษาญี่ปุ่น", "Japanese"}},
+	{[]string{"ko", "kor"}, []string{"เกาหลี", "ภาษาเกาหลี", "Korean"}},
+	{[]string{"fr", "fre", "fra"}, []string{"ฝรั่งเศส", "ภาษาฝรั่งเศส", "French"}},
+	{[]string{"de", "ger", "deu"}, []string{"เยอรมัน", "ภาษาเยอรมัน", "German"}},
+	{[]string{"es", "spa"}, []string{"สเปน", "ภาษาสเปน", "Spanish"}},
+	{[]string{"lo", "lao"}, []string{"ลาว", "ภาษาลาว", "Lao"}},
+	{[]string{"vi", "vie"}, []string{"เวียดนาม", "ภาษาเวียดนาม", "Vietnamese"}},
+	{[]string{"ms", "may", "msa"}, []string{"มลายู", "ภาษามลายู", "Malay"}},
+	{[]string{"id", "ind"}, []string{"อินโดนีเซีย", "ภาษาอินโดนีเซีย", "Indonesian"}},
+}
+
+// languageCodesOf รหัสภาษา (ISO 639-1, ISO 639-2, ...) ของชื่อภาษาในตาราง Languages (nil ถ้าไม่รู้จัก)
+func languageCodesOf(name string) []string {
+	key := matchName(name)
+	for _, l := range knownLanguages {
+		for _, n := range l.Names {
+			if matchName(n) == key {
+				return l.Codes
+			}
+		}
+	}
+	return nil
+}
+
+// lookupLanguage หาภาษาจากรหัส (th, en-US, tha) หรือชื่อ (ไทย, English)
+// ไม่พบคืน nil พร้อมชื่อที่ควรใช้ถ้าจะสร้างแถวใหม่
+func lookupLanguage(tx *gorm.DB, value string) (*entity.Languages, string, error) {
+	value = strings.Join(strings.Fields(value), " ")
+	primary := strings.ToLower(value)
+	if i := strings.IndexAny(primary, "-_"); i >= 0 {
+		primary = primary[:i]
+	}
+	candidates := []string{matchName(value), primary}
+	proposed := value
+	for _, l := range knownLanguages {
+		known := false
+		for _, c := range l.Codes {
+			known = known || c == primary
+		}
+		for _, n := range l.Names {
+			known = known || matchName(n) == matchName(value)
+		}
+		if !known {
+			continue
+		}
+		for _, n := range l.Names {
+			candidates = append(candidates, matchName(n))
+		}
+		candidates = append(candidates, l.Codes...)
+		proposed = l.Names[0]
+		break
+	}
+	var lang entity.Languages
+	if err := tx.Where("LOWER(TRIM(name)) IN ?", candidates).Order("id").Limit(1).Find(&lang).Error; err != nil {
+		return nil, "", err
+	}
+	if lang.ID == 0 {
+		return nil, proposed, nil
+	}
+	return &lang, lang.Name, nil
+}
+
+// lookupAuthor หาผู้แต่งตามชื่อ ("นามสกุล, ชื่อ" แบบ file-as ลองสลับเป็น "ชื่อ นามสกุล" ด้วย) ไม่พบคืน nil
+func lookupAuthor(tx *gorm.DB, name string) (*entity.Author, error) {
+	candidates := []string{matchName(name)}
+	if last, first, ok := strings.Cut(name, ","); ok {
+		candidates = append(candidates, matchName(first+" "+last))
+	}
+	var a entity.Author
+	if err := tx.Where("LOWER(TRIM(author_name)) IN ?", candidates).Order("id").Limit(1).Find(&a).Error; err != nil {
+		return nil, err
+	}
+	if a.ID == 0 {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+// lookupPublisher หาสำนักพิมพ์ตามชื่อ ไม่พบคืน nil
+func lookupPublisher(tx *gorm.DB, name string) (*entity.Publishers, error) {
+	var p entity.Publishers
+	if err := tx.Where("LOWER(TRIM(publisher_name)) = ?", matchName(name)).Order("id").Limit(1).Find(&p).Error; err != nil {
+		return nil, err
+	}
+	if p.ID == 0 {
+		return nil, nil
+	}
+	return &p, nil
+}
+
+// fileTypeName ชื่อชนิดไฟล์ในตาราง FileTypes (epub, pdf) จากชื่อหรือ content type
+func fileTypeName(value string) string {
+	if ext, ok := uploadExtensions[strings.ToLower(strings.TrimSpace(value))]; ok {
+		return strings.TrimPrefix(ext, ".")
+	}
+	return strings.TrimPrefix(matchName(value), ".")
+}
+
+// lookupFileType หาชนิดไฟล์ตามชื่อหรือ content type ไม่พบคืน nil
+func lookupFileType(tx *gorm.DB, value string) (*entity.FileTypes, error) {
+	var ft entity.FileTypes
+	if err := tx.Where("LOWER(TRIM(type_name)) = ?", fileTypeName(value)).Order("id").Limit(1).Find(&ft).Error; err != nil {
+		return nil, err
+	}
+	if ft.ID == 0 {
+		return nil, nil
+	}
+	return &ft, nil
+}
+
+// DraftMatch ค่าที่อ่านจากไฟล์ (Value) จับคู่กับแถวที่มีอยู่แล้ว (ID) หรือเสนอให้สร้างใหม่ชื่อ Name (New)
+type DraftMatch struct {
+	Value string `json:"value"`
+	ID    uint   `json:"id,omitempty"`
+	Name  string `json:"name"`
+	New   bool   `json:"new"`
+}
+
+// BookDraft ข้อมูลหนังสือที่กรอกไว้ให้จาก metadata ของ e-book
+// Book ส่งต่อให้ POST /admin/books ได้ทันที: ผู้แต่ง/สำนักพิมพ์/ภาษาที่ยังไม่มี ID จะถูกสร้างใหม่ตอนบันทึก
+type BookDraft struct {
+	Book      entity.Book  `json:"book"`
+	Authors   []DraftMatch `json:"authors"`
+	Publisher *DraftMatch  `json:"publisher"`
+	Language  *DraftMatch  `json:"language"`
+	FileType  *DraftMatch  `json:"file_type"`
+	// Missing ช่องที่อ่านจากไฟล์ไม่ได้ ต้องกรอกเอง
+	Missing  []string `json:"missing"`
+	Warnings []string `json:"warnings"`
+}
+
+// BookDraftService สร้าง BookDraft จากไฟล์ e-book ที่อัปโหลด
+type BookDraftService struct {
+	DB    *gorm.DB
+	Store Storage
+}
+
+// matchName เทียบชื่อแบบไม่สนตัวพิมพ์และช่องว่างซ้ำ
+func matchName(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// Draft สร้างร่างหนังสือของไฟล์ที่ key จาก metadata ที่อ่านด้วย ExtractEbookMetadata (mdErr คือ error ที่ได้จากการอ่าน)
+// ไฟล์ที่อ่าน metadata ไม่ได้ยังได้ร่างที่มีแค่ ebook_file / file_type พร้อมคำเตือน
+func (s *BookDraftService) Draft(md *EbookMetadata, mdErr error, key, userID string) (*BookDraft, error) {
+	contentType := contentTypeOf(key)
+	d := &BookDraft{Authors: []DraftMatch{}, Missing: []string{}, Warnings: []string{}}
+	d.Book.EbookFile = key
+	d.Book.UserID = userID
+
+	ft, err := s.matchFileType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	d.FileType = ft
+	if ft.New {
+		d.Book.FileType = &entity.FileTypes{TypeName: ft.Name}
+	} else {
+		d.Book.FileTypeID = ft.ID
+	}
+
+	if mdErr != nil || md == nil {
+		if mdErr != nil {
+			d.Warnings = append(d.Warnings, "could not read metadata: "+mdErr.Error())
+		}
+		md = &EbookMetadata{}
+	}
+
+	d.Book.Title = md.Title
+	d.Book.Synopsis = md.Description
+	d.Book.TotalPage = md.PageCount
+	d.Book.PublishedYear = md.PublishedYear
+	if md.Isbn != "" {
+		d.Book.Isbn = md.Isbn
+		var existing entity.Book
+		// Isbn เป็น unique รวมหนังสือที่ถูกลบแบบ soft delete ด้วย
+		if err := s.DB.Unscoped().Select("id").Where("isbn = ?", md.Isbn).Limit(1).Find(&existing).Error; err != nil {
+			return nil, err
+		}
+		if existing.ID != 0 {
+			d.Warnings = append(d.Warnings, fmt.Sprintf("isbn %s is already used by book %d", md.Isbn, existing.ID))
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, name := range md.Authors {
+		if seen[matchName(name)] {
+			continue
+		}
+		seen[matchName(name)] = true
+		m, err := s.matchAuthor(name)
+		if err != nil {
+			return nil, err
+		}
+		d.Authors = append(d.Authors, *m)
+		a := entity.Author{AuthorName: m.Name}
+		a.ID = m.ID
+		d.Book.Authors = append(d.Book.Authors, a)
+	}
+
+	if md.Publisher != "" {
+		m, err := s.matchPublisher(md.Publisher)
+		if err != nil {
+			return nil, err
+		}
+		d.Publisher = m
+		if m.New {
+			d.Book.Publisher = &entity.Publishers{PublisherName: m.Name}
+		} else {
+			d.Book.PublisherID = m.ID
+		}
+	}
+
+	if md.Language != "" {
+		m, err := s.matchLanguage(md.Language)
+		if err != nil {
+			return nil, err
+		}
+		d.Language = m
+		if m.New {
+			d.Book.Language = &entity.Languages{Name: m.Name}
+		} else {
+			d.Book.LanguageID = m.ID
+		}
+	}
+
+	if len(md.Cover) > 0 {
+		if err := s.storeCover(md.Cover, &d.Book, userID); err != nil {
+			d.Warnings = append(d.Warnings, "could not use embedded cover: "+err.Error())
+		}
+	}
+
+	for _, f := range []struct {
+		name    string
+		missing bool
+	}{
+		{"title", d.Book.Title == ""},
+		{"isbn", d.Book.Isbn == ""},
+		{"total_page", d.Book.TotalPage == 0},
+		{"published_year", d.Book.PublishedYear == 0},
+		{"authors", len(d.Authors) == 0},
+		{"publisher", d.Publisher == nil},
+		{"language", d.Language == nil},
+		{"cover_image", d.Book.CoverImage == ""},
+	} {
+		if f.missing {
+			d.Missing = append(d.Missing, f.name)
+		}
+	}
+	return d, nil
+}
+
+func (s *BookDraftService) matchAuthor(name string) (*DraftMatch, error) {
+	a, err := lookupAuthor(s.DB, name)
+	if err != nil {
+		return nil, err
+	}
+	if a != nil {
+		return &DraftMatch{Value: name, ID: a.ID, Name: a.AuthorName}, nil
+	}
+	return &DraftMatch{Value: name, Name: strings.Join(strings.Fields(name), " "), New: true}, nil
+}
+
+func (s *BookDraftService) matchPublisher(name string) (*DraftMatch, error) {
+	p, err := lookupPublisher(s.DB, name)
+	if err != nil {
+		return nil, err
+	}
+	if p != nil {
+		return &DraftMatch{Value: name, ID: p.ID, Name: p.PublisherName}, nil
+	}
+	return &DraftMatch{Value: name, Name: strings.Join(strings.Fields(name), " "), New: true}, nil
+}
+
+// matchLanguage รหัสภาษาเช่น th, en-US จับคู่กับชื่อใน Languages (ไทย, English ฯลฯ) หรือตัวรหัสเอง
+func (s *BookDraftService) matchLanguage(code string) (*DraftMatch, error) {
+	l, name, err := lookupLanguage(s.DB, code)
+	if err != nil {
+		return nil, err
+	}
+	if l != nil {
+		return &DraftMatch{Value: code, ID: l.ID, Name: l.Name}, nil
+	}
+	return &DraftMatch{Value: code, Name: name, New: true}, nil
+}
+
+// matchFileType ชนิดไฟล์ตามที่ตรวจได้ (epub / pdf) กับ FileTypes.TypeName
+func (s *BookDraftService) matchFileType(contentType string) (*DraftMatch, error) {
+	ft, err := lookupFileType(s.DB, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if ft != nil {
+		return &DraftMatch{Value: contentType, ID: ft.ID, Name: ft.TypeName}, nil
+	}
+	return &DraftMatch{Value: contentType, Name: fileTypeName(contentType), New: true}, nil
+}
+
+// storeCover เก็บภาพปกที่ฝังใน EPUB เป็นปกของร่าง (ตรวจเหมือนอัปโหลดปกเอง) พร้อมภาพย่อ
+func (s *BookDraftService) storeCover(data []byte, b *entity.Book, userID string) error {
+	r := bytes.NewReader(data)
+	ct, err := CoverUploadPolicy.Check(r, int64(len(data)))
+	if err != nil {
+		return err
+	}
+	name, err := RandomUploadName(ct)
+	if err != nil {
+		return err
+	}
+	key := strings.TrimSuffix(coverKeyPrefix, "/") + "/" + name
+	if err := s.Store.Put(key, bytes.NewReader(data), int64(len(data)), ct); err != nil {
+		return err
+	}
+	if err := TrackUpload(s.DB, UploadStoreMain, key, ct, int64(len(data)), userID); err != nil {
+		return err
+	}
+	thumbs, err := GenerateCoverThumbnails(s.Store, key)
+	if err != nil {
+		return err
+	}
+	for _, t := range []string{thumbs.Small, thumbs.Medium, thumbs.Large} {
+		if err := TrackUpload(s.DB, UploadStoreMain, t, ContentTypeJPEG, 0, userID); err != nil {
+			return err
+		}
+	}
+	b.CoverImage = key
+	b.CoverSmall, b.CoverMedium, b.CoverLarge = thumbs.Small, thumbs.Medium, thumbs.Large
+	return nil
+}
@@ -0,0 +1,307 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+)
+
+// ชื่อสถานะของ BookLicense (seed ไว้ใน config.CreateDefaultBookStatus)
+const (
+	BookStatusAvailable = "Available"
+	BookStatusBorrowed  = "Borrowed"
+	BookStatusHold      = "Hold"
+	BookStatusRetired   = "Retired" // เลิกใช้แล้ว ไม่นับในจำนวนเล่มทั้งหมด
+)
+
+// ระยะเวลายืมเริ่มต้น ถ้าไม่ได้กำหนด BorrowService.LoanPeriod
+const DefaultLoanPeriod = 14 * 24 * time.Hour
+
+var (
+	ErrBookNotFound       = errors.New("book not found")
+	ErrNoAvailableLicense = errors.New("no available copy of this book")
+	ErrAlreadyBorrowed    = errors.New("you already have an active borrow of this book")
+	ErrBorrowNotFound     = errors.New("borrow not found")
+	ErrAlreadyReturned    = errors.New("borrow already returned")
+	ErrBorrowLimitReached = errors.New("borrowing limit reached")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrLimitNotFound      = errors.New("borrowing limit not found")
+)
+
+type BorrowService struct {
+	DB            *gorm.DB
+	Notifications *NotificationService
+	LoanPeriod    time.Duration
+	HoldPeriod    time.Duration
+}
+
+type CheckoutInput struct {
+	UserID string
+	BookID uint
+}
+
+func (s *BorrowService) loanPeriod() time.Duration {
+	if s.LoanPeriod > 0 {
+		return s.LoanPeriod
+	}
+	return DefaultLoanPeriod
+}
+
+// bookStatusID หา id ของ BookStatus จากชื่อ
+func bookStatusID(tx *gorm.DB, name string) (uint, error) {
+	var st entity.BookStatus
+	if err := tx.Where("status_name = ?", name).First(&st).Error; err != nil {
+		return 0, fmt.Errorf("book status %q not found: %w", name, err)
+	}
+	return st.ID, nil
+}
+
+// Checkout ยืมหนังสือ: เลือก license ที่ Available แล้วเปลี่ยนเป็น Borrowed ภายใน transaction เดียว
+func (s *BorrowService) Checkout(in CheckoutInput) (*entity.Borrow, error) {
+	var out entity.Borrow
+	err := s.Notifications.Transaction(s.DB, func(tx *gorm.DB) error {
+		var book entity.Book
+		if err := tx.First(&book, in.BookID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrBookNotFound
+			}
+			return err
+		}
+
+		// ตรวจโควตาการยืมตาม BorrowingLimit ของผู้ใช้
+		var user entity.User
+		if err := tx.Preload("BorrowingLimit").Where("user_id = ?", in.UserID).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		if user.BorrowingLimit == nil {
+			return ErrLimitNotFound
+		}
+		var borrowed int64
+		if err := tx.Model(&entity.Borrow{}).
+			Where("user_id = ? AND return_date IS NULL", in.UserID).
+			Count(&borrowed).Error; err != nil {
+			return err
+		}
+		if borrowed >= int64(user.BorrowingLimit.LimitNumber) {
+			return fmt.Errorf("%w: you can borrow at most %d books at a time", ErrBorrowLimitReached, user.BorrowingLimit.LimitNumber)
+		}
+
+		// กันยืมเล่มเดิมซ้ำในขณะที่ยังไม่คืน
+		var active int64
+		if err := tx.Model(&entity.Borrow{}).
+			Joins("JOIN book_licenses ON book_licenses.id = borrows.book_license_id").
+			Where("borrows.user_id = ? AND book_licenses.book_id = ? AND borrows.return_date IS NULL", in.UserID, book.ID).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrAlreadyBorrowed
+		}
+
+		borrowedID, err := bookStatusID(tx, BookStatusBorrowed)
+		if err != nil {
+			return err
+		}
+
+		// ถ้ามี license ถูก Hold ไว้ให้จากการจอง ใช้เล่มนั้นก่อน
+		now := time.Now()
+		lic, err := fulfilReservation(tx, in.UserID, book.ID)
+		if err != nil {
+			return err
+		}
+		if lic != nil {
+			// นับการยืมของ license แบบ metered ไปด้วย
+			if err := tx.Model(lic).Updates(map[string]any{
+				"book_status_id": borrowedID,
+				"checkout_count": gorm.Expr("checkout_count + 1"),
+			}).Error; err != nil {
+				return err
+			}
+		} else {
+			if lic, err = claimAvailableLicense(tx, book.ID, borrowedID, now); err != nil {
+				return err
+			}
+			// ได้เล่มว่างโดยไม่ต้องรอคิว: ปิดการจองที่ยัง Waiting ของผู้ใช้สำหรับเล่มนี้
+			if err := fulfilWaiting(tx, in.UserID, book.ID); err != nil {
+				return err
+			}
+		}
+
+		// license แบบ time_limited ยืมได้ไม่เกินวันหมดอายุของ license
+		due := now.Add(s.loanPeriod())
+		if lic.ExpiresAt != nil && lic.ExpiresAt.Before(due) {
+			due = *lic.ExpiresAt
+		}
+		out = entity.Borrow{
+			BorrowDate:    now,
+			DueDate:       due,
+			UserID:        in.UserID,
+			BookLicenseID: lic.ID,
+		}
+		return tx.Create(&out).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Return คืนหนังสือ: บันทึก ReturnDate แล้วปล่อย license กลับ
+func (s *BorrowService) Return(userID string, borrowID uint) (*entity.Borrow, error) {
+	var out entity.Borrow
+	err := s.Notifications.Transaction(s.DB, func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", borrowID, userID).First(&out).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrBorrowNotFound
+			}
+			return err
+		}
+		if out.ReturnDate != nil {
+			return ErrAlreadyReturned
+		}
+
+		now := time.Now()
+		res := tx.Model(&entity.Borrow{}).
+			Where("id = ? AND return_date IS NULL", out.ID).
+			Update("return_date", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrAlreadyReturned
+		}
+		out.ReturnDate = &now
+
+		next, err := allocateLicense(tx, out.BookLicenseID, now, s.HoldPeriod)
+		if err != nil {
+			return err
+		}
+		return s.Notifications.NotifyReservationReady(tx, next)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// claimAvailableLicense เลือก license ที่ Available และยังใช้ได้ (ไม่หมดอายุ/ยังเหลือจำนวนครั้ง) แล้วเปลี่ยนเป็น Borrowed
+// พร้อมนับจำนวนครั้งที่ถูกยืม
+func claimAvailableLicense(tx *gorm.DB, bookID, borrowedID uint, now time.Time) (*entity.BookLicense, error) {
+	availableID, err := bookStatusID(tx, BookStatusAvailable)
+	if err != nil {
+		return nil, err
+	}
+
+	var lic entity.BookLicense
+	if err := tx.Where("book_id = ? AND book_status_id = ?", bookID, availableID).
+		Where(licenseUsableSQL, now).
+		Order("id").
+		First(&lic).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoAvailableLicense
+		}
+		return nil, err
+	}
+
+	// อัปเดตแบบมีเงื่อนไข: ถ้ามีคนอื่นจอง license นี้ไปก่อน RowsAffected จะเป็น 0
+	res := tx.Model(&entity.BookLicense{}).
+		Where("id = ? AND book_status_id = ?", lic.ID, availableID).
+		Updates(map[string]any{
+			"book_status_id": borrowedID,
+			"checkout_count": gorm.Expr("checkout_count + 1"),
+		})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrNoAvailableLicense
+	}
+	lic.BookStatusID = borrowedID
+	lic.CheckoutCount++
+	return &lic, nil
+}
+
+// fulfilWaiting เปลี่ยนการจองที่ยัง Waiting ของผู้ใช้สำหรับหนังสือเล่มนี้เป็น Fulfilled
+func fulfilWaiting(tx *gorm.DB, userID string, bookID uint) error {
+	waitingID, err := reservationStatusID(tx, ReservationStatusWaiting)
+	if err != nil {
+		return err
+	}
+	fulfilledID, err := reservationStatusID(tx, ReservationStatusFulfilled)
+	if err != nil {
+		return err
+	}
+	return tx.Model(&entity.Reservation{}).
+		Where("user_id = ? AND book_id = ? AND reservation_status_id = ?", userID, bookID, waitingID).
+		Update("reservation_status_id", fulfilledID).Error
+}
+
+// ListBorrows รายการยืมของผู้ใช้ (activeOnly = เฉพาะที่ยังไม่คืน)
+func (s *BorrowService) ListBorrows(userID string, activeOnly bool) ([]entity.Borrow, error) {
+	var items []entity.Borrow
+	q := s.DB.Preload("BookLicense.Book").Where("user_id = ?", userID)
+	if activeOnly {
+		q = q.Where("return_date IS NULL")
+	}
+	if err := q.Order("borrow_date DESC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetBorrow ดูรายการยืมหนึ่งรายการของผู้ใช้
+func (s *BorrowService) GetBorrow(userID string, borrowID uint) (*entity.Borrow, error) {
+	var b entity.Borrow
+	if err := s.DB.Preload("BookLicense.Book").
+		Where("id = ? AND user_id = ?", borrowID, userID).
+		First(&b).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBorrowNotFound
+		}
+		return nil, err
+	}
+	return &b, nil
+}
+
+// ListBorrowingLimits รายการระดับโควตาการยืมทั้งหมด
+func (s *BorrowService) ListBorrowingLimits() ([]entity.BorrowingLimit, error) {
+	var items []entity.BorrowingLimit
+	if err := s.DB.Order("limit_number").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// SetBorrowingLimit ย้ายผู้ใช้ไปยัง BorrowingLimit ระดับอื่น
+// (ไม่กระทบรายการที่ยืมอยู่แล้ว มีผลกับการยืมครั้งถัดไป)
+func (s *BorrowService) SetBorrowingLimit(userID string, limitID uint) (*entity.User, error) {
+	var limit entity.BorrowingLimit
+	if err := s.DB.First(&limit, limitID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLimitNotFound
+		}
+		return nil, err
+	}
+
+	res := s.DB.Model(&entity.User{}).
+		Where("user_id = ?", userID).
+		Update("borrowing_limit_id", limit.ID)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	var u entity.User
+	if err := s.DB.Preload("BorrowingLimit").Where("user_id = ?", userID).First(&u).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
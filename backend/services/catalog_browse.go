@@ -0,0 +1,453 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+)
+
+// ลำดับการเรียงที่ Browse รองรับ
+const (
+	BrowseSortTitle      = "title"
+	BrowseSortYear       = "year"
+	BrowseSortPopularity = "popularity" // จำนวนครั้งที่ถูกยืม
+	BrowseSortRating     = "rating"     // คะแนนรีวิวเฉลี่ย
+)
+
+const (
+	DefaultBrowseLimit = 20
+	MaxBrowseLimit     = 200
+)
+
+// ขั้นของ facet คะแนน: จำนวนหนังสือที่คะแนนเฉลี่ยตั้งแต่ n ดาวขึ้นไป
+var ratingFacetSteps = []int{4, 3, 2, 1}
+
+var (
+	ErrInvalidSort   = errors.New("sort must be one of title, year, popularity, rating")
+	ErrInvalidOrder  = errors.New("order must be asc or desc")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidRange  = errors.New("year_from must not be greater than year_to")
+)
+
+// คำสั่ง SQL ของค่าที่คำนวณต่อเล่ม (อ้าง books ของ query หลัก)
+const (
+	bookBorrowCountSQL = `(SELECT COUNT(*) FROM borrows br JOIN book_licenses bl ON bl.id = br.book_license_id
+		WHERE bl.book_id = books.id AND br.deleted_at IS NULL)`
+	bookAvgRatingSQL = `(SELECT AVG(r.rating) FROM reviews r WHERE r.book_id = books.id AND r.deleted_at IS NULL)`
+	bookAvailableSQL = `EXISTS (SELECT 1 FROM book_licenses bl JOIN book_statuses bs ON bs.id = bl.book_status_id
+		WHERE bl.book_id = books.id AND bl.deleted_at IS NULL AND bs.status_name = ?)`
+)
+
+// คีย์ของ filter แต่ละตัว ใช้บอกว่า facet ไหนไม่ต้องกรองด้วยตัวเอง
+const (
+	facetCategory  = "category"
+	facetAuthor    = "author"
+	facetPublisher = "publisher"
+	facetLanguage  = "language"
+	facetFileType  = "file_type"
+	facetYear      = "year"
+	facetAvailable = "available"
+	facetRating    = "rating"
+)
+
+// BrowseBooksInput เงื่อนไขของ Browse ฟิลด์ที่เป็นค่าว่างหรือ nil คือไม่กรอง
+// รายการ id หลายค่าในฟิลด์เดียวกันกรองแบบ OR ส่วนฟิลด์ต่างกันกรองแบบ AND
+type BrowseBooksInput struct {
+	CategoryIDs  []uint // รวมหมวดย่อยทุกระดับ
+	AuthorIDs    []uint
+	PublisherIDs []uint
+	LanguageIDs  []uint
+	FileTypeIDs  []uint
+	YearFrom     uint
+	YearTo       uint
+	Available    *bool    // true = มี license สถานะ Available อย่างน้อยหนึ่งชุด
+	MinRating    *float64 // คะแนนเฉลี่ยขั้นต่ำ (หนังสือที่ยังไม่มีรีวิวจะไม่ผ่าน)
+
+	Sort   string // BrowseSort* (ค่าเริ่มต้น title)
+	Order  string // asc | desc (ค่าเริ่มต้น asc สำหรับ title, desc สำหรับแบบอื่น)
+	Cursor string // next_cursor จากหน้าก่อน
+	Limit  int
+}
+
+// BookListItem หนังสือหนึ่งเล่มในผล Browse พร้อมค่าที่ใช้เรียง
+type BookListItem struct {
+	entity.Book
+	AuthorNames       string  `json:"author_names"`
+	AvgRating         float64 `json:"avg_rating"`
+	ReviewCount       int64   `json:"review_count"`
+	BorrowCount       int64   `json:"borrow_count"`
+	AvailableLicenses int64   `json:"available_licenses"`
+}
+
+type FacetCount struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+type YearFacet struct {
+	Year  uint  `json:"year"`
+	Count int64 `json:"count"`
+}
+
+type RatingFacet struct {
+	MinRating int   `json:"min_rating"`
+	Count     int64 `json:"count"`
+}
+
+type AvailabilityFacet struct {
+	Available   int64 `json:"available"`
+	Unavailable int64 `json:"unavailable"`
+}
+
+// BookFacets จำนวนหนังสือต่อค่าของแต่ละ facet
+// แต่ละ facet นับโดยใช้ filter อื่นทั้งหมดยกเว้นของตัวเอง เพื่อให้หน้าเว็บเลือกหลายค่าใน facet เดียวกันได้
+type BookFacets struct {
+	Categories   []FacetCount      `json:"categories"`
+	Authors      []FacetCount      `json:"authors"`
+	Publishers   []FacetCount      `json:"publishers"`
+	Languages    []FacetCount      `json:"languages"`
+	FileTypes    []FacetCount      `json:"file_types"`
+	Years        []YearFacet       `json:"years"`
+	Availability AvailabilityFacet `json:"availability"`
+	Ratings      []RatingFacet     `json:"ratings"`
+}
+
+type BookBrowsePage struct {
+	Items      []BookListItem `json:"items"`
+	Facets     BookFacets     `json:"facets"`
+	Total      int64          `json:"total"`
+	Sort       string         `json:"sort"`
+	Order      string         `json:"order"`
+	Limit      int            `json:"limit"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// browseCursor ตำแหน่งของแถวสุดท้ายในหน้าก่อน (keyset pagination บน sort key + id)
+type browseCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Key   any    `json:"k"`
+	ID    uint   `json:"id"`
+}
+
+func encodeCursor(c browseCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*browseCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c browseCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == 0 || c.Key == nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// browseSortKey คำสั่ง SQL ของค่าที่ใช้เรียง
+func browseSortKey(sort string) (string, error) {
+	switch sort {
+	case BrowseSortTitle:
+		return "books.title", nil
+	case BrowseSortYear:
+		return "books.published_year", nil
+	case BrowseSortPopularity:
+		return bookBorrowCountSQL, nil
+	case BrowseSortRating:
+		return "COALESCE(" + bookAvgRatingSQL + ", 0)", nil
+	default:
+		return "", ErrInvalidSort
+	}
+}
+
+// filteredBooks query ของหนังสือที่ผ่านทุก filter ยกเว้น skip ("" = ใช้ทุก filter)
+func (s *CatalogService) filteredBooks(in BrowseBooksInput, skip string) *gorm.DB {
+	q := s.DB.Model(&entity.Book{})
+	if len(in.CategoryIDs) > 0 && skip != facetCategory {
+		// นับหนังสือในหมวดย่อยทุกระดับของหมวดที่เลือกด้วย
+		q = q.Where("EXISTS (SELECT 1 FROM category_book cb WHERE cb.book_id = books.id AND cb.category_id IN ("+
+			categorySubtreeSQL+"))", in.CategoryIDs)
+	}
+	if len(in.AuthorIDs) > 0 && skip != facetAuthor {
+		q = q.Where("EXISTS (SELECT 1 FROM book_author ba WHERE ba.book_id = books.id AND ba.author_id IN ?)", in.AuthorIDs)
+	}
+	if len(in.PublisherIDs) > 0 && skip != facetPublisher {
+		q = q.Where("books.publisher_id IN ?", in.PublisherIDs)
+	}
+	if len(in.LanguageIDs) > 0 && skip != facetLanguage {
+		q = q.Where("books.language_id IN ?", in.LanguageIDs)
+	}
+	if len(in.FileTypeIDs) > 0 && skip != facetFileType {
+		q = q.Where("books.file_type_id IN ?", in.FileTypeIDs)
+	}
+	if skip != facetYear {
+		if in.YearFrom > 0 {
+			q = q.Where("books.published_year >= ?", in.YearFrom)
+		}
+		if in.YearTo > 0 {
+			q = q.Where("books.published_year <= ?", in.YearTo)
+		}
+	}
+	if in.Available != nil && skip != facetAvailable {
+		if *in.Available {
+			q = q.Where(bookAvailableSQL, BookStatusAvailable)
+		} else {
+			q = q.Where("NOT "+bookAvailableSQL, BookStatusAvailable)
+		}
+	}
+	if in.MinRating != nil && skip != facetRating {
+		q = q.Where(bookAvgRatingSQL+" >= ?", *in.MinRating)
+	}
+	return q
+}
+
+// Browse รายการหนังสือแบบกรองหลายมิติ พร้อม facet และ cursor pagination
+func (s *CatalogService) Browse(in BrowseBooksInput) (*BookBrowsePage, error) {
+	if in.Sort == "" {
+		in.Sort = BrowseSortTitle
+	}
+	keySQL, err := browseSortKey(in.Sort)
+	if err != nil {
+		return nil, err
+	}
+	if in.Order == "" {
+		in.Order = "desc"
+		if in.Sort == BrowseSortTitle {
+			in.Order = "asc"
+		}
+	}
+	if in.Order != "asc" && in.Order != "desc" {
+		return nil, ErrInvalidOrder
+	}
+	if in.YearFrom > 0 && in.YearTo > 0 && in.YearFrom > in.YearTo {
+		return nil, ErrInvalidRange
+	}
+	if in.Limit <= 0 {
+		in.Limit = DefaultBrowseLimit
+	}
+	if in.Limit > MaxBrowseLimit {
+		in.Limit = MaxBrowseLimit
+	}
+
+	out := BookBrowsePage{Sort: in.Sort, Order: in.Order, Limit: in.Limit}
+	if err := s.filteredBooks(in, "").Count(&out.Total).Error; err != nil {
+		return nil, err
+	}
+
+	// เรียงด้วย sort key แล้วตามด้วย id เพื่อให้ลำดับคงที่แม้ค่าซ้ำกัน
+	page := s.DB.Table("(?) AS page", s.filteredBooks(in, "").Select("books.id AS id, "+keySQL+" AS sort_key"))
+	cmp := ">"
+	if in.Order == "desc" {
+		cmp = "<"
+	}
+	if in.Cursor != "" {
+		cur, err := decodeCursor(in.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cur.Sort != in.Sort || cur.Order != in.Order {
+			return nil, ErrInvalidCursor
+		}
+		page = page.Where("sort_key "+cmp+" ? OR (sort_key = ? AND id "+cmp+" ?)", cur.Key, cur.Key, cur.ID)
+	}
+
+	rows, err := page.Select("id, sort_key").
+		Order("sort_key " + in.Order + ", id " + in.Order).
+		Limit(in.Limit + 1).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	type key struct {
+		id      uint
+		sortKey any
+	}
+	var keys []key
+	for rows.Next() {
+		var k key
+		if err := rows.Scan(&k.id, &k.sortKey); err != nil {
+			return nil, err
+		}
+		if b, ok := k.sortKey.([]byte); ok {
+			k.sortKey = string(b)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) > in.Limit {
+		keys = keys[:in.Limit]
+		last := keys[len(keys)-1]
+		out.NextCursor = encodeCursor(browseCursor{Sort: in.Sort, Order: in.Order, Key: last.sortKey, ID: last.id})
+	}
+
+	ids := make([]uint, len(keys))
+	for i, k := range keys {
+		ids[i] = k.id
+	}
+	items, err := s.listItems(ids)
+	if err != nil {
+		return nil, err
+	}
+	out.Items = items
+
+	if err := s.facets(in, &out.Facets); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// listItems โหลดหนังสือตามลำดับของ ids พร้อมคะแนน จำนวนการยืม และจำนวน license ที่ว่าง
+func (s *CatalogService) listItems(ids []uint) ([]BookListItem, error) {
+	items := make([]BookListItem, 0, len(ids))
+	if len(ids) == 0 {
+		return items, nil
+	}
+	books, err := s.loadBooks(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	type stat struct {
+		ID                uint
+		AvgRating         float64
+		ReviewCount       int64
+		BorrowCount       int64
+		AvailableLicenses int64
+	}
+	var stats []stat
+	if err := s.DB.Model(&entity.Book{}).
+		Select(`books.id AS id,
+			COALESCE(`+bookAvgRatingSQL+`, 0) AS avg_rating,
+			(SELECT COUNT(*) FROM reviews r WHERE r.book_id = books.id AND r.deleted_at IS NULL) AS review_count,
+			`+bookBorrowCountSQL+` AS borrow_count,
+			(SELECT COUNT(*) FROM book_licenses bl JOIN book_statuses bs ON bs.id = bl.book_status_id
+				WHERE bl.book_id = books.id AND bl.deleted_at IS NULL AND bs.status_name = ?) AS available_licenses`,
+			BookStatusAvailable).
+		Where("books.id IN ?", ids).
+		Scan(&stats).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]stat, len(stats))
+	for _, st := range stats {
+		byID[st.ID] = st
+	}
+
+	for _, id := range ids {
+		b, ok := books[id]
+		if !ok {
+			continue
+		}
+		st := byID[id]
+		items = append(items, BookListItem{
+			Book:              b,
+			AuthorNames:       joinAuthorNames(b.Authors),
+			AvgRating:         st.AvgRating,
+			ReviewCount:       st.ReviewCount,
+			BorrowCount:       st.BorrowCount,
+			AvailableLicenses: st.AvailableLicenses,
+		})
+	}
+	return items, nil
+}
+
+// facets นับจำนวนหนังสือของทุก facet
+func (s *CatalogService) facets(in BrowseBooksInput, f *BookFacets) error {
+	*f = BookFacets{
+		Categories: []FacetCount{},
+		Authors:    []FacetCount{},
+		Publishers: []FacetCount{},
+		Languages:  []FacetCount{},
+		FileTypes:  []FacetCount{},
+		Years:      []YearFacet{},
+	}
+	ids := func(skip string) *gorm.DB {
+		return s.filteredBooks(in, skip).Select("books.id")
+	}
+
+	if err := s.DB.Table("category_book cb").
+		Select("c.id AS id, c.category_name AS name, COUNT(DISTINCT cb.book_id) AS count").
+		Joins("JOIN categories c ON c.id = cb.category_id AND c.deleted_at IS NULL").
+		Where("cb.book_id IN (?)", ids(facetCategory)).
+		Group("c.id, c.category_name").
+		Order("count DESC, name").
+		Scan(&f.Categories).Error; err != nil {
+		return err
+	}
+	if err := s.DB.Table("book_author ba").
+		Select("a.id AS id, a.author_name AS name, COUNT(DISTINCT ba.book_id) AS count").
+		Joins("JOIN authors a ON a.id = ba.author_id AND a.deleted_at IS NULL").
+		Where("ba.book_id IN (?)", ids(facetAuthor)).
+		Group("a.id, a.author_name").
+		Order("count DESC, name").
+		Scan(&f.Authors).Error; err != nil {
+		return err
+	}
+
+	// facet ที่เป็น FK บนตาราง books โดยตรง
+	lookups := []struct {
+		skip, column, table, name string
+		dest                      *[]FacetCount
+	}{
+		{facetPublisher, "publisher_id", "publishers", "publisher_name", &f.Publishers},
+		{facetLanguage, "language_id", "languages", "name", &f.Languages},
+		{facetFileType, "file_type_id", "file_types", "type_name", &f.FileTypes},
+	}
+	for _, l := range lookups {
+		if err := s.DB.Table("books").
+			Select("t.id AS id, t."+l.name+" AS name, COUNT(*) AS count").
+			Joins("JOIN "+l.table+" t ON t.id = books."+l.column).
+			Where("books.id IN (?)", ids(l.skip)).
+			Group("t.id, t." + l.name).
+			Order("count DESC, name").
+			Scan(l.dest).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := s.DB.Table("books").
+		Select("published_year AS year, COUNT(*) AS count").
+		Where("books.id IN (?)", ids(facetYear)).
+		Group("published_year").
+		Order("published_year DESC").
+		Scan(&f.Years).Error; err != nil {
+		return err
+	}
+
+	var avail struct{ Available, Total int64 }
+	if err := s.DB.Table("books").
+		Select("COALESCE(SUM(CASE WHEN "+bookAvailableSQL+" THEN 1 ELSE 0 END), 0) AS available, COUNT(*) AS total", BookStatusAvailable).
+		Where("books.id IN (?)", ids(facetAvailable)).
+		Scan(&avail).Error; err != nil {
+		return err
+	}
+	f.Availability = AvailabilityFacet{Available: avail.Available, Unavailable: avail.Total - avail.Available}
+
+	var avgs []float64
+	if err := s.DB.Table("reviews r").
+		Select("AVG(r.rating)").
+		Where("r.deleted_at IS NULL AND r.book_id IN (?)", ids(facetRating)).
+		Group("r.book_id").
+		Scan(&avgs).Error; err != nil {
+		return err
+	}
+	f.Ratings = make([]RatingFacet, len(ratingFacetSteps))
+	for i, step := range ratingFacetSteps {
+		f.Ratings[i].MinRating = step
+		for _, avg := range avgs {
+			if avg >= float64(step) {
+				f.Ratings[i].Count++
+			}
+		}
+	}
+	return nil
+}
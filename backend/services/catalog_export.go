@@ -0,0 +1,269 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+)
+
+// catalogExportBatch จำนวนหนังสือที่อ่านจากฐานข้อมูลต่อหนึ่งชุดตอน export
+const catalogExportBatch = 200
+
+// catalogCSVColumns คอลัมน์ของ CSV ตามลำดับที่ export (id / updated_at ใช้อ้างอิงเท่านั้น import จะไม่สนใจ)
+// authors และ categories คั่นหลายค่าด้วย |
+var catalogCSVColumns = []string{
+	"id", "isbn", "title", "authors", "categories", "publisher", "language", "file_type",
+	"total_page", "published_year", "synopsis", "cover_image", "ebook_file", "updated_at",
+}
+
+// catalogListSeparator ตัวคั่นผู้แต่ง/หมวดหมู่หลายค่าในช่องเดียวของ CSV
+const catalogListSeparator = "|"
+
+// catalogWriter เขียน record ทีละเล่ม Close ปิดท้ายไฟล์ (เช่น ] ของ JSON)
+type catalogWriter interface {
+	Write(rec *CatalogRecord) error
+	Flush() error
+	Close() error
+}
+
+func newCatalogWriter(w io.Writer, format string) (catalogWriter, error) {
+	switch format {
+	case CatalogFormatCSV:
+		return newCatalogCSVWriter(w)
+	case CatalogFormatJSON:
+		return &marcJSONWriter{w: w}, nil
+	}
+	return nil, ErrCatalogFormat
+}
+
+// Export เขียนหนังสือทุกเล่มที่ยังไม่ถูกลบลง w เรียงตาม id
+// อ่านจากฐานข้อมูลทีละชุดและเรียก flush หลังเขียนแต่ละชุด เพื่อไม่ต้องเก็บทั้งแค็ตตาล็อกไว้ในหน่วยความจำ
+func (s *CatalogTransferService) Export(w io.Writer, format string, flush func()) error {
+	cw, err := newCatalogWriter(w, format)
+	if err != nil {
+		return err
+	}
+	var books []entity.Book
+	err = s.DB.
+		Preload("Authors").
+		Preload("Categories").
+		Preload("Publisher").
+		Preload("Language").
+		Preload("FileType").
+		Order("id").
+		FindInBatches(&books, catalogExportBatch, func(tx *gorm.DB, batch int) error {
+			for i := range books {
+				rec := catalogRecordOf(&books[i])
+				if err := cw.Write(&rec); err != nil {
+					return err
+				}
+			}
+			if err := cw.Flush(); err != nil {
+				return err
+			}
+			if flush != nil {
+				flush()
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// catalogRecordOf แปลงหนังสือ (ที่ preload ข้อมูลอ้างอิงแล้ว) เป็น CatalogRecord
+// หมวดหมู่ใช้รหัสเพื่อให้ import กลับเข้ามาได้ตรงหมวดเดิมแม้ชื่อซ้ำกัน
+func catalogRecordOf(b *entity.Book) CatalogRecord {
+	rec := CatalogRecord{
+		ID:            b.ID,
+		UpdatedAt:     b.UpdatedAt,
+		Isbn:          b.Isbn,
+		Title:         b.Title,
+		TotalPage:     b.TotalPage,
+		PublishedYear: b.PublishedYear,
+		Synopsis:      b.Synopsis,
+		CoverImage:    b.CoverImage,
+		EbookFile:     b.EbookFile,
+		Authors:       make([]string, 0, len(b.Authors)),
+		Categories:    make([]string, 0, len(b.Categories)),
+	}
+	for _, a := range b.Authors {
+		rec.Authors = append(rec.Authors, a.AuthorName)
+	}
+	for _, c := range b.Categories {
+		rec.Categories = append(rec.Categories, c.CategoryCode)
+		rec.categoryNames = append(rec.categoryNames, c.CategoryName)
+	}
+	if b.Publisher != nil {
+		rec.Publisher = b.Publisher.PublisherName
+	}
+	if b.Language != nil {
+		rec.Language = b.Language.Name
+	}
+	if b.FileType != nil {
+		rec.FileType = b.FileType.TypeName
+	}
+	return rec
+}
+
+// catalogIsbn ตัดขีด ช่องว่าง และคำขยายท้ายแบบ MARC เช่น "978-0-306-40615-7 (pbk.)"
+func catalogIsbn(v string) string {
+	if i := strings.Index(v, "("); i >= 0 {
+		v = v[:i]
+	}
+	v = strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(v))
+	return strings.ToUpper(v)
+}
+
+// splitCatalogList แยกค่าที่คั่นด้วย | (ช่องว่าง = nil คือไม่ระบุ)
+func splitCatalogList(v string) []string {
+	if strings.TrimSpace(v) == "" {
+		return nil
+	}
+	return uniqueCatalogNames(strings.Split(v, catalogListSeparator))
+}
+
+// uniqueCatalogNames รวมช่องว่าง ตัดค่าว่างและชื่อซ้ำ (ไม่สนตัวพิมพ์) โดยคงลำดับเดิม
+func uniqueCatalogNames(names []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.Join(strings.Fields(name), " ")
+		if name == "" || seen[matchName(name)] {
+			continue
+		}
+		seen[matchName(name)] = true
+		out = append(out, name)
+	}
+	return out
+}
+
+type catalogCSVReader struct {
+	cr  *csv.Reader
+	col map[string]int
+}
+
+func newCatalogCSVReader(r io.Reader) (*catalogCSVReader, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, ErrCatalogImportEmpty
+		}
+		return nil, err
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		col[h] = i
+	}
+	if _, ok := col["isbn"]; !ok {
+		return nil, ErrCatalogImportHeader
+	}
+	return &catalogCSVReader{cr: cr, col: col}, nil
+}
+
+func (c *catalogCSVReader) field(rec []string, name string) string {
+	i, ok := c.col[name]
+	if !ok || i >= len(rec) {
+		return ""
+	}
+	return strings.TrimSpace(rec[i])
+}
+
+func (c *catalogCSVReader) Next() (int, *CatalogRecord, []string, error) {
+	for {
+		rec, err := c.cr.Read()
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				return perr.StartLine, nil, []string{perr.Err.Error()}, nil
+			}
+			return 0, nil, nil, err
+		}
+		if isBlankRecord(rec) {
+			continue
+		}
+		line, _ := c.cr.FieldPos(0)
+
+		var errs []string
+		number := func(name string) uint {
+			v := c.field(rec, name)
+			if v == "" {
+				return 0
+			}
+			n, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s %q is not a number", name, v))
+			}
+			return uint(n)
+		}
+		out := &CatalogRecord{
+			Isbn:          catalogIsbn(c.field(rec, "isbn")),
+			Title:         c.field(rec, "title"),
+			TotalPage:     number("total_page"),
+			PublishedYear: number("published_year"),
+			Synopsis:      c.field(rec, "synopsis"),
+			Authors:       splitCatalogList(c.field(rec, "authors")),
+			Categories:    splitCatalogList(c.field(rec, "categories")),
+			Publisher:     c.field(rec, "publisher"),
+			Language:      c.field(rec, "language"),
+			FileType:      c.field(rec, "file_type"),
+			CoverImage:    c.field(rec, "cover_image"),
+			EbookFile:     c.field(rec, "ebook_file"),
+		}
+		return line, out, errs, nil
+	}
+}
+
+type catalogCSVWriter struct{ cw *csv.Writer }
+
+func newCatalogCSVWriter(w io.Writer) (*catalogCSVWriter, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(catalogCSVColumns); err != nil {
+		return nil, err
+	}
+	return &catalogCSVWriter{cw: cw}, nil
+}
+
+func (c *catalogCSVWriter) Write(rec *CatalogRecord) error {
+	number := func(n uint) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.FormatUint(uint64(n), 10)
+	}
+	return c.cw.Write([]string{
+		strconv.FormatUint(uint64(rec.ID), 10),
+		rec.Isbn,
+		rec.Title,
+		strings.Join(rec.Authors, catalogListSeparator),
+		strings.Join(rec.Categories, catalogListSeparator),
+		rec.Publisher,
+		rec.Language,
+		rec.FileType,
+		number(rec.TotalPage),
+		number(rec.PublishedYear),
+		rec.Synopsis,
+		rec.CoverImage,
+		rec.EbookFile,
+		rec.UpdatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+	})
+}
+
+func (c *catalogCSVWriter) Flush() error {
+	c.cw.Flush()
+	return c.cw.Error()
+}
+
+func (c *catalogCSVWriter) Close() error { return c.Flush() }
@@ -0,0 +1,623 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// รูปแบบไฟล์ import/export แค็ตตาล็อก
+const (
+	CatalogFormatCSV  = "csv"
+	CatalogFormatJSON = "json" // MARC-in-JSON (leader + fields ตาม tag ของ MARC 21)
+)
+
+// MaxCatalogImportRows จำนวนหนังสือสูงสุดต่อไฟล์
+const MaxCatalogImportRows = 5000
+
+var (
+	ErrCatalogFormat          = errors.New("format must be \"csv\" or \"json\"")
+	ErrCatalogImportHeader    = errors.New("csv header must include isbn")
+	ErrCatalogImportEmpty     = errors.New("file has no records")
+	ErrCatalogImportTooLarge  = fmt.Errorf("file has more than %d records", MaxCatalogImportRows)
+	ErrCatalogImportMalformed = errors.New("file is not valid MARC-in-JSON")
+	ErrCatalogImportHasErrors = errors.New("some records are invalid, nothing was imported")
+)
+
+// isbnPattern ISBN-10/13 ที่ตัดขีดแล้ว (ไม่ตรวจ check digit เพราะข้อมูลเดิมบางเล่มใช้เลขภายใน)
+var isbnPattern = regexp.MustCompile(`^[0-9]{9,12}[0-9X]$`)
+
+// CatalogRecord หนังสือหนึ่งเล่มในไฟล์ import/export อ้างถึงข้อมูลอ้างอิงด้วยชื่อแทน id
+// ค่าว่าง / 0 / nil = ไม่ระบุ: ตอนปรับปรุงเล่มที่มีอยู่จะคงค่าเดิมไว้
+type CatalogRecord struct {
+	ID            uint
+	UpdatedAt     time.Time
+	Isbn          string
+	Title         string
+	TotalPage     uint
+	PublishedYear uint
+	Synopsis      string
+	Authors       []string // ระบุแล้วจะแทนที่ผู้แต่งเดิมทั้งหมด
+	Categories    []string // รหัสหรือชื่อหมวดหมู่ ระบุแล้วจะแทนที่หมวดหมู่เดิมทั้งหมด
+	Publisher     string
+	Language      string // ชื่อหรือรหัส (th, tha, en-US)
+	FileType      string
+	CoverImage    string // key ใน Storage หรือ URL ภายนอก
+	EbookFile     string
+
+	categoryNames []string // ชื่อของ Categories ตามลำดับ (ใช้ตอน export เท่านั้น)
+}
+
+// catalogReader อ่านทีละ record คืน io.EOF เมื่อหมดไฟล์
+// errs คือข้อผิดพลาดของ record นั้น (อ่านต่อได้) ส่วน err ทำให้หยุดอ่านทั้งไฟล์
+type catalogReader interface {
+	Next() (line int, rec *CatalogRecord, errs []string, err error)
+}
+
+type ImportCatalogInput struct {
+	Format string // CatalogFormatCSV หรือ CatalogFormatJSON
+	DryRun bool
+	UserID string // admin ที่ import ใช้เป็นเจ้าของหนังสือและหมวดหมู่ที่สร้างใหม่
+}
+
+// CatalogImportRow ผลของหนึ่ง record
+// Line คือบรรทัดใน CSV (หัวตาราง = 1) หรือลำดับ record ใน JSON (เริ่มที่ 1)
+type CatalogImportRow struct {
+	Line     int      `json:"line"`
+	Isbn     string   `json:"isbn"`
+	Title    string   `json:"title"`
+	BookID   uint     `json:"book_id,omitempty"`
+	Action   string   `json:"action,omitempty"` // "create" | "update"
+	Status   string   `json:"status"`           // "valid" | "invalid" | "created" | "updated"
+	New      []string `json:"new,omitempty"`    // ข้อมูลอ้างอิงที่จะถูกสร้างใหม่ เช่น "author: ..."
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type CatalogImportResult struct {
+	DryRun  bool               `json:"dry_run"`
+	Format  string             `json:"format"`
+	Total   int                `json:"total"`
+	Valid   int                `json:"valid"`
+	Invalid int                `json:"invalid"`
+	Created int                `json:"created"`
+	Updated int                `json:"updated"`
+	Rows    []CatalogImportRow `json:"rows"`
+}
+
+// CatalogTransferService นำเข้า/ส่งออกแค็ตตาล็อกทั้งหมดเป็น CSV หรือ MARC-in-JSON
+type CatalogTransferService struct {
+	DB    *gorm.DB
+	Store Storage
+}
+
+// catalogImportRow record ที่ผ่านการตรวจ index ชี้ไปยังผลใน CatalogImportResult.Rows
+type catalogImportRow struct {
+	index int
+	rec   CatalogRecord
+}
+
+func newCatalogReader(r io.Reader, format string) (catalogReader, error) {
+	switch format {
+	case CatalogFormatCSV:
+		return newCatalogCSVReader(r)
+	case CatalogFormatJSON:
+		return newMarcJSONReader(r)
+	}
+	return nil, ErrCatalogFormat
+}
+
+// Import นำเข้าหนังสือโดย upsert ตาม Isbn ตรวจทุก record ก่อนเสมอ
+// DryRun = ตรวจอย่างเดียว; โหมดจริงจะบันทึกทั้งหมดใน transaction เดียว และไม่บันทึกเลยถ้ามี record ที่ผิด
+func (s *CatalogTransferService) Import(r io.Reader, in ImportCatalogInput) (*CatalogImportResult, error) {
+	cr, err := newCatalogReader(r, in.Format)
+	if err != nil {
+		return nil, err
+	}
+	rows, out, err := s.validateImport(cr)
+	if err != nil {
+		return nil, err
+	}
+	out.DryRun = in.DryRun
+	out.Format = in.Format
+	if in.DryRun {
+		return out, nil
+	}
+	if out.Invalid > 0 {
+		return out, ErrCatalogImportHasErrors
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		lookups := newCatalogLookups(tx, true, in.UserID)
+		var bookIDs, categoryIDs []uint
+		for _, row := range rows {
+			res := &out.Rows[row.index]
+			oldCategories, err := s.applyRecord(tx, lookups, &row.rec, in.UserID, res)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", res.Line, err)
+			}
+			bookIDs = append(bookIDs, res.BookID)
+			categoryIDs = append(categoryIDs, oldCategories...)
+		}
+		// ผู้แต่ง/หมวดหมู่ที่เปลี่ยนไม่ได้เลื่อน UpdatedAt ของหนังสือเอง
+		if err := TouchBooks(tx, bookIDs...); err != nil {
+			return err
+		}
+		if err := SyncUploadReferences(tx, UploadOwnerBook, bookIDs...); err != nil {
+			return err
+		}
+		// หมวดหมู่เดิมของเล่มที่ถูกแทนที่หมวดหมู่ต้องนับใหม่ด้วย
+		if err := SyncCategoryStatics(tx, categoryIDs...); err != nil {
+			return err
+		}
+		return SyncBookCategoryStatics(tx, bookIDs...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		res := &out.Rows[row.index]
+		if res.Action == "create" {
+			res.Status = "created"
+			out.Created++
+		} else {
+			res.Status = "updated"
+			out.Updated++
+		}
+	}
+	return out, nil
+}
+
+// validateImport อ่านทุก record และตรวจกับข้อมูลในฐานข้อมูล (อ่านอย่างเดียว) และ record อื่นในไฟล์เดียวกัน
+func (s *CatalogTransferService) validateImport(cr catalogReader) ([]catalogImportRow, *CatalogImportResult, error) {
+	lookups := newCatalogLookups(s.DB, false, "")
+	out := &CatalogImportResult{}
+	var rows []catalogImportRow
+	seenIsbn := map[string]int{}
+	for {
+		line, rec, errs, err := cr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		out.Total++
+		if out.Total > MaxCatalogImportRows {
+			return nil, nil, ErrCatalogImportTooLarge
+		}
+		res := CatalogImportRow{Line: line, Errors: errs}
+		if rec == nil {
+			res.Status = "invalid"
+			out.Rows = append(out.Rows, res)
+			out.Invalid++
+			continue
+		}
+		res.Isbn, res.Title = rec.Isbn, rec.Title
+
+		if rec.Isbn == "" {
+			res.Errors = append(res.Errors, "isbn is required")
+		} else if !isbnPattern.MatchString(rec.Isbn) {
+			res.Errors = append(res.Errors, fmt.Sprintf("isbn %q is invalid", rec.Isbn))
+		} else if prev, ok := seenIsbn[rec.Isbn]; ok {
+			res.Errors = append(res.Errors, fmt.Sprintf("isbn duplicates line %d", prev))
+		} else {
+			seenIsbn[rec.Isbn] = line
+		}
+		if rec.PublishedYear > 9999 {
+			res.Errors = append(res.Errors, "published_year is invalid")
+		}
+
+		var existing entity.Book
+		if isbnPattern.MatchString(rec.Isbn) {
+			// Isbn เป็น unique รวมหนังสือที่ถูกลบแบบ soft delete ด้วย
+			if err := s.DB.Unscoped().Where("isbn = ?", rec.Isbn).Limit(1).Find(&existing).Error; err != nil {
+				return nil, nil, err
+			}
+		}
+		if existing.ID == 0 {
+			res.Action = "create"
+			if rec.Title == "" {
+				res.Errors = append(res.Errors, "title is required for a new book")
+			}
+		} else {
+			res.Action = "update"
+			res.BookID = existing.ID
+			if res.Title == "" {
+				res.Title = existing.Title
+			}
+			if existing.DeletedAt.Valid {
+				res.Warnings = append(res.Warnings, fmt.Sprintf("book %d was deleted and will be restored", existing.ID))
+			}
+		}
+
+		if rec.CoverImage != "" && !isExternalURL(rec.CoverImage) {
+			if msg, err := s.checkStoredFile("cover_image", rec.CoverImage, coverKeyPrefix); err != nil {
+				return nil, nil, err
+			} else if msg != "" {
+				res.Errors = append(res.Errors, msg)
+			}
+		}
+		if rec.EbookFile != "" {
+			if msg, err := s.checkStoredFile("ebook_file", rec.EbookFile, ebookKeyPrefix); err != nil {
+				return nil, nil, err
+			} else if msg != "" {
+				res.Errors = append(res.Errors, msg)
+			}
+		}
+
+		if err := lookups.check(rec, &res); err != nil {
+			return nil, nil, err
+		}
+		if res.Action == "create" {
+			for _, f := range []struct{ name, value string }{
+				{"publisher", rec.Publisher}, {"language", rec.Language}, {"file_type", rec.FileType},
+			} {
+				if f.value == "" {
+					res.Errors = append(res.Errors, f.name+" is required for a new book")
+				}
+			}
+		}
+
+		if len(res.Errors) > 0 {
+			res.Status = "invalid"
+			out.Invalid++
+		} else {
+			res.Status = "valid"
+			out.Valid++
+		}
+		out.Rows = append(out.Rows, res)
+		if res.Status == "valid" {
+			rows = append(rows, catalogImportRow{index: len(out.Rows) - 1, rec: *rec})
+		}
+	}
+	if out.Total == 0 {
+		return nil, nil, ErrCatalogImportEmpty
+	}
+	return rows, out, nil
+}
+
+func isExternalURL(v string) bool {
+	return strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://")
+}
+
+// checkStoredFile ตรวจว่า key อยู่ใต้ prefix ที่ถูกต้องและมีไฟล์อยู่จริงใน Storage คืนข้อความผิดพลาดของ record
+func (s *CatalogTransferService) checkStoredFile(field, key, prefix string) (string, error) {
+	if _, err := cleanKey(key); err != nil || !strings.HasPrefix(key, prefix) {
+		return fmt.Sprintf("%s must be a storage key under %s", field, prefix), nil
+	}
+	ok, err := storedObjectExists(s.Store, key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return fmt.Sprintf("%s %s not found in storage", field, key), nil
+	}
+	return "", nil
+}
+
+// applyRecord สร้างหรือปรับปรุงหนังสือของ record หนึ่งเล่ม คืนหมวดหมู่เดิมที่ถูกแทนที่
+func (s *CatalogTransferService) applyRecord(tx *gorm.DB, lookups *catalogLookups, rec *CatalogRecord, userID string, res *CatalogImportRow) ([]uint, error) {
+	var book entity.Book
+	if err := tx.Unscoped().Where("isbn = ?", rec.Isbn).Limit(1).Find(&book).Error; err != nil {
+		return nil, err
+	}
+
+	updates := map[string]any{}
+	set := func(column string, value any, given bool) {
+		if given {
+			updates[column] = value
+		}
+	}
+	set("title", rec.Title, rec.Title != "")
+	set("total_page", rec.TotalPage, rec.TotalPage != 0)
+	set("published_year", rec.PublishedYear, rec.PublishedYear != 0)
+	set("synopsis", rec.Synopsis, rec.Synopsis != "")
+	set("ebook_file", rec.EbookFile, rec.EbookFile != "")
+	for _, f := range []struct {
+		column string
+		value  string
+		find   func(string) (uint, string, error)
+	}{
+		{"publisher_id", rec.Publisher, lookups.publisher},
+		{"language_id", rec.Language, lookups.language},
+		{"file_type_id", rec.FileType, lookups.fileType},
+	} {
+		if f.value == "" {
+			continue
+		}
+		id, _, err := f.find(f.value)
+		if err != nil {
+			return nil, err
+		}
+		updates[f.column] = id
+	}
+	// เปลี่ยนปก: สร้างภาพย่อใหม่ (ปกภายนอกจะล้างภาพย่อเดิมเป็นค่าว่าง)
+	if rec.CoverImage != "" && rec.CoverImage != book.CoverImage {
+		cover := entity.Book{CoverImage: rec.CoverImage}
+		if err := ApplyCoverThumbnails(s.Store, &cover); err != nil {
+			return nil, err
+		}
+		updates["cover_image"] = cover.CoverImage
+		updates["cover_small"] = cover.CoverSmall
+		updates["cover_medium"] = cover.CoverMedium
+		updates["cover_large"] = cover.CoverLarge
+	}
+
+	if book.ID == 0 {
+		// ผ่านการตรวจแล้วว่าเล่มใหม่มี title, publisher, language และ file_type ครบ
+		book = entity.Book{
+			Isbn:          rec.Isbn,
+			Title:         rec.Title,
+			TotalPage:     rec.TotalPage,
+			PublishedYear: rec.PublishedYear,
+			Synopsis:      rec.Synopsis,
+			EbookFile:     rec.EbookFile,
+			PublisherID:   updates["publisher_id"].(uint),
+			LanguageID:    updates["language_id"].(uint),
+			FileTypeID:    updates["file_type_id"].(uint),
+			UserID:        userID,
+		}
+		if v, ok := updates["cover_image"].(string); ok {
+			book.CoverImage = v
+			book.CoverSmall = updates["cover_small"].(string)
+			book.CoverMedium = updates["cover_medium"].(string)
+			book.CoverLarge = updates["cover_large"].(string)
+		}
+		if err := tx.Omit(clause.Associations).Create(&book).Error; err != nil {
+			return nil, err
+		}
+	} else {
+		if book.DeletedAt.Valid {
+			updates["deleted_at"] = nil
+		}
+		if len(updates) > 0 {
+			if err := tx.Unscoped().Model(&entity.Book{}).Where("id = ?", book.ID).Updates(updates).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+	res.BookID = book.ID
+
+	if rec.Authors != nil {
+		if err := tx.Exec("DELETE FROM book_author WHERE book_id = ?", book.ID).Error; err != nil {
+			return nil, err
+		}
+		for _, name := range rec.Authors {
+			id, _, err := lookups.author(name)
+			if err != nil {
+				return nil, err
+			}
+			if err := tx.Exec("INSERT INTO book_author (book_id, author_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
+				book.ID, id).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var before []uint
+	if rec.Categories != nil {
+		if err := tx.Table("category_book").Where("book_id = ?", book.ID).Pluck("category_id", &before).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Exec("DELETE FROM category_book WHERE book_id = ?", book.ID).Error; err != nil {
+			return nil, err
+		}
+		for _, entry := range rec.Categories {
+			id, _, err := lookups.category(entry)
+			if err != nil {
+				return nil, err
+			}
+			if err := tx.Exec("INSERT INTO category_book (book_id, category_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
+				book.ID, id).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+	return before, nil
+}
+
+// catalogLookups หาข้อมูลอ้างอิงตามชื่อ จำผลไว้เพื่อไม่ query ชื่อเดิมซ้ำ
+// create = false (ตอนตรวจ) คืน id 0 พร้อมชื่อที่จะใช้สร้างสำหรับแถวที่ยังไม่มี
+type catalogLookups struct {
+	tx     *gorm.DB
+	create bool
+	userID string
+	cache  map[string]catalogLookup
+}
+
+type catalogLookup struct {
+	id   uint
+	name string
+}
+
+func newCatalogLookups(tx *gorm.DB, create bool, userID string) *catalogLookups {
+	return &catalogLookups{tx: tx, create: create, userID: userID, cache: map[string]catalogLookup{}}
+}
+
+// resolve หาใน cache ก่อน แล้ว find; ไม่พบและ create = true จึงเรียก insert สร้างแถวใหม่
+func (l *catalogLookups) resolve(kind, value string, find func() (uint, string, error), insert func(name string) (uint, error)) (uint, string, error) {
+	key := kind + "\x00" + matchName(value)
+	if v, ok := l.cache[key]; ok {
+		return v.id, v.name, nil
+	}
+	id, name, err := find()
+	if err != nil {
+		return 0, "", err
+	}
+	if id == 0 && l.create {
+		if id, err = insert(name); err != nil {
+			return 0, "", err
+		}
+	}
+	l.cache[key] = catalogLookup{id: id, name: name}
+	return id, name, nil
+}
+
+func (l *catalogLookups) publisher(name string) (uint, string, error) {
+	return l.resolve("publisher", name, func() (uint, string, error) {
+		p, err := lookupPublisher(l.tx, name)
+		if err != nil || p == nil {
+			return 0, strings.Join(strings.Fields(name), " "), err
+		}
+		return p.ID, p.PublisherName, nil
+	}, func(name string) (uint, error) {
+		p := entity.Publishers{PublisherName: name}
+		err := l.tx.Create(&p).Error
+		return p.ID, err
+	})
+}
+
+func (l *catalogLookups) language(value string) (uint, string, error) {
+	return l.resolve("language", value, func() (uint, string, error) {
+		lang, name, err := lookupLanguage(l.tx, value)
+		if err != nil || lang == nil {
+			return 0, name, err
+		}
+		return lang.ID, lang.Name, nil
+	}, func(name string) (uint, error) {
+		lang := entity.Languages{Name: name}
+		err := l.tx.Create(&lang).Error
+		return lang.ID, err
+	})
+}
+
+func (l *catalogLookups) fileType(value string) (uint, string, error) {
+	return l.resolve("file_type", value, func() (uint, string, error) {
+		ft, err := lookupFileType(l.tx, value)
+		if err != nil || ft == nil {
+			return 0, fileTypeName(value), err
+		}
+		return ft.ID, ft.TypeName, nil
+	}, func(name string) (uint, error) {
+		ft := entity.FileTypes{TypeName: name}
+		err := l.tx.Create(&ft).Error
+		return ft.ID, err
+	})
+}
+
+func (l *catalogLookups) author(name string) (uint, string, error) {
+	return l.resolve("author", name, func() (uint, string, error) {
+		a, err := lookupAuthor(l.tx, name)
+		if err != nil || a == nil {
+			return 0, strings.Join(strings.Fields(name), " "), err
+		}
+		return a.ID, a.AuthorName, nil
+	}, func(name string) (uint, error) {
+		a := entity.Author{AuthorName: name}
+		err := l.tx.Create(&a).Error
+		return a.ID, err
+	})
+}
+
+// category หาหมวดหมู่ตามรหัสก่อนแล้วจึงตามชื่อ
+// หมวดหมู่ใหม่ใช้ค่าที่ให้มาเป็นรหัสถ้าเป็นรหัสที่ถูกต้อง ไม่เช่นนั้นสร้างรหัสจากชื่อ
+func (l *catalogLookups) category(entry string) (uint, string, error) {
+	return l.resolve("category", entry, func() (uint, string, error) {
+		var cat entity.Category
+		q := l.tx.Where("LOWER(TRIM(category_name)) = ?", matchName(entry))
+		if code, err := normalizeCategoryCode(entry); err == nil {
+			q = l.tx.Where("category_code = ?", code).Or(q)
+		}
+		if err := q.Order("id").Limit(1).Find(&cat).Error; err != nil {
+			return 0, "", err
+		}
+		if cat.ID == 0 {
+			return 0, strings.Join(strings.Fields(entry), " "), nil
+		}
+		return cat.ID, cat.CategoryName, nil
+	}, func(name string) (uint, error) {
+		code, err := l.newCategoryCode(name)
+		if err != nil {
+			return 0, err
+		}
+		st := entity.CategoryStatics{LastUpdate: time.Now()}
+		if err := l.tx.Omit(clause.Associations).Create(&st).Error; err != nil {
+			return 0, err
+		}
+		cat := entity.Category{
+			CategoryName:      name,
+			CategoryCode:      code,
+			UserID:            l.userID,
+			CategoryStaticsID: &st.ID,
+		}
+		err = l.tx.Omit(clause.Associations).Create(&cat).Error
+		return cat.ID, err
+	})
+}
+
+// newCategoryCode รหัสของหมวดหมู่ใหม่ เช่น "SCI-FI" ใช้ตรง ๆ ส่วน "นิยายแฟนตาซี" ได้ C + hash ของชื่อ
+// ต่อท้ายด้วยลำดับถ้ารหัสถูกใช้แล้ว
+func (l *catalogLookups) newCategoryCode(name string) (string, error) {
+	base, err := normalizeCategoryCode(name)
+	if err != nil {
+		h := fnv.New32a()
+		h.Write([]byte(matchName(name)))
+		base = fmt.Sprintf("C%08X", h.Sum32())
+	}
+	code := base
+	for i := 2; ; i++ {
+		err := ensureCategoryCodeFree(l.tx, code, 0)
+		if err == nil {
+			return code, nil
+		}
+		if !errors.Is(err, ErrCategoryCodeTaken) {
+			return "", err
+		}
+		code = fmt.Sprintf("%s-%d", base, i)
+		if len(code) > 32 {
+			code = fmt.Sprintf("%s-%d", base[:32-len(fmt.Sprint(i))-1], i)
+		}
+	}
+}
+
+// check หาข้อมูลอ้างอิงทั้งหมดของ record แล้วบันทึกสิ่งที่จะถูกสร้างใหม่ลง res.New
+func (l *catalogLookups) check(rec *CatalogRecord, res *CatalogImportRow) error {
+	note := func(kind string, id uint, name string) {
+		if id == 0 {
+			res.New = append(res.New, kind+": "+name)
+		}
+	}
+	for _, f := range []struct {
+		kind  string
+		value string
+		find  func(string) (uint, string, error)
+	}{
+		{"publisher", rec.Publisher, l.publisher},
+		{"language", rec.Language, l.language},
+		{"file_type", rec.FileType, l.fileType},
+	} {
+		if f.value == "" {
+			continue
+		}
+		id, name, err := f.find(f.value)
+		if err != nil {
+			return err
+		}
+		note(f.kind, id, name)
+	}
+	for _, name := range rec.Authors {
+		id, n, err := l.author(name)
+		if err != nil {
+			return err
+		}
+		note("author", id, n)
+	}
+	for _, entry := range rec.Categories {
+		id, n, err := l.category(entry)
+		if err != nil {
+			return err
+		}
+		note("category", id, n)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// marcLeader leader ของ record ที่ export: ข้อมูลภาษา (a) ประเภทหนังสือเล่ม (m) ใช้ Unicode (a)
+const marcLeader = "00000nam a2200000 i 4500"
+
+// MARC-in-JSON: {"leader": "...", "fields": [{"001": "12"}, {"245": {"ind1": "0", "ind2": "0", "subfields": [{"a": "..."}]}}]}
+// tag ที่ใช้:
+//
+//	001 id (export เท่านั้น)    005 เวลาที่แก้ไขล่าสุด (export เท่านั้น)
+//	020 $a ISBN                 041 $a ภาษา (ISO 639-2 หรือชื่อ)
+//	100 $a ผู้แต่งคนแรก          700 $a ผู้แต่งคนถัดไป
+//	245 $a ชื่อเรื่อง $b ชื่อรอง   264 (หรือ 260) $b สำนักพิมพ์ $c ปีที่พิมพ์
+//	300 $a จำนวนหน้า เช่น "320 pages"
+//	347 $b ชนิดไฟล์ (epub, pdf)   520 $a เรื่องย่อ
+//	650 $a ชื่อหมวดหมู่ $0 รหัสหมวดหมู่
+//	856 $3 "cover" หรือ "ebook" $u key ใน Storage หรือ URL $q content type
+var (
+	marcPagesRe  = regexp.MustCompile(`(\d+)\s*(?:p\b|pages?|หน้า)`)
+	marcNumberRe = regexp.MustCompile(`(\d+)`)
+)
+
+type marcRecord struct {
+	Leader string                       `json:"leader"`
+	Fields []map[string]json.RawMessage `json:"fields"`
+}
+
+type marcDataField struct {
+	Ind1      string              `json:"ind1"`
+	Ind2      string              `json:"ind2"`
+	Subfields []map[string]string `json:"subfields"`
+}
+
+// subfield ค่าแรกของ subfield code ที่ไม่ว่าง ตัดเครื่องหมายวรรคตอนท้ายแบบ ISBD ( / : ; , =) ออก
+func (f *marcDataField) subfield(code string) string {
+	for _, sf := range f.Subfields {
+		if v := strings.TrimSpace(sf[code]); v != "" {
+			return strings.TrimSpace(strings.TrimRight(v, " /:;,="))
+		}
+	}
+	return ""
+}
+
+type marcJSONReader struct {
+	dec *json.Decoder
+	n   int
+}
+
+func newMarcJSONReader(r io.Reader) (*marcJSONReader, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			return nil, ErrCatalogImportEmpty
+		}
+		return nil, fmt.Errorf("%w: %v", ErrCatalogImportMalformed, err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return nil, fmt.Errorf("%w: expected an array of records", ErrCatalogImportMalformed)
+	}
+	return &marcJSONReader{dec: dec}, nil
+}
+
+// Next อ่าน record ถัดไป JSON ที่ผิดรูปแบบทำให้อ่านต่อไม่ได้จึงหยุดทั้งไฟล์
+// ส่วน field ที่ผิด (เช่น tag ซ้ำหลายตัวใน object เดียว) เป็นข้อผิดพลาดของ record นั้น
+func (m *marcJSONReader) Next() (int, *CatalogRecord, []string, error) {
+	if !m.dec.More() {
+		if _, err := m.dec.Token(); err != nil {
+			return 0, nil, nil, fmt.Errorf("%w: %v", ErrCatalogImportMalformed, err)
+		}
+		return 0, nil, nil, io.EOF
+	}
+	m.n++
+	var mr marcRecord
+	if err := m.dec.Decode(&mr); err != nil {
+		return 0, nil, nil, fmt.Errorf("%w: record %d: %v", ErrCatalogImportMalformed, m.n, err)
+	}
+
+	rec := &CatalogRecord{}
+	var errs []string
+	for i, f := range mr.Fields {
+		if len(f) != 1 {
+			errs = append(errs, fmt.Sprintf("field %d must have exactly one tag", i+1))
+			continue
+		}
+		for tag, raw := range f {
+			if strings.HasPrefix(tag, "00") {
+				var v string
+				if err := json.Unmarshal(raw, &v); err != nil {
+					errs = append(errs, fmt.Sprintf("control field %s must be a string", tag))
+				}
+				if tag == "001" {
+					if id, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64); err == nil {
+						rec.ID = uint(id)
+					}
+				}
+				continue
+			}
+			var df marcDataField
+			if err := json.Unmarshal(raw, &df); err != nil {
+				errs = append(errs, fmt.Sprintf("data field %s: %v", tag, err))
+				continue
+			}
+			applyMarcField(rec, tag, &df, &errs)
+		}
+	}
+	if rec.Authors != nil {
+		rec.Authors = uniqueCatalogNames(rec.Authors)
+	}
+	if rec.Categories != nil {
+		rec.Categories = uniqueCatalogNames(rec.Categories)
+	}
+	return m.n, rec, errs, nil
+}
+
+// applyMarcField ใส่ค่าจาก data field หนึ่งตัวลง record (tag ที่ไม่รู้จักจะถูกข้าม)
+func applyMarcField(rec *CatalogRecord, tag string, f *marcDataField, errs *[]string) {
+	switch tag {
+	case "020":
+		if rec.Isbn == "" {
+			rec.Isbn = catalogIsbn(f.subfield("a"))
+		}
+	case "041":
+		rec.Language = f.subfield("a")
+	case "100", "700":
+		if name := f.subfield("a"); name != "" {
+			rec.Authors = append(rec.Authors, name)
+		}
+	case "245":
+		rec.Title = f.subfield("a")
+		if sub := f.subfield("b"); sub != "" {
+			rec.Title += ": " + sub
+		}
+	case "260", "264":
+		if v := f.subfield("b"); v != "" {
+			rec.Publisher = v
+		}
+		if v := f.subfield("c"); v != "" {
+			if rec.PublishedYear = leadingYear(v); rec.PublishedYear == 0 {
+				*errs = append(*errs, fmt.Sprintf("%s$c %q has no year", tag, v))
+			}
+		}
+	case "300":
+		if v := f.subfield("a"); v != "" {
+			// "320 pages", "xii, 210 p.", "1 online resource (88 หน้า)": ใช้ตัวเลขหน้าคำว่าหน้าก่อน
+			m := marcPagesRe.FindStringSubmatch(v)
+			if m == nil {
+				m = marcNumberRe.FindStringSubmatch(v)
+			}
+			if m == nil {
+				*errs = append(*errs, fmt.Sprintf("300$a %q has no page count", v))
+				break
+			}
+			n, _ := strconv.ParseUint(m[1], 10, 32)
+			rec.TotalPage = uint(n)
+		}
+	case "347":
+		rec.FileType = f.subfield("b")
+	case "520":
+		rec.Synopsis = f.subfield("a")
+	case "650":
+		entry := f.subfield("0")
+		if entry == "" {
+			entry = f.subfield("a")
+		}
+		if entry != "" {
+			rec.Categories = append(rec.Categories, entry)
+		}
+	case "856":
+		switch strings.ToLower(f.subfield("3")) {
+		case "cover":
+			rec.CoverImage = f.subfield("u")
+		case "ebook", "":
+			rec.EbookFile = f.subfield("u")
+		}
+	}
+}
+
+type marcJSONWriter struct {
+	w io.Writer
+	n int
+}
+
+func marcField(tag, ind1, ind2 string, subfields ...string) map[string]any {
+	df := marcDataField{Ind1: ind1, Ind2: ind2}
+	for i := 0; i+1 < len(subfields); i += 2 {
+		if subfields[i+1] != "" {
+			df.Subfields = append(df.Subfields, map[string]string{subfields[i]: subfields[i+1]})
+		}
+	}
+	return map[string]any{tag: df}
+}
+
+// marcRecordOf แปลง CatalogRecord เป็น MARC-in-JSON ตามลำดับ tag
+func marcRecordOf(rec *CatalogRecord) any {
+	fields := []map[string]any{
+		{"001": strconv.FormatUint(uint64(rec.ID), 10)},
+		{"005": rec.UpdatedAt.UTC().Format("20060102150405.0")},
+		marcField("020", " ", " ", "a", rec.Isbn),
+	}
+	if rec.Language != "" {
+		lang := rec.Language
+		if codes := languageCodesOf(lang); codes != nil {
+			lang = codes[1]
+		}
+		fields = append(fields, marcField("041", "0", " ", "a", lang))
+	}
+	if len(rec.Authors) > 0 {
+		fields = append(fields, marcField("100", "1", " ", "a", rec.Authors[0]))
+	}
+	fields = append(fields, marcField("245", "0", "0", "a", rec.Title))
+	year := ""
+	if rec.PublishedYear != 0 {
+		year = strconv.FormatUint(uint64(rec.PublishedYear), 10)
+	}
+	if rec.Publisher != "" || year != "" {
+		fields = append(fields, marcField("264", " ", "1", "b", rec.Publisher, "c", year))
+	}
+	if rec.TotalPage != 0 {
+		fields = append(fields, marcField("300", " ", " ", "a", fmt.Sprintf("%d pages", rec.TotalPage)))
+	}
+	if rec.FileType != "" {
+		fields = append(fields, marcField("347", " ", " ", "b", rec.FileType))
+	}
+	if rec.Synopsis != "" {
+		fields = append(fields, marcField("520", " ", " ", "a", rec.Synopsis))
+	}
+	for i, code := range rec.Categories {
+		name := ""
+		if i < len(rec.categoryNames) {
+			name = rec.categoryNames[i]
+		}
+		fields = append(fields, marcField("650", " ", "4", "a", name, "0", code))
+	}
+	for _, name := range rec.Authors[min(1, len(rec.Authors)):] {
+		fields = append(fields, marcField("700", "1", " ", "a", name))
+	}
+	if rec.EbookFile != "" {
+		fields = append(fields, marcField("856", "4", "0", "3", "ebook", "u", rec.EbookFile, "q", contentTypeOf(rec.EbookFile)))
+	}
+	if rec.CoverImage != "" {
+		fields = append(fields, marcField("856", "4", "2", "3", "cover", "u", rec.CoverImage))
+	}
+	return struct {
+		Leader string           `json:"leader"`
+		Fields []map[string]any `json:"fields"`
+	}{marcLeader, fields}
+}
+
+func (m *marcJSONWriter) Write(rec *CatalogRecord) error {
+	data, err := json.Marshal(marcRecordOf(rec))
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if m.n == 0 {
+		sep = "[\n"
+	}
+	m.n++
+	_, err = io.WriteString(m.w, sep+string(data))
+	return err
+}
+
+func (m *marcJSONWriter) Flush() error { return nil }
+
+func (m *marcJSONWriter) Close() error {
+	end := "\n]\n"
+	if m.n == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(m.w, end)
+	return err
+}
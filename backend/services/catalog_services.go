@@ -0,0 +1,292 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+)
+
+// ตาราง FTS5 สำหรับค้นหนังสือ rowid = books.id
+// ใช้ tokenizer แบบ trigram เพราะภาษาไทยไม่มีช่องว่างคั่นคำ จึงค้นแบบ substring ได้ทั้งไทยและอังกฤษ
+// (คำค้นที่สั้นกว่า 3 ตัวอักษรจะใช้ LIKE แทน)
+const bookSearchTable = "book_search"
+
+const trigramMinRunes = 3
+
+// น้ำหนัก bm25 ตามลำดับคอลัมน์: title, synopsis, isbn, authors, categories
+const bookSearchRank = "bm25(book_search, 10.0, 1.0, 5.0, 4.0, 3.0)"
+
+var (
+	ErrEmptySearchQuery    = errors.New("search query is required")
+	ErrFullTextUnavailable = errors.New("SQLite was built without FTS5: build with -tags sqlite_fts5 (see backend/Makefile) or set CATALOG_SEARCH_FALLBACK=like")
+)
+
+// CatalogService ค้นหาหนังสือในแคตตาล็อกด้วย SQLite FTS5 (mattn/go-sqlite3 ต้อง build ด้วย -tags sqlite_fts5)
+// ถ้า SQLite ไม่มี FTS5 จะเริ่มระบบไม่ได้ เว้นแต่ตั้ง AllowLikeSearch ไว้
+// ซึ่งจะค้นด้วย LIKE บนตารางหลักแทน ผลลัพธ์เหมือนกันแต่ไม่มีการจัดอันดับ
+type CatalogService struct {
+	DB              *gorm.DB
+	AllowLikeSearch bool
+	fts             bool
+}
+
+// BookSearchHit หนังสือหนึ่งเล่มในผลค้นหา
+type BookSearchHit struct {
+	entity.Book
+	AuthorNames string  `json:"author_names"`
+	Snippet     string  `json:"snippet,omitempty"`
+	Rank        float64 `json:"rank"`
+}
+
+type BookSearchPage struct {
+	Items    []BookSearchHit `json:"items"`
+	Total    int64           `json:"total"`
+	Page     int             `json:"page"`
+	PageSize int             `json:"page_size"`
+	FullText bool            `json:"full_text"`
+}
+
+// bookSearchRow คำสั่ง SELECT ข้อมูลที่ใช้ index ของหนังสือตามเงื่อนไข where (อ้าง books เป็น b)
+func bookSearchRow(where string) string {
+	return `SELECT b.id, b.title, COALESCE(b.synopsis, ''), b.isbn,
+	COALESCE((SELECT group_concat(a.author_name, ' ') FROM book_author ba
+		JOIN authors a ON a.id = ba.author_id AND a.deleted_at IS NULL
+		WHERE ba.book_id = b.id), ''),
+	COALESCE((SELECT group_concat(c.category_name, ' ') FROM category_book cb
+		JOIN categories c ON c.id = cb.category_id AND c.deleted_at IS NULL
+		WHERE cb.book_id = b.id), '')
+FROM books b WHERE b.deleted_at IS NULL AND ` + where
+}
+
+// reindexStatements สร้างคำสั่งลบแล้วใส่ข้อมูลใหม่ของหนังสือที่ books.id อยู่ใน idSet
+func reindexStatements(idSet string) string {
+	return fmt.Sprintf(`DELETE FROM book_search WHERE rowid IN %[1]s;
+	INSERT INTO book_search(rowid, title, synopsis, isbn, authors, categories) %[2]s;`,
+		idSet, bookSearchRow("b.id IN "+idSet))
+}
+
+// trigger ที่ทำให้ index ตรงกับข้อมูลเสมอ ไม่ว่าจะเขียนผ่าน GORM หรือ SQL ตรง
+// (รวมถึง soft delete ซึ่งเป็นการ UPDATE deleted_at)
+func bookSearchTriggers() map[string]string {
+	return map[string]string{
+		"book_search_books_ai":       "AFTER INSERT ON books BEGIN " + reindexStatements("(NEW.id)") + " END",
+		"book_search_books_au":       "AFTER UPDATE ON books BEGIN " + reindexStatements("(OLD.id, NEW.id)") + " END",
+		"book_search_books_ad":       "AFTER DELETE ON books BEGIN DELETE FROM book_search WHERE rowid = OLD.id; END",
+		"book_search_book_author_ai": "AFTER INSERT ON book_author BEGIN " + reindexStatements("(NEW.book_id)") + " END",
+		"book_search_book_author_ad": "AFTER DELETE ON book_author BEGIN " + reindexStatements("(OLD.book_id)") + " END",
+		"book_search_authors_au": "AFTER UPDATE ON authors BEGIN " +
+			reindexStatements("(SELECT book_id FROM book_author WHERE author_id = NEW.id)") + " END",
+		"book_search_authors_ad": "AFTER DELETE ON authors BEGIN " +
+			reindexStatements("(SELECT book_id FROM book_author WHERE author_id = OLD.id)") + " END",
+		"book_search_category_book_ai": "AFTER INSERT ON category_book BEGIN " + reindexStatements("(NEW.book_id)") + " END",
+		"book_search_category_book_ad": "AFTER DELETE ON category_book BEGIN " + reindexStatements("(OLD.book_id)") + " END",
+		"book_search_categories_au": "AFTER UPDATE ON categories BEGIN " +
+			reindexStatements("(SELECT book_id FROM category_book WHERE category_id = NEW.id)") + " END",
+		"book_search_categories_ad": "AFTER DELETE ON categories BEGIN " +
+			reindexStatements("(SELECT book_id FROM category_book WHERE category_id = OLD.id)") + " END",
+	}
+}
+
+// EnsureSearchIndex สร้างตาราง FTS5 และ trigger (ถ้ายังไม่มี) แล้วสร้าง index ใหม่ทั้งหมด
+// เรียกครั้งเดียวตอนเริ่มระบบหลัง AutoMigrate
+func (s *CatalogService) EnsureSearchIndex() error {
+	err := s.DB.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS book_search
+		USING fts5(title, synopsis, isbn, authors, categories, tokenize = 'trigram')`).Error
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			if !s.AllowLikeSearch {
+				return ErrFullTextUnavailable
+			}
+			log.Println("catalog: SQLite FTS5 is not available; using LIKE search (CATALOG_SEARCH_FALLBACK=like)")
+			s.fts = false
+			return nil
+		}
+		return err
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// สร้าง trigger ใหม่ทุกครั้ง เผื่อคำสั่งใน trigger ถูกแก้ไขในเวอร์ชันใหม่
+		for name, body := range bookSearchTriggers() {
+			if err := tx.Exec("DROP TRIGGER IF EXISTS " + name).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("CREATE TRIGGER " + name + " " + body).Error; err != nil {
+				return fmt.Errorf("create trigger %s: %w", name, err)
+			}
+		}
+		if err := tx.Exec("DELETE FROM book_search").Error; err != nil {
+			return err
+		}
+		return tx.Exec("INSERT INTO book_search(rowid, title, synopsis, isbn, authors, categories) " +
+			bookSearchRow("1 = 1")).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.fts = true
+	return nil
+}
+
+// FullTextEnabled บอกว่ากำลังใช้ FTS5 อยู่หรือไม่
+func (s *CatalogService) FullTextEnabled() bool {
+	return s.fts
+}
+
+// searchTerms แยกคำค้นด้วยช่องว่าง
+func searchTerms(q string) []string {
+	return strings.Fields(strings.TrimSpace(q))
+}
+
+// ftsQuote ครอบคำด้วยเครื่องหมายคำพูดเพื่อไม่ให้ตัวอักษรพิเศษถูกตีความเป็น syntax ของ FTS5
+func ftsQuote(term string) string {
+	return `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+}
+
+// likeEscape กัน % และ _ ในคำค้นไม่ให้เป็น wildcard
+func likeEscape(term string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + r.Replace(term) + "%"
+}
+
+// Search ค้นหนังสือจากชื่อ เรื่องย่อ ISBN ชื่อผู้แต่ง และชื่อหมวดหมู่ ทุกคำต้องพบ (AND)
+// เรียงตามความเกี่ยวข้อง (bm25) เมื่อใช้ FTS5
+func (s *CatalogService) Search(q string, page, pageSize int) (*BookSearchPage, error) {
+	terms := searchTerms(q)
+	if len(terms) == 0 {
+		return nil, ErrEmptySearchQuery
+	}
+	if !s.fts {
+		return s.searchLike(terms, page, pageSize)
+	}
+
+	var match []string
+	var short []string
+	for _, t := range terms {
+		if utf8.RuneCountInString(t) >= trigramMinRunes {
+			match = append(match, ftsQuote(t))
+		} else {
+			short = append(short, t)
+		}
+	}
+
+	base := s.DB.Table(bookSearchTable)
+	if len(match) > 0 {
+		base = base.Where("book_search MATCH ?", strings.Join(match, " "))
+	}
+	for _, t := range short {
+		like := likeEscape(t)
+		base = base.Where(`(title LIKE ? ESCAPE '\' OR synopsis LIKE ? ESCAPE '\' OR isbn LIKE ? ESCAPE '\'
+			OR authors LIKE ? ESCAPE '\' OR categories LIKE ? ESCAPE '\')`, like, like, like, like, like)
+	}
+
+	out := BookSearchPage{Page: page, PageSize: pageSize, FullText: true}
+	if err := base.Count(&out.Total).Error; err != nil {
+		return nil, err
+	}
+
+	type hit struct {
+		ID      uint
+		Snippet string
+		Score   float64
+	}
+	var hits []hit
+	// ตั้งชื่อ score แทน rank เพราะ rank เป็นคอลัมน์ซ่อนของ FTS5
+	sel := "rowid AS id, '' AS snippet, 0.0 AS score"
+	order := "title"
+	if len(match) > 0 {
+		sel = "rowid AS id, snippet(book_search, -1, '[', ']', '…', 16) AS snippet, " + bookSearchRank + " AS score"
+		order = "score"
+	}
+	if err := base.Select(sel).
+		Order(order).
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Scan(&hits).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+	books, err := s.loadBooks(ids)
+	if err != nil {
+		return nil, err
+	}
+	out.Items = make([]BookSearchHit, 0, len(hits))
+	for _, h := range hits {
+		b, ok := books[h.ID]
+		if !ok {
+			continue
+		}
+		out.Items = append(out.Items, BookSearchHit{
+			Book:        b,
+			AuthorNames: joinAuthorNames(b.Authors),
+			Snippet:     h.Snippet,
+			Rank:        h.Score,
+		})
+	}
+	return &out, nil
+}
+
+// searchLike ค้นแบบไม่มี FTS5: ทุกคำต้องพบในคอลัมน์ใดคอลัมน์หนึ่ง เรียงตามชื่อหนังสือ
+func (s *CatalogService) searchLike(terms []string, page, pageSize int) (*BookSearchPage, error) {
+	q := s.DB.Model(&entity.Book{})
+	for _, t := range terms {
+		like := likeEscape(t)
+		q = q.Where(`(books.title LIKE ? ESCAPE '\' OR books.synopsis LIKE ? ESCAPE '\' OR books.isbn LIKE ? ESCAPE '\'
+			OR EXISTS (SELECT 1 FROM book_author ba JOIN authors a ON a.id = ba.author_id AND a.deleted_at IS NULL
+				WHERE ba.book_id = books.id AND a.author_name LIKE ? ESCAPE '\')
+			OR EXISTS (SELECT 1 FROM category_book cb JOIN categories c ON c.id = cb.category_id AND c.deleted_at IS NULL
+				WHERE cb.book_id = books.id AND c.category_name LIKE ? ESCAPE '\'))`, like, like, like, like, like)
+	}
+
+	out := BookSearchPage{Page: page, PageSize: pageSize}
+	if err := q.Count(&out.Total).Error; err != nil {
+		return nil, err
+	}
+	var books []entity.Book
+	if err := q.Preload("Publisher").Preload("FileType").Preload("Language").Preload("Authors").
+		Order("books.title").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&books).Error; err != nil {
+		return nil, err
+	}
+	out.Items = make([]BookSearchHit, 0, len(books))
+	for _, b := range books {
+		out.Items = append(out.Items, BookSearchHit{Book: b, AuthorNames: joinAuthorNames(b.Authors)})
+	}
+	return &out, nil
+}
+
+// loadBooks โหลดหนังสือพร้อมความสัมพันธ์แบบเดียวกับ controllers.FindBookById คืนเป็น map ตาม id
+func (s *CatalogService) loadBooks(ids []uint) (map[uint]entity.Book, error) {
+	out := map[uint]entity.Book{}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	var books []entity.Book
+	if err := s.DB.Preload("Publisher").Preload("FileType").Preload("Language").Preload("Authors").
+		Where("id IN ?", ids).
+		Find(&books).Error; err != nil {
+		return nil, err
+	}
+	for _, b := range books {
+		out[b.ID] = b
+	}
+	return out, nil
+}
+
+func joinAuthorNames(authors []entity.Author) string {
+	names := make([]string, 0, len(authors))
+	for _, a := range authors {
+		names = append(names, a.AuthorName)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,442 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCategoryNotFound     = errors.New("category not found")
+	ErrCategoryNameRequired = errors.New("category_name is required")
+	ErrInvalidCategoryCode  = errors.New("category_code must be 1-32 characters of A-Z, 0-9, - or _")
+	ErrCategoryCodeTaken    = errors.New("category_code already exists")
+	ErrCategoryInUse        = errors.New("category is in use by books")
+)
+
+var categoryCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{1,32}$`)
+
+// CategoryService จัดการหมวดหมู่ และดูแล CategoryStatics.BookCount ให้ตรงกับจำนวนหนังสือจริง
+type CategoryService struct {
+	DB *gorm.DB
+}
+
+type CategoryInput struct {
+	CategoryName string
+	CategoryCode string
+	Description  string
+	ParentID     *uint // nil = หมวดหมู่ระดับบนสุด
+}
+
+// UpdateCategoryInput ฟิลด์ที่เป็น nil จะไม่ถูกแก้ไข
+// ParentID ชี้ไปที่ 0 = ย้ายขึ้นไปเป็นหมวดหมู่ระดับบนสุด
+type UpdateCategoryInput struct {
+	CategoryName *string
+	CategoryCode *string
+	Description  *string
+	ParentID     *uint
+}
+
+// normalizeCategoryCode ตัดช่องว่าง แปลงเป็นตัวพิมพ์ใหญ่ แล้วตรวจรูปแบบ
+func normalizeCategoryCode(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !categoryCodePattern.MatchString(code) {
+		return "", ErrInvalidCategoryCode
+	}
+	return code, nil
+}
+
+// ensureCategoryCodeFree ตรวจว่ารหัสหมวดหมู่ยังไม่ถูกใช้ (ยกเว้นหมวดหมู่ exceptID)
+func ensureCategoryCodeFree(tx *gorm.DB, code string, exceptID uint) error {
+	var n int64
+	if err := tx.Model(&entity.Category{}).
+		Where("category_code = ? AND id <> ?", code, exceptID).
+		Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrCategoryCodeTaken
+	}
+	return nil
+}
+
+// SyncCategoryStatics นับจำนวนหนังสือ (ที่ยังไม่ถูกลบ) ของหมวดหมู่ที่ระบุและหมวดแม่ทุกระดับใหม่ แล้วบันทึกลง CategoryStatics
+// สร้าง CategoryStatics ให้ถ้าหมวดหมู่นั้นยังไม่มี
+func SyncCategoryStatics(tx *gorm.DB, categoryIDs ...uint) error {
+	if len(categoryIDs) == 0 {
+		return nil
+	}
+	// หนังสือที่เปลี่ยนในหมวดย่อยทำให้ subtree count ของหมวดแม่ทุกระดับเปลี่ยนด้วย
+	ids, err := categoryAncestorIDs(tx, categoryIDs)
+	if err != nil {
+		return err
+	}
+	var cats []entity.Category
+	if err := tx.Where("id IN ?", ids).Find(&cats).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, cat := range cats {
+		var direct, subtree int64
+		if err := tx.Table("category_book cb").
+			Joins("JOIN books b ON b.id = cb.book_id AND b.deleted_at IS NULL").
+			Where("cb.category_id = ?", cat.ID).
+			Count(&direct).Error; err != nil {
+			return err
+		}
+		if err := tx.Table("category_book cb").
+			Joins("JOIN books b ON b.id = cb.book_id AND b.deleted_at IS NULL").
+			Where("cb.category_id IN ("+categorySubtreeSQL+")", []uint{cat.ID}).
+			Distinct("cb.book_id").
+			Count(&subtree).Error; err != nil {
+			return err
+		}
+
+		if cat.CategoryStaticsID == nil {
+			st := entity.CategoryStatics{BookCount: int(direct), SubtreeBookCount: int(subtree), LastUpdate: now}
+			if err := tx.Omit(clause.Associations).Create(&st).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&entity.Category{}).Where("id = ?", cat.ID).
+				Update("category_statics_id", st.ID).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tx.Model(&entity.CategoryStatics{}).Where("id = ?", *cat.CategoryStaticsID).
+			Updates(map[string]any{"book_count": direct, "subtree_book_count": subtree, "last_update": now}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncBookCategoryStatics นับจำนวนหนังสือใหม่ของทุกหมวดหมู่ที่ผูกกับหนังสือที่ระบุ
+// เรียกหลังสร้าง ลบ หรือแก้หมวดหมู่ของหนังสือ (หนังสือที่ soft delete แล้วก็ใช้ได้ เพราะแถวใน category_book ยังอยู่)
+func SyncBookCategoryStatics(tx *gorm.DB, bookIDs ...uint) error {
+	if len(bookIDs) == 0 {
+		return nil
+	}
+	var ids []uint
+	if err := tx.Table("category_book").
+		Where("book_id IN ?", bookIDs).
+		Distinct().
+		Pluck("category_id", &ids).Error; err != nil {
+		return err
+	}
+	return SyncCategoryStatics(tx, ids...)
+}
+
+// RecountAll นับจำนวนหนังสือของทุกหมวดหมู่ใหม่ เรียกตอนเริ่มระบบเพื่อแก้ค่าที่อาจคลาดเคลื่อน
+func (s *CategoryService) RecountAll() error {
+	var ids []uint
+	if err := s.DB.Model(&entity.Category{}).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		return SyncCategoryStatics(tx, ids...)
+	})
+}
+
+// ensureCategoryExists ตรวจว่ามีหมวดหมู่นี้อยู่
+func ensureCategoryExists(tx *gorm.DB, id uint) (*entity.Category, error) {
+	var cat entity.Category
+	if err := tx.First(&cat, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, err
+	}
+	return &cat, nil
+}
+
+// List หมวดหมู่ทั้งหมดเรียงตามรหัส (รองรับค้นจากชื่อหรือรหัสด้วย q)
+func (s *CategoryService) List(q string) ([]entity.Category, error) {
+	db := s.DB.Preload("CategoryStatics").Order("category_code")
+	if q = strings.TrimSpace(q); q != "" {
+		like := likeEscape(q)
+		db = db.Where(`category_name LIKE ? ESCAPE '\' OR category_code LIKE ? ESCAPE '\'`, like, like)
+	}
+	var cats []entity.Category
+	if err := db.Find(&cats).Error; err != nil {
+		return nil, err
+	}
+	return cats, nil
+}
+
+// Get หมวดหมู่พร้อมหมวดย่อยระดับถัดไปและ breadcrumb
+func (s *CategoryService) Get(id uint) (*CategoryDetail, error) {
+	return s.detail(s.DB, id)
+}
+
+// Create สร้างหมวดหมู่ใหม่พร้อม CategoryStatics (BookCount = 0) โดยมี userID เป็นผู้สร้าง
+func (s *CategoryService) Create(userID string, in CategoryInput) (*CategoryDetail, error) {
+	name := strings.TrimSpace(in.CategoryName)
+	if name == "" {
+		return nil, ErrCategoryNameRequired
+	}
+	code, err := normalizeCategoryCode(in.CategoryCode)
+	if err != nil {
+		return nil, err
+	}
+
+	var out *CategoryDetail
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := ensureCategoryCodeFree(tx, code, 0); err != nil {
+			return err
+		}
+		if in.ParentID != nil {
+			if _, err := ensureCategoryExists(tx, *in.ParentID); err != nil {
+				return err
+			}
+		}
+		st := entity.CategoryStatics{LastUpdate: time.Now()}
+		if err := tx.Omit(clause.Associations).Create(&st).Error; err != nil {
+			return err
+		}
+		cat := entity.Category{
+			CategoryName:      name,
+			CategoryCode:      code,
+			Description:       strings.TrimSpace(in.Description),
+			ParentID:          in.ParentID,
+			UserID:            userID,
+			CategoryStaticsID: &st.ID,
+		}
+		if err := tx.Omit(clause.Associations).Create(&cat).Error; err != nil {
+			return err
+		}
+		out, err = s.detail(tx, cat.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Update แก้ชื่อ รหัส คำอธิบาย หรือหมวดแม่ของหมวดหมู่
+// การย้ายหมวดแม่จะนับ subtree count ของหมวดแม่ทั้งสายเดิมและสายใหม่ใหม่
+func (s *CategoryService) Update(id uint, in UpdateCategoryInput) (*CategoryDetail, error) {
+	var out *CategoryDetail
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		cat, err := ensureCategoryExists(tx, id)
+		if err != nil {
+			return err
+		}
+		updates := map[string]any{}
+		if in.CategoryName != nil {
+			name := strings.TrimSpace(*in.CategoryName)
+			if name == "" {
+				return ErrCategoryNameRequired
+			}
+			updates["category_name"] = name
+		}
+		if in.CategoryCode != nil {
+			code, err := normalizeCategoryCode(*in.CategoryCode)
+			if err != nil {
+				return err
+			}
+			if err := ensureCategoryCodeFree(tx, code, id); err != nil {
+				return err
+			}
+			updates["category_code"] = code
+		}
+		if in.Description != nil {
+			updates["description"] = strings.TrimSpace(*in.Description)
+		}
+		var resync []uint
+		if in.ParentID != nil {
+			if *in.ParentID == 0 {
+				updates["parent_id"] = nil
+			} else {
+				if _, err := ensureCategoryExists(tx, *in.ParentID); err != nil {
+					return err
+				}
+				if err := ensureNoCycle(tx, id, *in.ParentID); err != nil {
+					return err
+				}
+				updates["parent_id"] = *in.ParentID
+				resync = append(resync, *in.ParentID)
+			}
+			if cat.ParentID != nil {
+				resync = append(resync, *cat.ParentID)
+			}
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&entity.Category{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		// ชื่อหมวดหมู่อยู่ใน Dublin Core ของหนังสือ (dc:subject)
+		if _, ok := updates["category_name"]; ok {
+			var bookIDs []uint
+			if err := tx.Table("category_book").Where("category_id = ?", id).Pluck("book_id", &bookIDs).Error; err != nil {
+				return err
+			}
+			if err := TouchBooks(tx, bookIDs...); err != nil {
+				return err
+			}
+		}
+		if err := SyncCategoryStatics(tx, resync...); err != nil {
+			return err
+		}
+		out, err = s.detail(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Delete ลบหมวดหมู่ที่ไม่มีหนังสือผูกอยู่และไม่มีหมวดย่อย
+// ลบถาวร (ไม่ soft delete) เพื่อให้นำ CategoryCode เดิมกลับมาใช้ได้ เพราะ unique index นับแถวที่ soft delete ด้วย
+func (s *CategoryService) Delete(id uint) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		cat, err := ensureCategoryExists(tx, id)
+		if err != nil {
+			return err
+		}
+		var children int64
+		if err := tx.Model(&entity.Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return err
+		}
+		if children > 0 {
+			return ErrCategoryHasChildren
+		}
+		var used int64
+		if err := tx.Table("category_book").Where("category_id = ?", id).Count(&used).Error; err != nil {
+			return err
+		}
+		if used > 0 {
+			return ErrCategoryInUse
+		}
+		if err := tx.Unscoped().Delete(&entity.Category{}, id).Error; err != nil {
+			return err
+		}
+		if cat.CategoryStaticsID != nil {
+			return tx.Unscoped().Delete(&entity.CategoryStatics{}, *cat.CategoryStaticsID).Error
+		}
+		return nil
+	})
+}
+
+// loadBookForCategories ตรวจว่าหนังสือมีอยู่และหมวดหมู่ทุกตัวมีอยู่จริง
+func loadBookForCategories(tx *gorm.DB, bookID uint, categoryIDs []uint) (*entity.Book, []entity.Category, error) {
+	var book entity.Book
+	if err := tx.First(&book, bookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrBookNotFound
+		}
+		return nil, nil, err
+	}
+	var cats []entity.Category
+	if len(categoryIDs) > 0 {
+		if err := tx.Where("id IN ?", categoryIDs).Find(&cats).Error; err != nil {
+			return nil, nil, err
+		}
+		found := map[uint]bool{}
+		for _, c := range cats {
+			found[c.ID] = true
+		}
+		for _, id := range categoryIDs {
+			if !found[id] {
+				return nil, nil, ErrCategoryNotFound
+			}
+		}
+	}
+	return &book, cats, nil
+}
+
+// BookCategories หมวดหมู่ของหนังสือ
+func (s *CategoryService) BookCategories(bookID uint) ([]entity.Category, error) {
+	var book entity.Book
+	if err := s.DB.Preload("Categories", func(db *gorm.DB) *gorm.DB {
+		return db.Order("category_code")
+	}).Preload("Categories.CategoryStatics").First(&book, bookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBookNotFound
+		}
+		return nil, err
+	}
+	return book.Categories, nil
+}
+
+// AttachCategories ผูกหมวดหมู่เพิ่มให้หนังสือ (ตัวที่ผูกอยู่แล้วจะข้ามไป)
+func (s *CategoryService) AttachCategories(bookID uint, categoryIDs []uint) ([]entity.Category, error) {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if _, _, err := loadBookForCategories(tx, bookID, categoryIDs); err != nil {
+			return err
+		}
+		for _, id := range categoryIDs {
+			if err := tx.Exec("INSERT INTO category_book (book_id, category_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
+				bookID, id).Error; err != nil {
+				return err
+			}
+		}
+		if err := TouchBooks(tx, bookID); err != nil {
+			return err
+		}
+		return SyncCategoryStatics(tx, categoryIDs...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.BookCategories(bookID)
+}
+
+// DetachCategory เอาหมวดหมู่ออกจากหนังสือ
+func (s *CategoryService) DetachCategory(bookID, categoryID uint) ([]entity.Category, error) {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if _, _, err := loadBookForCategories(tx, bookID, []uint{categoryID}); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM category_book WHERE book_id = ? AND category_id = ?",
+			bookID, categoryID).Error; err != nil {
+			return err
+		}
+		if err := TouchBooks(tx, bookID); err != nil {
+			return err
+		}
+		return SyncCategoryStatics(tx, categoryID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.BookCategories(bookID)
+}
+
+// SetBookCategories แทนที่หมวดหมู่ทั้งหมดของหนังสือด้วย categoryIDs (ส่งค่าว่าง = เอาออกทั้งหมด)
+func (s *CategoryService) SetBookCategories(bookID uint, categoryIDs []uint) ([]entity.Category, error) {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if _, _, err := loadBookForCategories(tx, bookID, categoryIDs); err != nil {
+			return err
+		}
+		var before []uint
+		if err := tx.Table("category_book").Where("book_id = ?", bookID).Pluck("category_id", &before).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM category_book WHERE book_id = ?", bookID).Error; err != nil {
+			return err
+		}
+		for _, id := range categoryIDs {
+			if err := tx.Exec("INSERT INTO category_book (book_id, category_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
+				bookID, id).Error; err != nil {
+				return err
+			}
+		}
+		if err := TouchBooks(tx, bookID); err != nil {
+			return err
+		}
+		return SyncCategoryStatics(tx, append(before, categoryIDs...)...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.BookCategories(bookID)
+}
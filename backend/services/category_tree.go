@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+)
+
+// ความลึกสูงสุดที่ query แบบ recursive จะเดินขึ้น/ลง กันวนไม่รู้จบถ้าข้อมูลเสียจนเกิด cycle
+const maxCategoryDepth = 64
+
+var (
+	ErrCategoryCycle       = errors.New("a category cannot be moved under itself or one of its descendants")
+	ErrCategoryHasChildren = errors.New("category has subcategories")
+)
+
+// categorySubtreeSQL id ของหมวดหมู่ที่ระบุ (? = รายการ id) และหมวดย่อยทุกระดับ
+var categorySubtreeSQL = fmt.Sprintf(`WITH RECURSIVE sub(id, depth) AS (
+		SELECT id, 0 FROM categories WHERE id IN ? AND deleted_at IS NULL
+		UNION
+		SELECT c.id, sub.depth + 1 FROM categories c JOIN sub ON c.parent_id = sub.id
+		WHERE c.deleted_at IS NULL AND sub.depth < %d
+	) SELECT id FROM sub`, maxCategoryDepth)
+
+// categoryAncestorsSQL หมวดหมู่ที่ระบุ (? = id เดียว) และหมวดแม่ทุกระดับ depth 0 = ตัวเอง
+var categoryAncestorsSQL = fmt.Sprintf(`WITH RECURSIVE up(id, parent_id, depth) AS (
+		SELECT id, parent_id, 0 FROM categories WHERE id = ? AND deleted_at IS NULL
+		UNION ALL
+		SELECT c.id, c.parent_id, up.depth + 1 FROM categories c JOIN up ON c.id = up.parent_id
+		WHERE c.deleted_at IS NULL AND up.depth < %d
+	)`, maxCategoryDepth)
+
+// CategoryCrumb หนึ่งขั้นใน breadcrumb
+type CategoryCrumb struct {
+	ID           uint   `json:"id"`
+	CategoryName string `json:"category_name"`
+	CategoryCode string `json:"category_code"`
+}
+
+// CategoryDetail หมวดหมู่พร้อมหมวดย่อยระดับถัดไปและ breadcrumb จากระดับบนสุดถึงตัวเอง
+type CategoryDetail struct {
+	entity.Category
+	Path []CategoryCrumb `json:"path"`
+}
+
+// CategoryNode หนึ่งโหนดใน tree ของหมวดหมู่
+type CategoryNode struct {
+	ID               uint           `json:"id"`
+	CategoryName     string         `json:"category_name"`
+	CategoryCode     string         `json:"category_code"`
+	ParentID         *uint          `json:"parent_id"`
+	BookCount        int            `json:"book_count"`
+	SubtreeBookCount int            `json:"subtree_book_count"`
+	Children         []CategoryNode `json:"children"`
+}
+
+// categoryPath breadcrumb ของหมวดหมู่ เรียงจากระดับบนสุดลงมาถึงตัวเอง
+func categoryPath(tx *gorm.DB, id uint) ([]CategoryCrumb, error) {
+	var path []CategoryCrumb
+	if err := tx.Raw(categoryAncestorsSQL+`
+		SELECT c.id, c.category_name, c.category_code FROM up JOIN categories c ON c.id = up.id
+		ORDER BY up.depth DESC`, id).
+		Scan(&path).Error; err != nil {
+		return nil, err
+	}
+	return path, nil
+}
+
+// categoryAncestorIDs id ของหมวดหมู่ที่ระบุและหมวดแม่ทุกระดับ
+func categoryAncestorIDs(tx *gorm.DB, ids []uint) ([]uint, error) {
+	seen := map[uint]bool{}
+	var out []uint
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		var up []uint
+		if err := tx.Raw(categoryAncestorsSQL+" SELECT id FROM up", id).Scan(&up).Error; err != nil {
+			return nil, err
+		}
+		for _, a := range up {
+			if !seen[a] {
+				seen[a] = true
+				out = append(out, a)
+			}
+		}
+	}
+	return out, nil
+}
+
+// ensureNoCycle ตรวจว่าการย้าย id ไปอยู่ใต้ parentID ไม่ทำให้เกิด cycle
+func ensureNoCycle(tx *gorm.DB, id, parentID uint) error {
+	if id == parentID {
+		return ErrCategoryCycle
+	}
+	path, err := categoryPath(tx, parentID)
+	if err != nil {
+		return err
+	}
+	for _, p := range path {
+		if p.ID == id {
+			return ErrCategoryCycle
+		}
+	}
+	return nil
+}
+
+// detail โหลดหมวดหมู่พร้อม CategoryStatics หมวดย่อยระดับถัดไป และ breadcrumb
+func (s *CategoryService) detail(tx *gorm.DB, id uint) (*CategoryDetail, error) {
+	var cat entity.Category
+	if err := tx.Preload("CategoryStatics").
+		Preload("Children", func(db *gorm.DB) *gorm.DB { return db.Order("category_code") }).
+		Preload("Children.CategoryStatics").
+		First(&cat, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, err
+	}
+	path, err := categoryPath(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &CategoryDetail{Category: cat, Path: path}, nil
+}
+
+// Tree หมวดหมู่ทั้งหมดเป็นโครงสร้างต้นไม้ เรียงตามรหัสในแต่ละระดับ
+func (s *CategoryService) Tree() ([]CategoryNode, error) {
+	var cats []entity.Category
+	if err := s.DB.Preload("CategoryStatics").Order("category_code").Find(&cats).Error; err != nil {
+		return nil, err
+	}
+	children := map[uint][]entity.Category{}
+	var roots []entity.Category
+	exists := map[uint]bool{}
+	for _, c := range cats {
+		exists[c.ID] = true
+	}
+	for _, c := range cats {
+		if c.ParentID == nil || !exists[*c.ParentID] {
+			roots = append(roots, c)
+			continue
+		}
+		children[*c.ParentID] = append(children[*c.ParentID], c)
+	}
+
+	var build func(list []entity.Category, depth int) []CategoryNode
+	build = func(list []entity.Category, depth int) []CategoryNode {
+		nodes := make([]CategoryNode, 0, len(list))
+		for _, c := range list {
+			n := CategoryNode{
+				ID:           c.ID,
+				CategoryName: c.CategoryName,
+				CategoryCode: c.CategoryCode,
+				ParentID:     c.ParentID,
+				Children:     []CategoryNode{},
+			}
+			if c.CategoryStatics != nil {
+				n.BookCount = c.CategoryStatics.BookCount
+				n.SubtreeBookCount = c.CategoryStatics.SubtreeBookCount
+			}
+			if depth < maxCategoryDepth {
+				n.Children = build(children[c.ID], depth+1)
+			}
+			nodes = append(nodes, n)
+		}
+		return nodes
+	}
+	return build(roots, 0), nil
+}
@@ -0,0 +1,309 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"gorm.io/gorm"
+)
+
+// ขนาดภาพปกที่ระบบสร้างให้ (size ใน query ของ /catalog/books/:id/cover)
+const (
+	CoverSizeSmall    = "small"
+	CoverSizeMedium   = "medium"
+	CoverSizeLarge    = "large"
+	CoverSizeOriginal = "original"
+
+	// coverKeyPrefix ปกที่อัปโหลดเก็บใน Storage ใต้ covers/ ภาพย่ออยู่ใน covers/thumbs/
+	coverKeyPrefix = "covers/"
+	coverThumbDir  = "thumbs"
+	coverQuality   = 85
+	// coverLinkTTL อายุ signed URL ที่ /catalog/books/:id/cover redirect ไป
+	coverLinkTTL = time.Hour
+	// coverMaxPixels จำนวน pixel สูงสุดของปก ไฟล์ขนาดไม่กี่ MB อาจประกาศขนาดภาพใหญ่มากจนการ decode ใช้หน่วยความจำหลาย GB
+	coverMaxPixels = 40_000_000
+)
+
+// coverBoxes กรอบสูงสุด (กว้าง x สูง) ของแต่ละขนาด ภาพถูกย่อให้พอดีกรอบโดยคงสัดส่วนและไม่ขยายภาพเล็ก
+var coverBoxes = []struct {
+	Size   string
+	Suffix string
+	W, H   int
+}{
+	{CoverSizeSmall, "sm", 160, 240},
+	{CoverSizeMedium, "md", 320, 480},
+	{CoverSizeLarge, "lg", 640, 960},
+}
+
+var (
+	ErrInvalidCoverSize = errors.New("size must be small, medium, large or original")
+	ErrCoverNotFound    = errors.New("cover image not found")
+)
+
+// CoverSet key ของภาพปกแต่ละขนาด (JPEG ที่ไม่มี EXIF)
+type CoverSet struct {
+	Small  string `json:"cover_small"`
+	Medium string `json:"cover_medium"`
+	Large  string `json:"cover_large"`
+}
+
+// CoverService สร้างภาพย่อของปกหนังสือและออกลิงก์ภาพปกตามขนาด
+type CoverService struct {
+	DB    *gorm.DB
+	Store Storage
+}
+
+// GenerateCoverThumbnails สร้างภาพย่อทุกขนาดจากปกที่ key (covers/...) แล้วเก็บลง Storage เดียวกัน
+// ภาพถูกหมุนตาม EXIF orientation แล้ว encode ใหม่เป็น JPEG ซึ่งตัด metadata เดิมออกทั้งหมด
+func GenerateCoverThumbnails(store Storage, key string) (*CoverSet, error) {
+	if !strings.HasPrefix(key, coverKeyPrefix) {
+		return nil, fmt.Errorf("%w: %s is not an uploaded cover", ErrCoverNotFound, key)
+	}
+	obj, err := store.Get(key)
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrCoverNotFound, key)
+		}
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(obj.Body, CoverUploadPolicy.MaxBytes+1))
+	obj.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	// อ่านแค่ header เพื่อตรวจขนาดภาพก่อน decode ทั้งภาพ
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUploadCorrupt, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, fmt.Errorf("%w: image has no pixels", ErrUploadCorrupt)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > coverMaxPixels {
+		return nil, fmt.Errorf("%w: cover is %dx%d pixels, limit is %d megapixels",
+			ErrUploadTooLarge, cfg.Width, cfg.Height, coverMaxPixels/1_000_000)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUploadCorrupt, err)
+	}
+	src = applyOrientation(src, jpegOrientation(data))
+
+	name := path.Base(key)
+	base := strings.TrimSuffix(name, path.Ext(name))
+	keys := map[string]string{}
+	for _, box := range coverBoxes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, fitCover(src, box.W, box.H), &jpeg.Options{Quality: coverQuality}); err != nil {
+			return nil, err
+		}
+		thumbKey := fmt.Sprintf("%s%s/%s_%s.jpg", coverKeyPrefix, coverThumbDir, base, box.Suffix)
+		if err := store.Put(thumbKey, &buf, int64(buf.Len()), ContentTypeJPEG); err != nil {
+			return nil, err
+		}
+		keys[box.Size] = thumbKey
+	}
+	return &CoverSet{Small: keys[CoverSizeSmall], Medium: keys[CoverSizeMedium], Large: keys[CoverSizeLarge]}, nil
+}
+
+// ApplyCoverThumbnails สร้างภาพย่อจาก book.CoverImage แล้วเก็บ key ลงใน book
+// ปกที่ไม่ได้อัปโหลดผ่านระบบ (เช่น URL ภายนอก) จะไม่มีภาพย่อ และ /cover จะใช้ภาพต้นฉบับแทน
+func ApplyCoverThumbnails(store Storage, book *entity.Book) error {
+	book.CoverSmall, book.CoverMedium, book.CoverLarge = "", "", ""
+	if !strings.HasPrefix(book.CoverImage, coverKeyPrefix) {
+		return nil
+	}
+	set, err := GenerateCoverThumbnails(store, book.CoverImage)
+	if err != nil {
+		return err
+	}
+	book.CoverSmall, book.CoverMedium, book.CoverLarge = set.Small, set.Medium, set.Large
+	return nil
+}
+
+// Backfill สร้างภาพย่อให้หนังสือที่มีปกแต่ยังไม่มีภาพย่อ (ปกที่เปิดไม่ได้จะถูกข้ามและบันทึก log)
+func (s *CoverService) Backfill() error {
+	var books []entity.Book
+	if err := s.DB.Select("id", "cover_image").
+		Where("cover_image LIKE ? AND (cover_small IS NULL OR cover_small = '')", coverKeyPrefix+"%").
+		Find(&books).Error; err != nil {
+		return err
+	}
+	for i := range books {
+		b := &books[i]
+		if err := ApplyCoverThumbnails(s.Store, b); err != nil {
+			log.Printf("cover thumbnails for book %d: %v\n", b.ID, err)
+			continue
+		}
+		if err := s.DB.Model(&entity.Book{}).Where("id = ?", b.ID).Updates(map[string]any{
+			"cover_small":  b.CoverSmall,
+			"cover_medium": b.CoverMedium,
+			"cover_large":  b.CoverLarge,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CoverURL URL ของปกหนังสือขนาด size (ว่าง = original) ถ้ายังไม่มีภาพย่อจะคืนภาพต้นฉบับ
+// ปกใน Storage ได้เป็น signed URL ส่วนปกที่เป็น URL ภายนอกคืนตามเดิม
+func (s *CoverService) CoverURL(bookID uint, size string) (string, error) {
+	var b entity.Book
+	if err := s.DB.Select("id", "cover_image", "cover_small", "cover_medium", "cover_large").
+		First(&b, bookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrBookNotFound
+		}
+		return "", err
+	}
+	if b.CoverImage == "" {
+		return "", ErrCoverNotFound
+	}
+	var url string
+	switch size {
+	case "", CoverSizeOriginal:
+	case CoverSizeSmall:
+		url = b.CoverSmall
+	case CoverSizeMedium:
+		url = b.CoverMedium
+	case CoverSizeLarge:
+		url = b.CoverLarge
+	default:
+		return "", ErrInvalidCoverSize
+	}
+	if url == "" {
+		url = b.CoverImage
+	}
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return url, nil
+	}
+	return s.Store.SignedURL(url, coverLinkTTL)
+}
+
+// fitCover ย่อภาพให้อยู่ในกรอบ w x h และวางบนพื้นขาว (ภาพโปร่งใสจาก PNG/WebP จะไม่กลายเป็นพื้นดำใน JPEG)
+func fitCover(src image.Image, w, h int) image.Image {
+	sb := src.Bounds()
+	dw, dh := sb.Dx(), sb.Dy()
+	if dw > w || dh > h {
+		if dw*h > dh*w {
+			dw, dh = w, max(1, dh*w/dw)
+		} else {
+			dw, dh = max(1, dw*h/dh), h
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, sb, draw.Over, nil)
+	return dst
+}
+
+// jpegOrientation ค่า EXIF Orientation (1-8) ของไฟล์ JPEG คืน 1 ถ้าไม่มีหรืออ่านไม่ได้
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // เริ่มข้อมูลภาพแล้ว ไม่มี EXIF
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return exifOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(bo.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	n := int(bo.Uint16(tiff[ifd:]))
+	for k := 0; k < n; k++ {
+		e := ifd + 2 + k*12
+		if e+12 > len(tiff) {
+			return 1
+		}
+		if bo.Uint16(tiff[e:]) == 0x0112 {
+			if v := int(bo.Uint16(tiff[e+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation หมุน/กลับภาพตาม EXIF Orientation เพื่อให้ภาพตั้งตรงหลังตัด EXIF ออก
+func applyOrientation(src image.Image, o int) image.Image {
+	if o <= 1 || o > 8 {
+		return src
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"encoding/xml"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+)
+
+const (
+	oaiDCNamespace      = "http://www.openarchives.org/OAI/2.0/oai_dc/"
+	oaiDCSchema         = "http://www.openarchives.org/OAI/2.0/oai_dc.xsd"
+	dublinCoreNamespace = "http://purl.org/dc/elements/1.1/"
+	xsiNamespace        = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// DublinCore ข้อมูลหนังสือหนึ่งเล่มแบบ oai_dc (Dublin Core 15 element แบบไม่มี qualifier)
+type DublinCore struct {
+	XMLName        xml.Name `xml:"oai_dc:dc"`
+	OaiDC          string   `xml:"xmlns:oai_dc,attr"`
+	DC             string   `xml:"xmlns:dc,attr"`
+	XSI            string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+
+	Title       []string `xml:"dc:title"`
+	Creator     []string `xml:"dc:creator"`
+	Subject     []string `xml:"dc:subject"`
+	Description []string `xml:"dc:description"`
+	Publisher   []string `xml:"dc:publisher"`
+	Date        []string `xml:"dc:date"`
+	Type        []string `xml:"dc:type"`
+	Format      []string `xml:"dc:format"`
+	Identifier  []string `xml:"dc:identifier"`
+	Language    []string `xml:"dc:language"`
+}
+
+// DublinCoreOf แปลงหนังสือ (ที่ preload Authors, Categories, Publisher, Language แล้ว) เป็น Dublin Core
+func DublinCoreOf(b *entity.Book) *DublinCore {
+	dc := &DublinCore{
+		OaiDC:          oaiDCNamespace,
+		DC:             dublinCoreNamespace,
+		XSI:            xsiNamespace,
+		SchemaLocation: oaiDCNamespace + " " + oaiDCSchema,
+		Title:          []string{b.Title},
+		Type:           []string{"Text"},
+	}
+	for _, a := range b.Authors {
+		dc.Creator = append(dc.Creator, a.AuthorName)
+	}
+	for _, c := range b.Categories {
+		dc.Subject = append(dc.Subject, c.CategoryName)
+	}
+	if b.Synopsis != "" {
+		dc.Description = []string{b.Synopsis}
+	}
+	if b.Publisher != nil && b.Publisher.PublisherName != "" {
+		dc.Publisher = []string{b.Publisher.PublisherName}
+	}
+	if b.PublishedYear != 0 {
+		dc.Date = []string{strconv.FormatUint(uint64(b.PublishedYear), 10)}
+	}
+	if b.EbookFile != "" {
+		dc.Format = append(dc.Format, contentTypeOf(b.EbookFile))
+	}
+	if b.TotalPage != 0 {
+		dc.Format = append(dc.Format, strconv.FormatUint(uint64(b.TotalPage), 10)+" pages")
+	}
+	if b.Isbn != "" {
+		dc.Identifier = []string{"urn:isbn:" + b.Isbn}
+	}
+	// ใช้รหัส ISO 639-1 ถ้ารู้จักชื่อภาษา ไม่เช่นนั้นใช้ชื่อตามที่บันทึกไว้
+	if b.Language != nil && b.Language.Name != "" {
+		lang := b.Language.Name
+		if codes := languageCodesOf(lang); codes != nil {
+			lang = codes[0]
+		}
+		dc.Language = []string{lang}
+	}
+	return dc
+}
+
+// preloadDublinCore preload ข้อมูลที่ DublinCoreOf ใช้
+func preloadDublinCore(q *gorm.DB) *gorm.DB {
+	return q.Preload("Authors").Preload("Categories").Preload("Publisher").Preload("Language")
+}
+
+// BookDublinCore Dublin Core ของหนังสือที่ยังไม่ถูกลบ
+func (s *OAIService) BookDublinCore(id uint) (*DublinCore, error) {
+	var b entity.Book
+	if err := preloadDublinCore(s.DB).First(&b, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBookNotFound
+		}
+		return nil, err
+	}
+	return DublinCoreOf(&b), nil
+}
+
+// TouchBooks เลื่อน UpdatedAt ของหนังสือเมื่อข้อมูลที่อยู่นอกตาราง books (ผู้แต่ง หมวดหมู่) เปลี่ยน
+// เพื่อให้ผู้เก็บเกี่ยวข้อมูลผ่าน OAI-PMH แบบ incremental เห็นการเปลี่ยนแปลง
+func TouchBooks(tx *gorm.DB, bookIDs ...uint) error {
+	if len(bookIDs) == 0 {
+		return nil
+	}
+	return tx.Unscoped().Model(&entity.Book{}).Where("id IN ?", bookIDs).
+		UpdateColumn("updated_at", time.Now()).Error
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultDownloadURLTTL อายุของลิงก์ดาวน์โหลด e-book
+	DefaultDownloadURLTTL = 5 * time.Minute
+	// storageRedirectTTL อายุของ signed URL ของ storage ที่ redirect ไปหลังตรวจสิทธิ์แล้ว
+	storageRedirectTTL = time.Minute
+
+	// ebookKeyPrefix Book.EbookFile เก็บเป็น key ใน Storage เช่น ebooks/20250901_x.epub
+	ebookKeyPrefix = "ebooks/"
+)
+
+var (
+	ErrEbookNotFound      = errors.New("this book has no e-book file")
+	ErrNoActiveBorrow     = errors.New("you must have an active borrow of this book to download it")
+	ErrInvalidDownloadURL = errors.New("download link is invalid or has expired")
+)
+
+// EbookDeliveryService ออกลิงก์ดาวน์โหลด e-book แบบลงลายเซ็นอายุสั้น และส่งไฟล์ให้เฉพาะผู้ที่ยืมอยู่
+type EbookDeliveryService struct {
+	DB     *gorm.DB
+	Store  Storage
+	Secret []byte        // key สำหรับลงลายเซ็นลิงก์
+	TTL    time.Duration // อายุลิงก์ (ค่าเริ่มต้น DefaultDownloadURLTTL)
+	Clock  func() time.Time
+}
+
+// DownloadLink ลิงก์ดาวน์โหลดที่ใช้ได้ถึง ExpiresAt
+type DownloadLink struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s *EbookDeliveryService) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock()
+	}
+	return time.Now()
+}
+
+func (s *EbookDeliveryService) ttl() time.Duration {
+	if s.TTL > 0 {
+		return s.TTL
+	}
+	return DefaultDownloadURLTTL
+}
+
+// sign ลายเซ็นของ (book, user, expires)
+func (s *EbookDeliveryService) sign(bookID uint, userID string, expires int64) string {
+	mac := hmac.New(sha256.New, s.Secret)
+	fmt.Fprintf(mac, "ebook:%d:%s:%d", bookID, userID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// activeBorrow รายการยืมที่ยังไม่คืนและยังไม่เลยกำหนดของผู้ใช้สำหรับหนังสือ bookID
+func activeBorrow(tx *gorm.DB, userID string, bookID uint, now time.Time) (*entity.Borrow, error) {
+	var b entity.Borrow
+	if err := tx.Joins("JOIN book_licenses ON book_licenses.id = borrows.book_license_id").
+		Where("borrows.user_id = ? AND book_licenses.book_id = ?", userID, bookID).
+		Where("borrows.return_date IS NULL AND borrows.due_date > ?", now).
+		Order("borrows.due_date DESC").
+		First(&b).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoActiveBorrow
+		}
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (s *EbookDeliveryService) ebookKey(bookID uint) (string, error) {
+	var book entity.Book
+	if err := s.DB.Select("id", "ebook_file").First(&book, bookID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrBookNotFound
+		}
+		return "", err
+	}
+	if book.EbookFile == "" {
+		return "", ErrEbookNotFound
+	}
+	return book.EbookFile, nil
+}
+
+// IssueLink ออกลิงก์ดาวน์โหลดให้ผู้ใช้ที่ยืมหนังสืออยู่ อายุลิงก์ไม่เกิน TTL และไม่เกินกำหนดคืน
+func (s *EbookDeliveryService) IssueLink(userID string, bookID uint) (*DownloadLink, error) {
+	if _, err := s.ebookKey(bookID); err != nil {
+		return nil, err
+	}
+	now := s.now()
+	b, err := activeBorrow(s.DB, userID, bookID, now)
+	if err != nil {
+		return nil, err
+	}
+	exp := now.Add(s.ttl())
+	if b.DueDate.Before(exp) {
+		exp = b.DueDate
+	}
+	sig := s.sign(bookID, userID, exp.Unix())
+	return &DownloadLink{
+		URL:       fmt.Sprintf("/api/download/ebooks/%d?u=%s&exp=%d&sig=%s", bookID, url.QueryEscape(userID), exp.Unix(), sig),
+		ExpiresAt: exp,
+	}, nil
+}
+
+// Open ตรวจลายเซ็นและวันหมดอายุของลิงก์ ตรวจอีกครั้งว่ายังยืมอยู่ (อาจคืนไปแล้วหลังออกลิงก์)
+// แล้วคืน signed URL อายุสั้นของไฟล์ใน Storage (รองรับ Range)
+func (s *EbookDeliveryService) Open(bookID uint, userID string, expires int64, sig string) (string, error) {
+	now := s.now()
+	if userID == "" || now.Unix() >= expires ||
+		!hmac.Equal([]byte(sig), []byte(s.sign(bookID, userID, expires))) {
+		return "", ErrInvalidDownloadURL
+	}
+	if _, err := activeBorrow(s.DB, userID, bookID, now); err != nil {
+		return "", err
+	}
+	key, err := s.ebookKey(bookID)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(key, ebookKeyPrefix) {
+		return "", ErrEbookNotFound
+	}
+	return s.Store.SignedURL(key, storageRedirectTTL)
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// EbookMetadata ข้อมูลที่อ่านได้จากไฟล์ e-book (ค่าที่ไฟล์ไม่มีเป็นค่าว่าง)
+type EbookMetadata struct {
+	Title         string
+	Authors       []string
+	Publisher     string
+	Language      string // รหัสภาษา BCP 47 เช่น th, en-US
+	Isbn          string
+	Description   string
+	PublishedYear uint
+	PageCount     uint
+	Cover         []byte // ภาพปกที่ฝังใน EPUB
+}
+
+// ExtractEbookMetadata อ่าน metadata จาก EPUB (OPF + ภาพปก) หรือ PDF (จำนวนหน้า + Info dictionary)
+// parser อ่านไฟล์จากผู้ใช้ทั้งไฟล์ ถ้ามีกรณีที่หลุดการตรวจจน panic ให้ถือว่าไฟล์เสีย แทนที่จะล้มทั้งคำขอ
+func ExtractEbookMetadata(r io.ReaderAt, size int64, contentType string) (md *EbookMetadata, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			md, err = nil, fmt.Errorf("%w: %v", ErrUploadCorrupt, p)
+		}
+	}()
+	switch contentType {
+	case ContentTypeEPUB:
+		return extractEpubMetadata(r, size)
+	case ContentTypePDF:
+		return extractPdfMetadata(r, size)
+	}
+	return nil, fmt.Errorf("%w: %s has no metadata reader", ErrUploadUnsupportedType, contentType)
+}
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type opfCreator struct {
+	ID     string `xml:"id,attr"`
+	Role   string `xml:"http://www.idpf.org/2007/opf role,attr"`
+	FileAs string `xml:"http://www.idpf.org/2007/opf file-as,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type opfIdentifier struct {
+	ID     string `xml:"id,attr"`
+	Scheme string `xml:"http://www.idpf.org/2007/opf scheme,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type opfDate struct {
+	Event string `xml:"http://www.idpf.org/2007/opf event,attr"`
+	Value string `xml:",chardata"`
+}
+
+type opfMeta struct {
+	Name     string `xml:"name,attr"`
+	Content  string `xml:"content,attr"`
+	Property string `xml:"property,attr"`
+	Refines  string `xml:"refines,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type opfItem struct {
+	ID         string `xml:"id,attr"`
+	Href       string `xml:"href,attr"`
+	MediaType  string `xml:"media-type,attr"`
+	Properties string `xml:"properties,attr"`
+}
+
+type opfPackage struct {
+	Metadata struct {
+		Titles       []string        `xml:"http://purl.org/dc/elements/1.1/ title"`
+		Creators     []opfCreator    `xml:"http://purl.org/dc/elements/1.1/ creator"`
+		Publishers   []string        `xml:"http://purl.org/dc/elements/1.1/ publisher"`
+		Languages    []string        `xml:"http://purl.org/dc/elements/1.1/ language"`
+		Identifiers  []opfIdentifier `xml:"http://purl.org/dc/elements/1.1/ identifier"`
+		Dates        []opfDate       `xml:"http://purl.org/dc/elements/1.1/ date"`
+		Descriptions []string        `xml:"http://purl.org/dc/elements/1.1/ description"`
+		Metas        []opfMeta       `xml:"meta"`
+	} `xml:"metadata"`
+	Manifest []opfItem `xml:"manifest>item"`
+}
+
+// refined ค่า meta ของ EPUB 3 ที่ขยายความ element id (เช่น role ของ creator)
+func (p *opfPackage) refined(id, property string) string {
+	if id == "" {
+		return ""
+	}
+	for _, m := range p.Metadata.Metas {
+		if m.Refines == "#"+id && m.Property == property {
+			return strings.TrimSpace(m.Value)
+		}
+	}
+	return ""
+}
+
+// epubMaxXML ขนาดสูงสุดของ container.xml / OPF ที่ยอมอ่าน
+const epubMaxXML = 4 << 20
+
+func readZipEntry(zr *zip.Reader, name string, limit int64) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) > limit {
+			return nil, fmt.Errorf("%s is larger than %d bytes", name, limit)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%s not found", name)
+}
+
+func extractEpubMetadata(r io.ReaderAt, size int64) (*EbookMetadata, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUploadCorrupt, err)
+	}
+	raw, err := readZipEntry(zr, "META-INF/container.xml", epubMaxXML)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUploadCorrupt, err)
+	}
+	var container epubContainer
+	if err := xml.Unmarshal(raw, &container); err != nil {
+		return nil, fmt.Errorf("%w: container.xml: %v", ErrUploadCorrupt, err)
+	}
+	opfPath := ""
+	for _, rf := range container.Rootfiles {
+		if rf.MediaType == "" || rf.MediaType == "application/oebps-package+xml" {
+			opfPath = rf.FullPath
+			break
+		}
+	}
+	if opfPath == "" {
+		return nil, fmt.Errorf("%w: container.xml has no OPF rootfile", ErrUploadCorrupt)
+	}
+	raw, err = readZipEntry(zr, opfPath, epubMaxXML)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUploadCorrupt, err)
+	}
+	var pkg opfPackage
+	if err := xml.Unmarshal(raw, &pkg); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrUploadCorrupt, opfPath, err)
+	}
+
+	md := &EbookMetadata{}
+	md.Title = firstNonEmpty(pkg.Metadata.Titles)
+	md.Publisher = firstNonEmpty(pkg.Metadata.Publishers)
+	md.Language = firstNonEmpty(pkg.Metadata.Languages)
+	md.Description = plainText(firstNonEmpty(pkg.Metadata.Descriptions))
+
+	for _, c := range pkg.Metadata.Creators {
+		role := c.Role
+		if role == "" {
+			role = pkg.refined(c.ID, "role")
+		}
+		// creator ที่ไม่ระบุ role ถือเป็นผู้แต่ง ส่วน role อื่น (ผู้แปล, ผู้วาดภาพ ฯลฯ) ไม่นับ
+		if name := strings.TrimSpace(c.Value); name != "" && (role == "" || role == "aut") {
+			md.Authors = append(md.Authors, name)
+		}
+	}
+	for _, id := range pkg.Metadata.Identifiers {
+		if isbn, ok := NormalizeIsbn(id.Value); ok {
+			md.Isbn = isbn
+			break
+		}
+	}
+	for _, d := range pkg.Metadata.Dates {
+		// dc:date ที่มี opf:event อื่นเช่น modification ไม่ใช่วันที่พิมพ์
+		if d.Event != "" && d.Event != "publication" {
+			continue
+		}
+		if y := leadingYear(d.Value); y > 0 {
+			md.PublishedYear = y
+			break
+		}
+	}
+	for _, m := range pkg.Metadata.Metas {
+		if m.Property == "schema:numberOfPages" {
+			if n, err := strconv.ParseUint(strings.TrimSpace(m.Value), 10, 32); err == nil {
+				md.PageCount = uint(n)
+			}
+		}
+	}
+
+	if item := pkg.coverItem(); item != nil {
+		href, err := url.PathUnescape(item.Href)
+		if err != nil {
+			href = item.Href
+		}
+		name := path.Join(path.Dir(opfPath), href)
+		// ปกที่อ่านไม่ได้ไม่ทำให้การอ่าน metadata ทั้งหมดล้มเหลว
+		if data, err := readZipEntry(zr, name, CoverUploadPolicy.MaxBytes); err == nil {
+			md.Cover = data
+		}
+	}
+	return md, nil
+}
+
+// coverItem หาภาพปกใน manifest: properties="cover-image" (EPUB 3) > <meta name="cover"> (EPUB 2) > item ที่ชื่อมีคำว่า cover
+func (p *opfPackage) coverItem() *opfItem {
+	isImage := func(it *opfItem) bool { return strings.HasPrefix(it.MediaType, "image/") }
+	for i := range p.Manifest {
+		if it := &p.Manifest[i]; isImage(it) && strings.Contains(" "+it.Properties+" ", " cover-image ") {
+			return it
+		}
+	}
+	for _, m := range p.Metadata.Metas {
+		if m.Name != "cover" || m.Content == "" {
+			continue
+		}
+		for i := range p.Manifest {
+			if it := &p.Manifest[i]; isImage(it) && (it.ID == m.Content || it.Href == m.Content) {
+				return it
+			}
+		}
+	}
+	for i := range p.Manifest {
+		it := &p.Manifest[i]
+		if isImage(it) && (strings.Contains(strings.ToLower(it.ID), "cover") || strings.Contains(strings.ToLower(it.Href), "cover")) {
+			return it
+		}
+	}
+	return nil
+}
+
+func firstNonEmpty(values []string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+var (
+	htmlTagRe    = regexp.MustCompile(`<[^>]*>`)
+	yearPrefixRe = regexp.MustCompile(`^\D*(\d{4})`)
+	isbnInTextRe = regexp.MustCompile(`(?i)ISBN(?:-1[03])?[:\s]*([0-9][0-9\- ]{8,16}[0-9Xx])`)
+)
+
+// plainText ตัด tag HTML ที่บางไฟล์ใส่มาใน description และรวมช่องว่าง
+func plainText(s string) string {
+	s = html.UnescapeString(htmlTagRe.ReplaceAllString(s, " "))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// leadingYear ปีจากวันที่รูปแบบต่าง ๆ เช่น 2024-1-15, 2023-02-22T15:02:23Z, D:20230901120000
+func leadingYear(s string) uint {
+	m := yearPrefixRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0
+	}
+	y, _ := strconv.Atoi(m[1])
+	if y < 1000 {
+		return 0
+	}
+	return uint(y)
+}
+
+// NormalizeIsbn ตัด urn:isbn:, ขีดและช่องว่างออก แล้วตรวจ check digit ของ ISBN-10 / ISBN-13
+func NormalizeIsbn(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	lower := strings.ToLower(s)
+	for _, p := range []string{"urn:isbn:", "isbn:", "isbn"} {
+		if strings.HasPrefix(lower, p) {
+			s = s[len(p):]
+			break
+		}
+	}
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c == 'X' || c == 'x':
+			b.WriteRune('X')
+		case c == '-' || c == ' ':
+		default:
+			return "", false
+		}
+	}
+	d := b.String()
+	switch len(d) {
+	case 10:
+		sum := 0
+		for i, c := range d {
+			v := int(c - '0')
+			if c == 'X' {
+				if i != 9 {
+					return "", false
+				}
+				v = 10
+			}
+			sum += v * (10 - i)
+		}
+		return d, sum%11 == 0
+	case 13:
+		if strings.Contains(d, "X") {
+			return "", false
+		}
+		sum := 0
+		for i, c := range d {
+			v := int(c - '0')
+			if i%2 == 1 {
+				v *= 3
+			}
+			sum += v
+		}
+		return d, sum%10 == 0
+	}
+	return "", false
+}
+
+// isbnInText หา ISBN ที่เขียนไว้ในข้อความ เช่น "ISBN 978-616-..." ใน Subject ของ PDF
+func isbnInText(s string) string {
+	for _, m := range isbnInTextRe.FindAllStringSubmatch(s, -1) {
+		if isbn, ok := NormalizeIsbn(m[1]); ok {
+			return isbn
+		}
+	}
+	return ""
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+)
+
+// รูปแบบ license ของ e-book
+const (
+	LicenseModelPerpetual   = "perpetual"    // ใช้ได้ไม่จำกัด
+	LicenseModelTimeLimited = "time_limited" // ใช้ได้ถึง ExpiresAt
+	LicenseModelMetered     = "metered"      // ยืมได้ MaxCheckouts ครั้ง (อาจมี ExpiresAt ด้วย)
+)
+
+var (
+	ErrInvalidLicenseModel = errors.New("license_model must be perpetual, time_limited or metered")
+	ErrInvalidLicenseTerms = errors.New("invalid license terms: time_limited needs a future expires_at, metered needs max_checkouts > 0, perpetual takes neither")
+	ErrLicenseSpent        = errors.New("license is expired or has no checkouts left")
+)
+
+// licenseUsableSQL เงื่อนไข license ที่ยังไม่หมดอายุและยังเหลือจำนวนครั้ง (? = เวลาปัจจุบัน)
+const licenseUsableSQL = `(book_licenses.expires_at IS NULL OR book_licenses.expires_at > ?)
+	AND (book_licenses.max_checkouts IS NULL OR book_licenses.checkout_count < book_licenses.max_checkouts)`
+
+// licenseSpent license หมดอายุแล้วหรือถูกยืมครบจำนวนครั้งแล้ว
+func licenseSpent(lic *entity.BookLicense, now time.Time) bool {
+	if lic.ExpiresAt != nil && !lic.ExpiresAt.After(now) {
+		return true
+	}
+	return lic.MaxCheckouts != nil && lic.CheckoutCount >= *lic.MaxCheckouts
+}
+
+func retireLicense(tx *gorm.DB, licenseID uint) error {
+	retiredID, err := bookStatusID(tx, BookStatusRetired)
+	if err != nil {
+		return err
+	}
+	return tx.Model(&entity.BookLicense{}).Where("id = ?", licenseID).
+		Update("book_status_id", retiredID).Error
+}
+
+// AddLicensesInput จำนวนและเงื่อนไขของ license ที่จะเพิ่ม (Model ว่าง = perpetual)
+type AddLicensesInput struct {
+	Count        int
+	Model        string
+	ExpiresAt    *time.Time
+	MaxCheckouts *uint
+}
+
+func (in *AddLicensesInput) validate(now time.Time) error {
+	if in.Count < 1 || in.Count > MaxLicensesPerRequest {
+		return ErrInvalidLicenseCount
+	}
+	if in.Model == "" {
+		in.Model = LicenseModelPerpetual
+	}
+	switch in.Model {
+	case LicenseModelPerpetual:
+		if in.ExpiresAt != nil || in.MaxCheckouts != nil {
+			return ErrInvalidLicenseTerms
+		}
+	case LicenseModelTimeLimited:
+		if in.ExpiresAt == nil || !in.ExpiresAt.After(now) || in.MaxCheckouts != nil {
+			return ErrInvalidLicenseTerms
+		}
+	case LicenseModelMetered:
+		if in.MaxCheckouts == nil || *in.MaxCheckouts == 0 {
+			return ErrInvalidLicenseTerms
+		}
+		if in.ExpiresAt != nil && !in.ExpiresAt.After(now) {
+			return ErrInvalidLicenseTerms
+		}
+	default:
+		return ErrInvalidLicenseModel
+	}
+	return nil
+}
+
+// ExpiringLicense license ที่ใกล้หมดอายุหรือใกล้ใช้ครบจำนวนครั้ง
+type ExpiringLicense struct {
+	ID                 uint       `json:"id"`
+	BookLicenseID      string     `json:"book_license_id"`
+	BookID             uint       `json:"book_id"`
+	Title              string     `json:"title"`
+	LicenseModel       string     `json:"license_model"`
+	StatusName         string     `json:"status_name"`
+	ExpiresAt          *time.Time `json:"expires_at"`
+	MaxCheckouts       *uint      `json:"max_checkouts"`
+	CheckoutCount      uint       `json:"checkout_count"`
+	RemainingCheckouts *uint      `json:"remaining_checkouts"`
+	Reasons            []string   `json:"reasons"` // expiring และ/หรือ low_checkouts
+}
+
+// ExpiringReport license ที่ยังไม่ Retired และจะหมดอายุภายใน within
+// หรือเหลือจำนวนครั้งที่ยืมได้ไม่เกิน maxRemaining เรียงตามวันหมดอายุ
+func (s *LicenseService) ExpiringReport(within time.Duration, maxRemaining uint) ([]ExpiringLicense, error) {
+	retiredID, err := bookStatusID(s.DB, BookStatusRetired)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var rows []ExpiringLicense
+	if err := s.DB.Model(&entity.BookLicense{}).
+		Select(`book_licenses.id, book_licenses.book_license_id, book_licenses.book_id, books.title,
+			book_licenses.license_model, book_statuses.status_name, book_licenses.expires_at,
+			book_licenses.max_checkouts, book_licenses.checkout_count`).
+		Joins("JOIN books ON books.id = book_licenses.book_id AND books.deleted_at IS NULL").
+		Joins("JOIN book_statuses ON book_statuses.id = book_licenses.book_status_id").
+		Where("book_licenses.book_status_id <> ?", retiredID).
+		Where(`(book_licenses.expires_at IS NOT NULL AND book_licenses.expires_at <= ?)
+			OR (book_licenses.max_checkouts IS NOT NULL AND book_licenses.max_checkouts - book_licenses.checkout_count <= ?)`,
+			now.Add(within), maxRemaining).
+		Order("book_licenses.expires_at IS NULL, book_licenses.expires_at, book_licenses.id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	out := make([]ExpiringLicense, 0, len(rows))
+	for _, r := range rows {
+		r.Reasons = []string{}
+		if r.ExpiresAt != nil && !r.ExpiresAt.After(now.Add(within)) {
+			r.Reasons = append(r.Reasons, "expiring")
+		}
+		if r.MaxCheckouts != nil {
+			remaining := uint(0)
+			if *r.MaxCheckouts > r.CheckoutCount {
+				remaining = *r.MaxCheckouts - r.CheckoutCount
+			}
+			r.RemainingCheckouts = &remaining
+			if remaining <= maxRemaining {
+				r.Reasons = append(r.Reasons, "low_checkouts")
+			}
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// RetireSpentLicenses เปลี่ยน license ที่ Available/Hold แต่หมดอายุหรือใช้ครบจำนวนครั้งแล้วเป็น Retired
+// การจองที่ถือ license นั้นอยู่กลับเข้าคิวและได้ license ว่างชุดอื่นแทนถ้ามี
+func (s *Scheduler) RetireSpentLicenses(now time.Time) (int, error) {
+	availableID, err := bookStatusID(s.DB, BookStatusAvailable)
+	if err != nil {
+		return 0, err
+	}
+	holdID, err := bookStatusID(s.DB, BookStatusHold)
+	if err != nil {
+		return 0, err
+	}
+	var spent []entity.BookLicense
+	if err := s.DB.Where("book_status_id IN ?", []uint{availableID, holdID}).
+		Where("NOT ("+licenseUsableSQL+")", now).
+		Find(&spent).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var errs []error
+	for _, lic := range spent {
+		retired := false
+		err := s.Notifications.Transaction(s.DB, func(tx *gorm.DB) error {
+			if lic.BookStatusID == holdID {
+				if err := requeueHold(tx, lic.ID); err != nil {
+					return err
+				}
+			}
+			if err := retireLicense(tx, lic.ID); err != nil {
+				return err
+			}
+			retired = true
+			if lic.BookStatusID != holdID {
+				return nil
+			}
+			allocated, err := allocateAvailable(tx, lic.BookID, now, s.HoldPeriod)
+			if err != nil {
+				return err
+			}
+			for i := range allocated {
+				if err := s.Notifications.NotifyReservationReady(tx, &allocated[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("retire license %d: %w", lic.ID, err))
+			continue
+		}
+		// นับหลัง commit เท่านั้น ถ้า rollback license นี้ยังไม่ถูก Retired
+		if retired {
+			count++
+		}
+	}
+	return count, errors.Join(errs...)
+}
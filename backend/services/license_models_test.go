@@ -0,0 +1,71 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+)
+
+// license ที่ Hold อยู่แต่หมดอายุ: ถ้าส่งต่อให้ผู้จองไม่สำเร็จต้อง rollback และไม่ถูกนับ
+func TestRetireSpentLicensesCountsOnlyCommitted(t *testing.T) {
+	db := newSchedulerTestDB(t)
+	s := newTestScheduler(db)
+
+	book, spent := seedEbook(t, db, 1, BookStatusHold)
+	expired := schedulerNow.Add(-time.Hour)
+	if err := db.Model(spent).Updates(map[string]any{"license_model": LicenseModelTimeLimited, "expires_at": expired}).Error; err != nil {
+		t.Fatal(err)
+	}
+	spare := &entity.BookLicense{
+		BookLicenseID: "LIC-1b", BookID: book.ID,
+		BookStatusID: mustBookStatus(t, db, BookStatusAvailable), LicenseModel: LicenseModelPerpetual,
+	}
+	mustCreate(t, db, spare)
+	r := seedReservation(t, db, "S001", book, ReservationStatusWaiting, schedulerNow.Add(-24*time.Hour))
+	notifiedID := mustReservationStatus(t, db, ReservationStatusNotified)
+	if err := db.Model(r).Updates(map[string]any{
+		"reservation_status_id":     notifiedID,
+		"allocated_book_license_id": spent.ID,
+		"expires_at":                schedulerNow.Add(time.Hour),
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// ไม่มีประเภท reservation_ready: แจ้งผู้จองไม่ได้หลัง Retired แล้วใน transaction
+	var ready entity.NotificationType
+	if err := db.Where("type_name = ?", NotificationTypeReservationReady).First(&ready).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(&ready).Error; err != nil {
+		t.Fatal(err)
+	}
+	n, err := s.RetireSpentLicenses(s.now())
+	if err == nil {
+		t.Fatal("want error from failed notification")
+	}
+	if n != 0 {
+		t.Errorf("retired %d, want 0 after rollback", n)
+	}
+	if lic := reload[entity.BookLicense](t, db, spent.ID); lic.BookStatusID != mustBookStatus(t, db, BookStatusHold) {
+		t.Errorf("rolled-back license status = %d, want Hold", lic.BookStatusID)
+	}
+
+	if err := db.Unscoped().Model(&ready).Update("deleted_at", nil).Error; err != nil {
+		t.Fatal(err)
+	}
+	n, err = s.RetireSpentLicenses(s.now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("retired %d, want 1", n)
+	}
+	if lic := reload[entity.BookLicense](t, db, spent.ID); lic.BookStatusID != mustBookStatus(t, db, BookStatusRetired) {
+		t.Errorf("license status = %d, want Retired", lic.BookStatusID)
+	}
+	got := reload[entity.Reservation](t, db, r.ID)
+	if got.ReservationStatusID != notifiedID || got.AllocatedBookLicenseID == nil || *got.AllocatedBookLicenseID != spare.ID {
+		t.Errorf("reservation status %d license %v, want Notified on %d", got.ReservationStatusID, got.AllocatedBookLicenseID, spare.ID)
+	}
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+)
+
+// MaxLicensesPerRequest จำนวน license สูงสุดที่เพิ่มได้ในครั้งเดียว
+const MaxLicensesPerRequest = 500
+
+var (
+	ErrLicenseNotFound       = errors.New("license not found")
+	ErrInvalidLicenseCount   = fmt.Errorf("count must be between 1 and %d", MaxLicensesPerRequest)
+	ErrLicenseStatusNotFound = errors.New("license status not found")
+	ErrLicenseManualStatus   = errors.New("status Borrowed and Hold are managed by checkouts and reservations and cannot be set by hand")
+	ErrLicenseBorrowed       = errors.New("license has an active borrow; it must be returned first")
+)
+
+// LicenseService จัดการ license (สำเนา) ของหนังสือสำหรับ admin
+type LicenseService struct {
+	DB            *gorm.DB
+	Notifications *NotificationService
+	HoldPeriod    time.Duration
+}
+
+// LicenseSummary จำนวน license ของหนังสือแยกตามสถานะ (Total ไม่นับที่ Retired)
+type LicenseSummary struct {
+	BookID    uint  `json:"book_id"`
+	Total     int64 `json:"total"`
+	Available int64 `json:"available"`
+	Borrowed  int64 `json:"borrowed"`
+	OnHold    int64 `json:"on_hold"`
+	Retired   int64 `json:"retired"`
+}
+
+type LicenseInventory struct {
+	Summary  LicenseSummary       `json:"summary"`
+	Licenses []entity.BookLicense `json:"licenses"`
+}
+
+// licensePrefix รูปแบบรหัส license ที่ระบบสร้างให้: BK<book id>-<ลำดับ 4 หลัก> เช่น BK12-0003
+func licensePrefix(bookID uint) string {
+	return fmt.Sprintf("BK%d-", bookID)
+}
+
+func ensureBookExists(tx *gorm.DB, bookID uint) error {
+	var n int64
+	if err := tx.Model(&entity.Book{}).Where("id = ?", bookID).Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrBookNotFound
+	}
+	return nil
+}
+
+// loadBookLicense license ของหนังสือ bookID (license ของหนังสือเล่มอื่นถือว่าไม่พบ)
+func loadBookLicense(tx *gorm.DB, bookID, licenseID uint) (*entity.BookLicense, error) {
+	var lic entity.BookLicense
+	if err := tx.Preload("BookStatus").
+		Where("id = ? AND book_id = ?", licenseID, bookID).
+		First(&lic).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLicenseNotFound
+		}
+		return nil, err
+	}
+	return &lic, nil
+}
+
+// Summary นับ license ของหนังสือแยกตามสถานะ
+func (s *LicenseService) Summary(bookID uint) (*LicenseSummary, error) {
+	if err := ensureBookExists(s.DB, bookID); err != nil {
+		return nil, err
+	}
+	return licenseSummary(s.DB, bookID)
+}
+
+func licenseSummary(tx *gorm.DB, bookID uint) (*LicenseSummary, error) {
+	type row struct {
+		StatusName string
+		N          int64
+	}
+	var rows []row
+	if err := tx.Model(&entity.BookLicense{}).
+		Select("book_statuses.status_name AS status_name, COUNT(*) AS n").
+		Joins("JOIN book_statuses ON book_statuses.id = book_licenses.book_status_id").
+		Where("book_licenses.book_id = ?", bookID).
+		Group("book_statuses.status_name").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := LicenseSummary{BookID: bookID}
+	for _, r := range rows {
+		switch r.StatusName {
+		case BookStatusAvailable:
+			out.Available = r.N
+		case BookStatusBorrowed:
+			out.Borrowed = r.N
+		case BookStatusHold:
+			out.OnHold = r.N
+		case BookStatusRetired:
+			out.Retired = r.N
+			continue
+		}
+		out.Total += r.N
+	}
+	return &out, nil
+}
+
+// Inventory license ทั้งหมดของหนังสือพร้อมสรุปจำนวน (status = กรองตามชื่อสถานะ)
+func (s *LicenseService) Inventory(bookID uint, status string) (*LicenseInventory, error) {
+	if err := ensureBookExists(s.DB, bookID); err != nil {
+		return nil, err
+	}
+	sum, err := licenseSummary(s.DB, bookID)
+	if err != nil {
+		return nil, err
+	}
+	q := s.DB.Preload("BookStatus").Where("book_licenses.book_id = ?", bookID)
+	if status != "" {
+		q = q.Joins("JOIN book_statuses ON book_statuses.id = book_licenses.book_status_id").
+			Where("book_statuses.status_name = ?", status)
+	}
+	out := LicenseInventory{Summary: *sum, Licenses: []entity.BookLicense{}}
+	if err := q.Order("book_licenses.id").Find(&out.Licenses).Error; err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// nextLicenseSeq ลำดับถัดไปของรหัส license ที่ระบบสร้าง (นับรวม license ที่ถูกลบแล้ว เพราะ BookLicenseID เป็น unique)
+func nextLicenseSeq(tx *gorm.DB, bookID uint) (int, error) {
+	prefix := licensePrefix(bookID)
+	var ids []string
+	if err := tx.Unscoped().Model(&entity.BookLicense{}).
+		Where("book_license_id LIKE ?", prefix+"%").
+		Pluck("book_license_id", &ids).Error; err != nil {
+		return 0, err
+	}
+	max := 0
+	for _, id := range ids {
+		if n, err := strconv.Atoi(strings.TrimPrefix(id, prefix)); err == nil && n > max {
+			max = n
+		}
+	}
+	return max + 1, nil
+}
+
+// Add เพิ่ม license ใหม่ in.Count ชุดให้หนังสือตามรูปแบบ license ที่ระบุ สถานะเริ่มต้น Available
+// ถ้ามีคิวจองรออยู่ license ใหม่จะถูก Hold ให้คิวตามลำดับทันทีพร้อมแจ้งเตือน
+func (s *LicenseService) Add(bookID uint, in AddLicensesInput) ([]entity.BookLicense, error) {
+	if err := in.validate(time.Now()); err != nil {
+		return nil, err
+	}
+	var ids []uint
+	err := s.Notifications.Transaction(s.DB, func(tx *gorm.DB) error {
+		if err := ensureBookExists(tx, bookID); err != nil {
+			return err
+		}
+		availableID, err := bookStatusID(tx, BookStatusAvailable)
+		if err != nil {
+			return err
+		}
+		seq, err := nextLicenseSeq(tx, bookID)
+		if err != nil {
+			return err
+		}
+		lics := make([]entity.BookLicense, in.Count)
+		for i := range lics {
+			lics[i] = entity.BookLicense{
+				BookLicenseID: fmt.Sprintf("%s%04d", licensePrefix(bookID), seq+i),
+				BookID:        bookID,
+				BookStatusID:  availableID,
+				LicenseModel:  in.Model,
+				ExpiresAt:     in.ExpiresAt,
+				MaxCheckouts:  in.MaxCheckouts,
+			}
+		}
+		if err := tx.Create(&lics).Error; err != nil {
+			return err
+		}
+		for _, l := range lics {
+			ids = append(ids, l.ID)
+		}
+
+		allocated, err := allocateAvailable(tx, bookID, time.Now(), s.HoldPeriod)
+		if err != nil {
+			return err
+		}
+		for i := range allocated {
+			if err := s.Notifications.NotifyReservationReady(tx, &allocated[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out []entity.BookLicense
+	if err := s.DB.Preload("BookStatus").Where("id IN ?", ids).Order("id").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// requeueHold ใช้เมื่อ license ที่ถูก Hold ไว้ให้ผู้จองถูกเปลี่ยนสถานะโดย admin:
+// การจองกลับไปเป็น Waiting (ลำดับคิวเดิมเพราะใช้ ReservationDate เดิม)
+func requeueHold(tx *gorm.DB, licenseID uint) error {
+	notifiedID, err := reservationStatusID(tx, ReservationStatusNotified)
+	if err != nil {
+		return err
+	}
+	waitingID, err := reservationStatusID(tx, ReservationStatusWaiting)
+	if err != nil {
+		return err
+	}
+	return tx.Model(&entity.Reservation{}).
+		Where("allocated_book_license_id = ? AND reservation_status_id = ?", licenseID, notifiedID).
+		Updates(map[string]any{
+			"reservation_status_id":     waitingID,
+			"allocated_book_license_id": nil,
+			"notified_at":               nil,
+			"expires_at":                nil,
+		}).Error
+}
+
+// setStatus เปลี่ยนสถานะ license หนึ่งชุดภายใน tx คืนการจองที่ได้รับ license (ถ้ามี) เพื่อแจ้งเตือน
+func (s *LicenseService) setStatus(tx *gorm.DB, lic *entity.BookLicense, status string, now time.Time) ([]entity.Reservation, error) {
+	if status == BookStatusBorrowed || status == BookStatusHold {
+		return nil, ErrLicenseManualStatus
+	}
+	var target entity.BookStatus
+	if err := tx.Where("status_name = ?", status).First(&target).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLicenseStatusNotFound
+		}
+		return nil, err
+	}
+
+	var active int64
+	if err := tx.Model(&entity.Borrow{}).
+		Where("book_license_id = ? AND return_date IS NULL", lic.ID).
+		Count(&active).Error; err != nil {
+		return nil, err
+	}
+	if active > 0 {
+		return nil, ErrLicenseBorrowed
+	}
+
+	wasHold := lic.BookStatus != nil && lic.BookStatus.StatusName == BookStatusHold
+	if wasHold {
+		if err := requeueHold(tx, lic.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if status == BookStatusAvailable {
+		if licenseSpent(lic, now) {
+			return nil, ErrLicenseSpent
+		}
+		// ส่งต่อให้คิวที่รออยู่ก่อน (license อาจกลายเป็น Hold)
+		r, err := allocateLicense(tx, lic.ID, now, s.HoldPeriod)
+		if err != nil || r == nil {
+			return nil, err
+		}
+		return []entity.Reservation{*r}, nil
+	}
+	if err := tx.Model(&entity.BookLicense{}).Where("id = ?", lic.ID).
+		Update("book_status_id", target.ID).Error; err != nil {
+		return nil, err
+	}
+	if wasHold {
+		// การจองที่ถูกดึงกลับเข้าคิวได้ license ว่างชุดอื่นแทน ถ้ามี
+		return allocateAvailable(tx, lic.BookID, now, s.HoldPeriod)
+	}
+	return nil, nil
+}
+
+// SetStatus เปลี่ยนสถานะ license ด้วยมือ (Available หรือ Retired หรือสถานะอื่นที่ไม่ใช่ Borrowed/Hold)
+func (s *LicenseService) SetStatus(bookID, licenseID uint, status string) (*entity.BookLicense, error) {
+	err := s.Notifications.Transaction(s.DB, func(tx *gorm.DB) error {
+		lic, err := loadBookLicense(tx, bookID, licenseID)
+		if err != nil {
+			return err
+		}
+		allocated, err := s.setStatus(tx, lic, status, time.Now())
+		if err != nil {
+			return err
+		}
+		for i := range allocated {
+			if err := s.Notifications.NotifyReservationReady(tx, &allocated[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loadBookLicense(s.DB, bookID, licenseID)
+}
+
+// Retire เลิกใช้ license หลายชุดพร้อมกัน (ทั้งหมดหรือไม่เลย)
+func (s *LicenseService) Retire(bookID uint, licenseIDs []uint) (*LicenseSummary, error) {
+	err := s.Notifications.Transaction(s.DB, func(tx *gorm.DB) error {
+		now := time.Now()
+		for _, id := range licenseIDs {
+			lic, err := loadBookLicense(tx, bookID, id)
+			if err != nil {
+				return fmt.Errorf("license %d: %w", id, err)
+			}
+			if lic.BookStatus != nil && lic.BookStatus.StatusName == BookStatusRetired {
+				continue
+			}
+			allocated, err := s.setStatus(tx, lic, BookStatusRetired, now)
+			if err != nil {
+				return fmt.Errorf("license %d: %w", id, err)
+			}
+			for i := range allocated {
+				if err := s.Notifications.NotifyReservationReady(tx, &allocated[i]); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return licenseSummary(s.DB, bookID)
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLoginMaxFailures = 5
+	DefaultLoginLockWindow  = 15 * time.Minute
+	// เมื่อจำนวน identifier ที่จำไว้เกินค่านี้จะล้างรายการที่หมดช่วงเวลาแล้วทิ้ง
+	loginThrottlePruneSize = 1024
+)
+
+var ErrTooManyAttempts = errors.New("too many failed login attempts, try again later")
+
+// LoginThrottle นับจำนวนครั้งต่อ key ในหน่วยความจำ (เช่น รหัสผ่านผิดต่อ identifier+IP)
+// ครบ MaxFailures ครั้งภายใน Window นับจากครั้งแรก key นั้นจะถูกปฏิเสธจนกว่าจะพ้น Window
+// (HTTP Basic ส่งรหัสผ่านมาทุกคำขอ ถ้าไม่จำกัดจะถูกใช้เดารหัสผ่านและเผา CPU ได้)
+type LoginThrottle struct {
+	MaxFailures int
+	Window      time.Duration
+	Clock       func() time.Time
+
+	mu       sync.Mutex
+	failures map[string]loginFailures
+}
+
+type loginFailures struct {
+	count int
+	first time.Time
+}
+
+func (l *LoginThrottle) now() time.Time {
+	if l.Clock != nil {
+		return l.Clock()
+	}
+	return time.Now()
+}
+
+func (l *LoginThrottle) limits() (int, time.Duration) {
+	limit, window := l.MaxFailures, l.Window
+	if limit <= 0 {
+		limit = DefaultLoginMaxFailures
+	}
+	if window <= 0 {
+		window = DefaultLoginLockWindow
+	}
+	return limit, window
+}
+
+// ThrottleKey รวมส่วนประกอบเป็น key เดียว (ไม่สนตัวพิมพ์เล็กใหญ่และช่องว่างหัวท้าย)
+func ThrottleKey(parts ...string) string {
+	for i, p := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(p))
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// RetryAfter เวลาที่ต้องรอก่อนลองใหม่ได้ (0 = ลองได้เลย) ถ้าเป็น nil จะไม่จำกัด
+func (l *LoginThrottle) RetryAfter(key string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	limit, window := l.limits()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, ok := l.failures[key]
+	if !ok || f.count < limit {
+		return 0
+	}
+	return max(f.first.Add(window).Sub(l.now()), 0)
+}
+
+// Fail นับเพิ่มหนึ่งครั้งให้ key
+func (l *LoginThrottle) Fail(key string) {
+	if l == nil {
+		return
+	}
+	_, window := l.limits()
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.failures == nil {
+		l.failures = map[string]loginFailures{}
+	}
+	if len(l.failures) >= loginThrottlePruneSize {
+		for k, f := range l.failures {
+			if !now.Before(f.first.Add(window)) {
+				delete(l.failures, k)
+			}
+		}
+	}
+	f, ok := l.failures[key]
+	if !ok || !now.Before(f.first.Add(window)) {
+		f = loginFailures{first: now}
+	}
+	f.count++
+	l.failures[key] = f
+}
+
+// Reset ล้างประวัติของ key (เช่นเมื่อ login สำเร็จ)
+func (l *LoginThrottle) Reset(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, key)
+}
@@ -0,0 +1,23 @@
+package services
+
+import "log"
+
+// OutgoingMessage ข้อความที่ระบบส่งออกถึงผู้ใช้ (เช่น ลิงก์ตั้งรหัสผ่านใหม่)
+type OutgoingMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// MessageSender ช่องทางส่งข้อความออก เปลี่ยนเป็นอีเมล/SMS ได้โดยไม่ต้องแก้ service
+type MessageSender interface {
+	Send(msg OutgoingMessage) error
+}
+
+// LogSender พิมพ์ข้อความลง log แทนการส่งจริง ใช้ตอนพัฒนาบนเครื่อง
+type LogSender struct{}
+
+func (LogSender) Send(msg OutgoingMessage) error {
+	log.Printf("[message] to=%s subject=%q\n%s\n", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// ชื่อ event ที่ส่งออกทาง SSE
+const (
+	HubEventNotification = "notification"
+	HubEventAnnouncement = "announcement"
+)
+
+// StreamTicketTTL อายุของ ticket ที่ใช้เปิด SSE (ใช้ได้ครั้งเดียว)
+const StreamTicketTTL = 30 * time.Second
+
+// subscriptionBuffer จำนวน event ที่ค้างได้ต่อผู้ฟัง ถ้าเต็มจะตัดการเชื่อมต่อให้ client ต่อใหม่
+const subscriptionBuffer = 32
+
+type HubEvent struct {
+	Name string
+	Data any
+}
+
+// Subscription ผู้ฟังหนึ่งราย (หนึ่งการเชื่อมต่อ SSE) ช่อง C จะถูกปิดเมื่อยกเลิกหรือรับไม่ทัน
+type Subscription struct {
+	UserID string
+	C      chan HubEvent
+	once   sync.Once
+}
+
+func (s *Subscription) close() {
+	s.once.Do(func() { close(s.C) })
+}
+
+// Hub pub/sub ภายใน process สำหรับ push การแจ้งเตือนแบบ real-time
+// ใช้ค่าเริ่มต้น (zero value) ได้เลย และปลอดภัยต่อการเรียกพร้อมกันหลาย goroutine
+type Hub struct {
+	mu   sync.RWMutex
+	subs map[string]map[*Subscription]struct{}
+
+	ticketMu sync.Mutex
+	tickets  map[string]streamTicket
+}
+
+type streamTicket struct {
+	userID    string
+	sessionID string
+	expires   time.Time
+}
+
+// IssueStreamTicket ออก ticket อายุสั้นสำหรับเปิด SSE
+// EventSource ของเบราว์เซอร์ใส่ header Authorization ไม่ได้ จึงส่ง ticket ทาง query แทน JWT
+// (query string ถูกเขียนลง access log ticket ที่ใช้ไปแล้วหรือหมดอายุจึงไม่มีค่า)
+// ticket ผูกกับ session ที่ขอ เพื่อให้ stream ปิดตามเมื่อ session ถูกเพิกถอน
+func (h *Hub) IssueStreamTicket(userID, sessionID string) (string, time.Time, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+	exp := now.Add(StreamTicketTTL)
+
+	h.ticketMu.Lock()
+	defer h.ticketMu.Unlock()
+	if h.tickets == nil {
+		h.tickets = map[string]streamTicket{}
+	}
+	for k, t := range h.tickets {
+		if now.After(t.expires) {
+			delete(h.tickets, k)
+		}
+	}
+	h.tickets[ticket] = streamTicket{userID: userID, sessionID: sessionID, expires: exp}
+	return ticket, exp, nil
+}
+
+// RedeemStreamTicket คืนผู้ใช้และ session เจ้าของ ticket แล้วลบ ticket ทิ้ง ok = false ถ้าไม่มีหรือหมดอายุ
+func (h *Hub) RedeemStreamTicket(ticket string) (userID, sessionID string, ok bool) {
+	h.ticketMu.Lock()
+	defer h.ticketMu.Unlock()
+	t, found := h.tickets[ticket]
+	if !found {
+		return "", "", false
+	}
+	delete(h.tickets, ticket)
+	if time.Now().After(t.expires) {
+		return "", "", false
+	}
+	return t.userID, t.sessionID, true
+}
+
+// Subscribe เริ่มฟัง event ของผู้ใช้ (รวม event ที่ broadcast ถึงทุกคน)
+func (h *Hub) Subscribe(userID string) *Subscription {
+	sub := &Subscription{UserID: userID, C: make(chan HubEvent, subscriptionBuffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs == nil {
+		h.subs = map[string]map[*Subscription]struct{}{}
+	}
+	if h.subs[userID] == nil {
+		h.subs[userID] = map[*Subscription]struct{}{}
+	}
+	h.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe เลิกฟังและปิดช่อง (เรียกซ้ำได้)
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	h.remove(sub)
+	h.mu.Unlock()
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	if set, ok := h.subs[sub.UserID]; ok {
+		delete(set, sub)
+		if len(set) == 0 {
+			delete(h.subs, sub.UserID)
+		}
+	}
+	sub.close()
+}
+
+// PublishToUser ส่ง event ให้ทุกการเชื่อมต่อของผู้ใช้คนนั้น
+func (h *Hub) PublishToUser(userID string, ev HubEvent) {
+	if h == nil {
+		return
+	}
+	h.mu.RLock()
+	slow := h.send(h.subs[userID], ev, nil)
+	h.mu.RUnlock()
+	h.drop(slow)
+}
+
+// Broadcast ส่ง event ให้ผู้ฟังทุกคน
+func (h *Hub) Broadcast(ev HubEvent) {
+	if h == nil {
+		return
+	}
+	var slow []*Subscription
+	h.mu.RLock()
+	for _, set := range h.subs {
+		slow = h.send(set, ev, slow)
+	}
+	h.mu.RUnlock()
+	h.drop(slow)
+}
+
+// send ส่งแบบไม่ block; คืนรายการผู้ฟังที่ช่องเต็ม
+func (h *Hub) send(set map[*Subscription]struct{}, ev HubEvent, slow []*Subscription) []*Subscription {
+	for sub := range set {
+		select {
+		case sub.C <- ev:
+		default:
+			slow = append(slow, sub)
+		}
+	}
+	return slow
+}
+
+func (h *Hub) drop(slow []*Subscription) {
+	if len(slow) == 0 {
+		return
+	}
+	h.mu.Lock()
+	for _, sub := range slow {
+		h.remove(sub)
+	}
+	h.mu.Unlock()
+}
+
+// SubscriberCount จำนวนการเชื่อมต่อที่เปิดอยู่ทั้งหมด
+func (h *Hub) SubscriberCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n := 0
+	for _, set := range h.subs {
+		n += len(set)
+	}
+	return n
+}
@@ -0,0 +1,341 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ชื่อ NotificationType (seed ไว้ใน config.CreateDefaultNotificationTypes)
+const (
+	NotificationTypeDueSoon            = "due_soon"
+	NotificationTypeAutoReturned       = "borrow_auto_returned"
+	NotificationTypeReservationReady   = "reservation_ready"
+	NotificationTypeReservationExpired = "reservation_expired"
+)
+
+// สถานะของ Announcement ที่ถือว่าเผยแพร่แล้ว (เทียบแบบไม่สนตัวพิมพ์)
+const AnnouncementStatusPublished = "published"
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// NotificationService จุดเดียวสำหรับสร้างและจัดการ entity.Notification
+// service อื่นเรียกผ่าน Notify* แทนการเขียนแถวเอง (ถ้าเป็น nil จะไม่ทำอะไร)
+// ถ้ามี Hub จะ push การแจ้งเตือนใหม่ไปยังผู้ที่เปิด SSE อยู่
+type NotificationService struct {
+	DB  *gorm.DB
+	Hub *Hub
+}
+
+// pendingKey ใช้เก็บ event ที่รอส่งไว้ใน context ของ transaction
+type pendingKey struct{}
+
+type pendingEvent struct {
+	userID string // ว่าง = broadcast
+	event  HubEvent
+}
+
+// NotifyInput ข้อมูลการแจ้งเตือนหนึ่งรายการ
+type NotifyInput struct {
+	UserID        string
+	Type          string
+	Title         string
+	Message       string
+	BookID        *uint
+	BorrowID      *uint
+	ReservationID *uint
+}
+
+type NotificationPage struct {
+	Items    []entity.Notification `json:"items"`
+	Total    int64                 `json:"total"`
+	Unread   int64                 `json:"unread"`
+	Page     int                   `json:"page"`
+	PageSize int                   `json:"page_size"`
+}
+
+// Notify บันทึกการแจ้งเตือน ถ้า tx เป็น nil จะใช้ s.DB
+func (s *NotificationService) Notify(tx *gorm.DB, in NotifyInput) (*entity.Notification, error) {
+	if s == nil {
+		return nil, nil
+	}
+	if tx == nil {
+		tx = s.DB
+	}
+
+	var nt entity.NotificationType
+	if err := tx.Where("type_name = ?", in.Type).First(&nt).Error; err != nil {
+		return nil, fmt.Errorf("notification type %q not found: %w", in.Type, err)
+	}
+
+	n := entity.Notification{
+		Title:              in.Title,
+		Message:            in.Message,
+		Type:               in.Type,
+		NotificationTypeID: &nt.ID,
+		UserID:             &in.UserID,
+		BookID:             in.BookID,
+		BorrowID:           in.BorrowID,
+		ReservationID:      in.ReservationID,
+	}
+	if err := tx.Omit(clause.Associations).Create(&n).Error; err != nil {
+		return nil, err
+	}
+	s.publish(tx, pendingEvent{userID: in.UserID, event: HubEvent{Name: HubEventNotification, Data: n}})
+	return &n, nil
+}
+
+// Transaction รัน fn ใน transaction แล้วค่อย push event ที่เกิดขึ้นระหว่างนั้นหลัง commit สำเร็จ
+// (ถ้า rollback ผู้ใช้จะไม่ได้รับ event ของแถวที่ไม่ได้ถูกบันทึก)
+func (s *NotificationService) Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if s == nil || s.Hub == nil {
+		return db.Transaction(fn)
+	}
+	pending := &[]pendingEvent{}
+	ctx := context.WithValue(db.Statement.Context, pendingKey{}, pending)
+	if err := db.WithContext(ctx).Transaction(fn); err != nil {
+		return err
+	}
+	for _, p := range *pending {
+		s.dispatch(p)
+	}
+	return nil
+}
+
+// publish ส่ง event ทันที หรือพักไว้จนกว่า transaction ที่ครอบอยู่จะ commit
+func (s *NotificationService) publish(tx *gorm.DB, p pendingEvent) {
+	if s.Hub == nil {
+		return
+	}
+	if tx != nil && tx.Statement.Context != nil {
+		if q, ok := tx.Statement.Context.Value(pendingKey{}).(*[]pendingEvent); ok {
+			*q = append(*q, p)
+			return
+		}
+	}
+	s.dispatch(p)
+}
+
+func (s *NotificationService) dispatch(p pendingEvent) {
+	if p.userID == "" {
+		s.Hub.Broadcast(p.event)
+		return
+	}
+	s.Hub.PublishToUser(p.userID, p.event)
+}
+
+// RegisterCallbacks ผูก GORM callback ให้ broadcast ประกาศทันทีที่ถูกบันทึกเป็นสถานะเผยแพร่
+// ไม่ว่าจะเขียนมาจากส่วนไหนของระบบ
+func (s *NotificationService) RegisterCallbacks() error {
+	if err := s.DB.Callback().Create().After("gorm:create").
+		Register("notification:announcement_create", s.announcementCreated); err != nil {
+		return err
+	}
+	if err := s.DB.Callback().Update().Before("gorm:update").
+		Register("notification:announcement_status", announcementStatusChanged); err != nil {
+		return err
+	}
+	return s.DB.Callback().Update().After("gorm:update").
+		Register("notification:announcement_update", s.announcementUpdated)
+}
+
+// statusChangedKey เก็บผลของ Changed("Status") ซึ่งต้องตรวจก่อน gorm:update จะกำหนดค่าใหม่ลง model
+const statusChangedKey = "notification:status_changed"
+
+func isAnnouncementWrite(db *gorm.DB) bool {
+	st := db.Statement
+	return db.Error == nil && st.Schema != nil && st.Schema.Table == "announcements"
+}
+
+func (s *NotificationService) announcementCreated(db *gorm.DB) {
+	if isAnnouncementWrite(db) {
+		s.broadcastAnnouncements(db)
+	}
+}
+
+// announcementStatusChanged Updates ที่ไม่ได้แตะ status (เช่นแก้คำผิด) ไม่ต้องแจ้งซ้ำ
+// Save (Dest == Model) ตรวจไม่ได้จึงถือว่าเปลี่ยนเสมอ
+func announcementStatusChanged(db *gorm.DB) {
+	if !isAnnouncementWrite(db) {
+		return
+	}
+	st := db.Statement
+	db.InstanceSet(statusChangedKey, st.Dest == st.Model || st.Changed("Status"))
+}
+
+func (s *NotificationService) announcementUpdated(db *gorm.DB) {
+	if !isAnnouncementWrite(db) {
+		return
+	}
+	if changed, ok := db.InstanceGet(statusChangedKey); ok && !changed.(bool) {
+		return
+	}
+	s.broadcastAnnouncements(db)
+}
+
+// broadcastAnnouncements ส่งประกาศที่อยู่ใน statement และมีสถานะเผยแพร่ให้ผู้ฟังทุกคน
+func (s *NotificationService) broadcastAnnouncements(db *gorm.DB) {
+	st := db.Statement
+	var ids []uint
+	collect := func(v reflect.Value) {
+		if a, ok := reflect.Indirect(v).Interface().(entity.Announcement); ok && a.ID != 0 {
+			ids = append(ids, a.ID)
+		}
+	}
+	switch rv := reflect.Indirect(st.ReflectValue); rv.Kind() {
+	case reflect.Struct:
+		collect(rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			collect(rv.Index(i))
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	var rows []entity.Announcement
+	if err := db.Session(&gorm.Session{NewDB: true}).
+		Where("id IN ?", ids).
+		Find(&rows).Error; err != nil {
+		return
+	}
+	for _, a := range rows {
+		if strings.EqualFold(a.Status, AnnouncementStatusPublished) {
+			s.publish(db, pendingEvent{event: HubEvent{Name: HubEventAnnouncement, Data: a}})
+		}
+	}
+}
+
+// NotifyDueSoon แจ้งว่ารายการยืมจะครบกำหนดคืนเร็ว ๆ นี้
+func (s *NotificationService) NotifyDueSoon(tx *gorm.DB, b *entity.Borrow, bookID uint) error {
+	_, err := s.Notify(tx, NotifyInput{
+		UserID:   b.UserID,
+		Type:     NotificationTypeDueSoon,
+		Title:    "Borrow due tomorrow",
+		Message:  fmt.Sprintf("Your borrow is due on %s.", b.DueDate.Format("2006-01-02 15:04")),
+		BookID:   &bookID,
+		BorrowID: &b.ID,
+	})
+	return err
+}
+
+// NotifyAutoReturned แจ้งว่าระบบคืน e-book ให้อัตโนมัติเพราะเลยกำหนด
+func (s *NotificationService) NotifyAutoReturned(tx *gorm.DB, b *entity.Borrow, bookID uint) error {
+	_, err := s.Notify(tx, NotifyInput{
+		UserID:   b.UserID,
+		Type:     NotificationTypeAutoReturned,
+		Title:    "Borrow returned automatically",
+		Message:  "Your loan period has ended and the e-book was returned automatically.",
+		BookID:   &bookID,
+		BorrowID: &b.ID,
+	})
+	return err
+}
+
+// NotifyReservationReady แจ้งผู้จองว่ามี license ถูก Hold ไว้ให้แล้ว (r == nil คือไม่มีคิว)
+func (s *NotificationService) NotifyReservationReady(tx *gorm.DB, r *entity.Reservation) error {
+	if r == nil {
+		return nil
+	}
+	msg := "A copy is being held for you."
+	if r.ExpiresAt != nil {
+		msg = fmt.Sprintf("A copy is being held for you until %s.", r.ExpiresAt.Format("2006-01-02 15:04"))
+	}
+	_, err := s.Notify(tx, NotifyInput{
+		UserID:        r.UserID,
+		Type:          NotificationTypeReservationReady,
+		Title:         "Reserved book is ready",
+		Message:       msg,
+		BookID:        &r.BookID,
+		ReservationID: &r.ID,
+	})
+	return err
+}
+
+// NotifyReservationExpired แจ้งว่าการจองหมดอายุเพราะไม่ได้มายืมทันเวลา
+func (s *NotificationService) NotifyReservationExpired(tx *gorm.DB, r *entity.Reservation) error {
+	_, err := s.Notify(tx, NotifyInput{
+		UserID:        r.UserID,
+		Type:          NotificationTypeReservationExpired,
+		Title:         "Reservation expired",
+		Message:       "The copy held for you was not borrowed in time and has been passed on.",
+		BookID:        &r.BookID,
+		ReservationID: &r.ID,
+	})
+	return err
+}
+
+// List กล่องแจ้งเตือนของผู้ใช้ เรียงใหม่สุดก่อน (unreadOnly = เฉพาะที่ยังไม่อ่าน)
+func (s *NotificationService) List(userID string, unreadOnly bool, page, pageSize int) (*NotificationPage, error) {
+	q := s.DB.Model(&entity.Notification{}).Where("user_id = ?", userID)
+	if unreadOnly {
+		q = q.Where("is_read = ?", false)
+	}
+
+	out := NotificationPage{Page: page, PageSize: pageSize}
+	if err := q.Count(&out.Total).Error; err != nil {
+		return nil, err
+	}
+	unread, err := s.UnreadCount(userID)
+	if err != nil {
+		return nil, err
+	}
+	out.Unread = unread
+
+	if err := q.Preload("NotificationType").
+		Order("created_at DESC, id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&out.Items).Error; err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UnreadCount จำนวนการแจ้งเตือนที่ยังไม่อ่าน
+func (s *NotificationService) UnreadCount(userID string) (int64, error) {
+	var n int64
+	err := s.DB.Model(&entity.Notification{}).
+		Where("user_id = ? AND is_read = ?", userID, false).
+		Count(&n).Error
+	return n, err
+}
+
+// MarkRead ทำเครื่องหมายว่าอ่านแล้วหนึ่งรายการ
+func (s *NotificationService) MarkRead(userID string, id uint) error {
+	var n entity.Notification
+	if err := s.DB.Where("id = ? AND user_id = ?", id, userID).First(&n).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotificationNotFound
+		}
+		return err
+	}
+	return s.DB.Model(&n).Update("is_read", true).Error
+}
+
+// MarkAllRead ทำเครื่องหมายว่าอ่านแล้วทั้งหมด คืนจำนวนที่เปลี่ยน
+func (s *NotificationService) MarkAllRead(userID string) (int64, error) {
+	res := s.DB.Model(&entity.Notification{}).
+		Where("user_id = ? AND is_read = ?", userID, false).
+		Update("is_read", true)
+	return res.RowsAffected, res.Error
+}
+
+// Delete ลบการแจ้งเตือนของผู้ใช้ (soft delete)
+func (s *NotificationService) Delete(userID string, id uint) error {
+	res := s.DB.Where("id = ? AND user_id = ?", id, userID).Delete(&entity.Notification{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
@@ -0,0 +1,577 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+)
+
+// OAIMetadataPrefixDC รูปแบบ metadata เดียวที่ให้บริการ (Dublin Core)
+const OAIMetadataPrefixDC = "oai_dc"
+
+const (
+	oaiNamespace   = "http://www.openarchives.org/OAI/2.0/"
+	oaiSchema      = "http://www.openarchives.org/OAI/2.0/OAI-PMH.xsd"
+	oaiGranularity = "YYYY-MM-DDThh:mm:ssZ"
+	oaiTimeLayout  = "2006-01-02T15:04:05Z"
+	oaiDayLayout   = "2006-01-02"
+
+	// oaiPageSize จำนวน record ต่อหนึ่งคำตอบของ ListRecords / ListIdentifiers ที่เหลือต่อด้วย resumptionToken
+	oaiPageSize = 100
+
+	// oaiDatestampSQL datestamp ของหนังสือ: เวลาที่ถูกลบ (soft delete) หรือแก้ไขล่าสุด ปัดเป็นวินาทีแบบ UTC
+	// ใช้ datetime() ของ SQLite เพราะเวลาที่บันทึกไว้มี timezone offset ต่างกันจึงเทียบเป็นข้อความตรง ๆ ไม่ได้
+	oaiDatestampSQL  = "datetime(COALESCE(books.deleted_at, books.updated_at))"
+	oaiSQLTimeLayout = "2006-01-02 15:04:05"
+)
+
+// error code ตาม OAI-PMH 2.0 หัวข้อ 3.6
+const (
+	OAIBadArgument             = "badArgument"
+	OAIBadResumptionToken      = "badResumptionToken"
+	OAIBadVerb                 = "badVerb"
+	OAICannotDisseminateFormat = "cannotDisseminateFormat"
+	OAIIDDoesNotExist          = "idDoesNotExist"
+	OAINoRecordsMatch          = "noRecordsMatch"
+	OAINoSetHierarchy          = "noSetHierarchy"
+)
+
+// OAIService ให้ห้องสมุดอื่นเก็บเกี่ยวแค็ตตาล็อกผ่าน OAI-PMH 2.0
+// หนังสือที่ถูกลบแบบ soft delete ยังคงถูกรายงานเป็น deleted record ตลอดไป (deletedRecord = persistent)
+type OAIService struct {
+	DB             *gorm.DB
+	RepositoryName string
+	// RepositoryIdentifier ส่วนกลางของ oai-identifier เช่น library.example.ac.th (ว่าง = host ของ baseURL)
+	RepositoryIdentifier string
+	// AdminEmails ว่าง = อีเมลของ admin ที่ยังไม่ถูกระงับในระบบ
+	AdminEmails []string
+}
+
+// OAIError error ที่รายงานในคำตอบของ OAI-PMH (HTTP status ยังเป็น 200)
+type OAIError struct {
+	Code    string `xml:"code,attr"`
+	Message string `xml:",chardata"`
+}
+
+func (e *OAIError) Error() string { return e.Code + ": " + e.Message }
+
+func oaiError(code, format string, args ...any) *OAIError {
+	return &OAIError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// OAIResponse เอกสาร <OAI-PMH> มีคำตอบของ verb ที่เรียกหรือ error อย่างใดอย่างหนึ่ง
+type OAIResponse struct {
+	XMLName        xml.Name `xml:"OAI-PMH"`
+	Xmlns          string   `xml:"xmlns,attr"`
+	XSI            string   `xml:"xmlns:xsi,attr"`
+	SchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+	ResponseDate   string   `xml:"responseDate"`
+	Request        oaiRequest
+	Errors         []*OAIError `xml:"error"`
+
+	Identify            *oaiIdentify            `xml:"Identify"`
+	ListMetadataFormats *oaiListMetadataFormats `xml:"ListMetadataFormats"`
+	GetRecord           *oaiGetRecord           `xml:"GetRecord"`
+	ListRecords         *oaiListRecords         `xml:"ListRecords"`
+	ListIdentifiers     *oaiListIdentifiers     `xml:"ListIdentifiers"`
+}
+
+// oaiRequest ทวน argument ของคำขอ (ไม่ใส่ argument เมื่อเป็น badVerb / badArgument ตามข้อกำหนด)
+type oaiRequest struct {
+	XMLName         xml.Name `xml:"request"`
+	Verb            string   `xml:"verb,attr,omitempty"`
+	Identifier      string   `xml:"identifier,attr,omitempty"`
+	MetadataPrefix  string   `xml:"metadataPrefix,attr,omitempty"`
+	From            string   `xml:"from,attr,omitempty"`
+	Until           string   `xml:"until,attr,omitempty"`
+	Set             string   `xml:"set,attr,omitempty"`
+	ResumptionToken string   `xml:"resumptionToken,attr,omitempty"`
+	BaseURL         string   `xml:",chardata"`
+}
+
+type oaiIdentify struct {
+	RepositoryName    string   `xml:"repositoryName"`
+	BaseURL           string   `xml:"baseURL"`
+	ProtocolVersion   string   `xml:"protocolVersion"`
+	AdminEmail        []string `xml:"adminEmail"`
+	EarliestDatestamp string   `xml:"earliestDatestamp"`
+	DeletedRecord     string   `xml:"deletedRecord"`
+	Granularity       string   `xml:"granularity"`
+}
+
+type oaiMetadataFormat struct {
+	MetadataPrefix    string `xml:"metadataPrefix"`
+	Schema            string `xml:"schema"`
+	MetadataNamespace string `xml:"metadataNamespace"`
+}
+
+type oaiListMetadataFormats struct {
+	Formats []oaiMetadataFormat `xml:"metadataFormat"`
+}
+
+type oaiHeader struct {
+	Status     string `xml:"status,attr,omitempty"`
+	Identifier string `xml:"identifier"`
+	Datestamp  string `xml:"datestamp"`
+}
+
+type oaiMetadata struct {
+	DC *DublinCore
+}
+
+type oaiRecord struct {
+	Header   oaiHeader    `xml:"header"`
+	Metadata *oaiMetadata `xml:"metadata"`
+}
+
+type oaiGetRecord struct {
+	Record oaiRecord `xml:"record"`
+}
+
+type oaiResumptionToken struct {
+	CompleteListSize int    `xml:"completeListSize,attr"`
+	Cursor           int    `xml:"cursor,attr"`
+	Value            string `xml:",chardata"`
+}
+
+type oaiListRecords struct {
+	Records         []oaiRecord         `xml:"record"`
+	ResumptionToken *oaiResumptionToken `xml:"resumptionToken"`
+}
+
+type oaiListIdentifiers struct {
+	Headers         []oaiHeader         `xml:"header"`
+	ResumptionToken *oaiResumptionToken `xml:"resumptionToken"`
+}
+
+// oaiVerbs argument ที่แต่ละ verb รับ (ListRecords / ListIdentifiers ต้องมี metadataPrefix ถ้าไม่ได้ส่ง resumptionToken)
+var oaiVerbs = map[string]struct{ required, optional []string }{
+	"Identify":            {},
+	"ListMetadataFormats": {optional: []string{"identifier"}},
+	"GetRecord":           {required: []string{"identifier", "metadataPrefix"}},
+	"ListRecords":         {optional: []string{"metadataPrefix", "from", "until", "set", "resumptionToken"}},
+	"ListIdentifiers":     {optional: []string{"metadataPrefix", "from", "until", "set", "resumptionToken"}},
+}
+
+// Handle ตอบคำขอ OAI-PMH หนึ่งครั้ง args มาจาก query string (GET) หรือ form (POST)
+// error ที่คืนเป็นปัญหาภายใน (เช่นฐานข้อมูล) ส่วน error ของโปรโตคอลอยู่ใน OAIResponse.Errors
+func (s *OAIService) Handle(baseURL string, args url.Values) (*OAIResponse, error) {
+	resp := &OAIResponse{
+		Xmlns:          oaiNamespace,
+		XSI:            xsiNamespace,
+		SchemaLocation: oaiNamespace + " " + oaiSchema,
+		ResponseDate:   time.Now().UTC().Format(oaiTimeLayout),
+		Request:        oaiRequest{BaseURL: baseURL},
+	}
+
+	verbs := args["verb"]
+	if len(verbs) != 1 {
+		resp.Errors = append(resp.Errors, oaiError(OAIBadVerb, "verb is missing or repeated"))
+		return resp, nil
+	}
+	verb := verbs[0]
+	spec, ok := oaiVerbs[verb]
+	if !ok {
+		resp.Errors = append(resp.Errors, oaiError(OAIBadVerb, "illegal verb %q", verb))
+		return resp, nil
+	}
+	allowed := map[string]bool{"verb": true}
+	for _, a := range append(spec.required, spec.optional...) {
+		allowed[a] = true
+	}
+	for name, values := range args {
+		switch {
+		case !allowed[name]:
+			resp.Errors = append(resp.Errors, oaiError(OAIBadArgument, "illegal argument %q", name))
+		case len(values) > 1:
+			resp.Errors = append(resp.Errors, oaiError(OAIBadArgument, "argument %q is repeated", name))
+		}
+	}
+	for _, name := range spec.required {
+		if args.Get(name) == "" {
+			resp.Errors = append(resp.Errors, oaiError(OAIBadArgument, "missing required argument %q", name))
+		}
+	}
+	if verb == "ListRecords" || verb == "ListIdentifiers" {
+		if args.Has("resumptionToken") && len(args) > 2 {
+			resp.Errors = append(resp.Errors, oaiError(OAIBadArgument, "resumptionToken is an exclusive argument"))
+		}
+		if !args.Has("resumptionToken") && args.Get("metadataPrefix") == "" {
+			resp.Errors = append(resp.Errors, oaiError(OAIBadArgument, "missing required argument \"metadataPrefix\""))
+		}
+	}
+	if len(resp.Errors) > 0 {
+		return resp, nil
+	}
+	resp.Request = oaiRequest{
+		Verb:            verb,
+		Identifier:      args.Get("identifier"),
+		MetadataPrefix:  args.Get("metadataPrefix"),
+		From:            args.Get("from"),
+		Until:           args.Get("until"),
+		Set:             args.Get("set"),
+		ResumptionToken: args.Get("resumptionToken"),
+		BaseURL:         baseURL,
+	}
+
+	repo := s.repositoryIdentifier(baseURL)
+	var err error
+	switch verb {
+	case "Identify":
+		resp.Identify, err = s.identify(baseURL)
+	case "ListMetadataFormats":
+		resp.ListMetadataFormats, err = s.listMetadataFormats(repo, args.Get("identifier"))
+	case "GetRecord":
+		resp.GetRecord, err = s.getRecord(repo, args.Get("identifier"), args.Get("metadataPrefix"))
+	case "ListRecords", "ListIdentifiers":
+		var page *oaiPage
+		page, err = s.list(repo, args, verb == "ListRecords")
+		if err == nil && verb == "ListRecords" {
+			resp.ListRecords = &oaiListRecords{Records: page.records, ResumptionToken: page.token}
+		} else if err == nil {
+			resp.ListIdentifiers = &oaiListIdentifiers{ResumptionToken: page.token}
+			for _, r := range page.records {
+				resp.ListIdentifiers.Headers = append(resp.ListIdentifiers.Headers, r.Header)
+			}
+		}
+	}
+	if oe, ok := err.(*OAIError); ok {
+		resp.Errors = append(resp.Errors, oe)
+		return resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *OAIService) repositoryIdentifier(baseURL string) string {
+	if s.RepositoryIdentifier != "" {
+		return s.RepositoryIdentifier
+	}
+	if u, err := url.Parse(baseURL); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return "localhost"
+}
+
+// oaiIdentifier ตัวระบุ record ของหนังสือ เช่น oai:library.example.ac.th:book/12
+func oaiIdentifier(repo string, bookID uint) string {
+	return fmt.Sprintf("oai:%s:book/%d", repo, bookID)
+}
+
+// parseOAIIdentifier คืน id ของหนังสือจาก oai-identifier ของ repository นี้
+func parseOAIIdentifier(repo, identifier string) (uint, bool) {
+	rest, ok := strings.CutPrefix(identifier, "oai:"+repo+":book/")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(rest, 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// oaiDatestamp เวลาที่ถูกลบหรือแก้ไขล่าสุด ตรงกับ oaiDatestampSQL
+func oaiDatestamp(b *entity.Book) time.Time {
+	t := b.UpdatedAt
+	if b.DeletedAt.Valid {
+		t = b.DeletedAt.Time
+	}
+	return t.UTC().Truncate(time.Second)
+}
+
+func (s *OAIService) identify(baseURL string) (*oaiIdentify, error) {
+	emails := s.AdminEmails
+	if len(emails) == 0 {
+		if err := s.DB.Model(&entity.User{}).
+			Joins("JOIN roles ON roles.id = users.role_id").
+			Where("roles.name = ? AND users.disabled_at IS NULL", RoleAdmin).
+			Order("users.user_id").
+			Pluck("users.email", &emails).Error; err != nil {
+			return nil, err
+		}
+	}
+	var earliest *string
+	if err := s.DB.Unscoped().Model(&entity.Book{}).
+		Select("MIN(" + oaiDatestampSQL + ")").
+		Scan(&earliest).Error; err != nil {
+		return nil, err
+	}
+	stamp := time.Now().UTC()
+	if earliest != nil {
+		if t, err := time.Parse(oaiSQLTimeLayout, *earliest); err == nil {
+			stamp = t
+		}
+	}
+	name := s.RepositoryName
+	if name == "" {
+		name = "Library catalog"
+	}
+	return &oaiIdentify{
+		RepositoryName:    name,
+		BaseURL:           baseURL,
+		ProtocolVersion:   "2.0",
+		AdminEmail:        emails,
+		EarliestDatestamp: stamp.Format(oaiTimeLayout),
+		DeletedRecord:     "persistent",
+		Granularity:       oaiGranularity,
+	}, nil
+}
+
+func (s *OAIService) listMetadataFormats(repo, identifier string) (*oaiListMetadataFormats, error) {
+	if identifier != "" {
+		if _, err := s.findRecordBook(repo, identifier); err != nil {
+			return nil, err
+		}
+	}
+	return &oaiListMetadataFormats{Formats: []oaiMetadataFormat{{
+		MetadataPrefix:    OAIMetadataPrefixDC,
+		Schema:            oaiDCSchema,
+		MetadataNamespace: oaiDCNamespace,
+	}}}, nil
+}
+
+// findRecordBook หาหนังสือ (รวมที่ถูกลบแล้ว) ตาม oai-identifier
+func (s *OAIService) findRecordBook(repo, identifier string) (*entity.Book, error) {
+	id, ok := parseOAIIdentifier(repo, identifier)
+	if !ok {
+		return nil, oaiError(OAIIDDoesNotExist, "unknown identifier %q", identifier)
+	}
+	var b entity.Book
+	if err := s.DB.Unscoped().Limit(1).Find(&b, id).Error; err != nil {
+		return nil, err
+	}
+	if b.ID == 0 {
+		return nil, oaiError(OAIIDDoesNotExist, "unknown identifier %q", identifier)
+	}
+	return &b, nil
+}
+
+func (s *OAIService) getRecord(repo, identifier, prefix string) (*oaiGetRecord, error) {
+	if prefix != OAIMetadataPrefixDC {
+		return nil, oaiError(OAICannotDisseminateFormat, "metadataPrefix %q is not supported", prefix)
+	}
+	b, err := s.findRecordBook(repo, identifier)
+	if err != nil {
+		return nil, err
+	}
+	records, err := s.records(repo, []entity.Book{*b}, true)
+	if err != nil {
+		return nil, err
+	}
+	return &oaiGetRecord{Record: records[0]}, nil
+}
+
+// records สร้าง record จากหนังสือ (header อย่างเดียวถ้า withMetadata = false หรือหนังสือถูกลบแล้ว)
+func (s *OAIService) records(repo string, books []entity.Book, withMetadata bool) ([]oaiRecord, error) {
+	live := map[uint]*entity.Book{}
+	if withMetadata {
+		var ids []uint
+		for _, b := range books {
+			if !b.DeletedAt.Valid {
+				ids = append(ids, b.ID)
+			}
+		}
+		// โหลดข้อมูลอ้างอิงแบบปกติ (ไม่ Unscoped) เพื่อไม่ให้หมวดหมู่ที่ถูกลบติดมาด้วย
+		var loaded []entity.Book
+		if len(ids) > 0 {
+			if err := preloadDublinCore(s.DB).Find(&loaded, ids).Error; err != nil {
+				return nil, err
+			}
+		}
+		for i := range loaded {
+			live[loaded[i].ID] = &loaded[i]
+		}
+	}
+
+	out := make([]oaiRecord, 0, len(books))
+	for i := range books {
+		b := &books[i]
+		r := oaiRecord{Header: oaiHeader{
+			Identifier: oaiIdentifier(repo, b.ID),
+			Datestamp:  oaiDatestamp(b).Format(oaiTimeLayout),
+		}}
+		if b.DeletedAt.Valid {
+			r.Header.Status = "deleted"
+		} else if full, ok := live[b.ID]; ok {
+			r.Metadata = &oaiMetadata{DC: DublinCoreOf(full)}
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// oaiListState ตำแหน่งของรายการที่ยังส่งไม่หมด เข้ารหัสเป็น resumptionToken (ไม่เก็บสถานะไว้ที่ server)
+// แบ่งหน้าด้วย (datestamp, id) ของ record สุดท้าย จึงไม่ข้ามหรือซ้ำแม้มีหนังสือเพิ่มระหว่างเก็บเกี่ยว
+type oaiListState struct {
+	prefix      string
+	from, until string // รูปแบบ oaiSQLTimeLayout ว่าง = ไม่จำกัด
+	afterStamp  string
+	afterID     uint
+	cursor      int
+	total       int
+}
+
+func (st *oaiListState) encode() string {
+	raw := strings.Join([]string{
+		st.prefix, st.from, st.until, st.afterStamp,
+		strconv.FormatUint(uint64(st.afterID), 10), strconv.Itoa(st.cursor), strconv.Itoa(st.total),
+	}, "|")
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeOAIListState(token string) (*oaiListState, error) {
+	bad := oaiError(OAIBadResumptionToken, "resumptionToken is invalid")
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, bad
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 7 || parts[0] != OAIMetadataPrefixDC {
+		return nil, bad
+	}
+	for _, p := range parts[1:4] {
+		if _, err := time.Parse(oaiSQLTimeLayout, p); p != "" && err != nil {
+			return nil, bad
+		}
+	}
+	afterID, err1 := strconv.ParseUint(parts[4], 10, 64)
+	cursor, err2 := strconv.Atoi(parts[5])
+	total, err3 := strconv.Atoi(parts[6])
+	if err1 != nil || err2 != nil || err3 != nil || cursor < 0 || total < cursor {
+		return nil, bad
+	}
+	return &oaiListState{
+		prefix: parts[0], from: parts[1], until: parts[2], afterStamp: parts[3],
+		afterID: uint(afterID), cursor: cursor, total: total,
+	}, nil
+}
+
+// parseOAIDate รับ YYYY-MM-DD หรือ YYYY-MM-DDThh:mm:ssZ คืนเวลาในรูปแบบ oaiSQLTimeLayout
+// until แบบวันรวมทั้งวัน
+func parseOAIDate(v string, until bool) (string, bool, error) {
+	if t, err := time.Parse(oaiTimeLayout, v); err == nil {
+		return t.Format(oaiSQLTimeLayout), false, nil
+	}
+	t, err := time.Parse(oaiDayLayout, v)
+	if err != nil {
+		return "", false, err
+	}
+	if until {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t.Format(oaiSQLTimeLayout), true, nil
+}
+
+type oaiPage struct {
+	records []oaiRecord
+	token   *oaiResumptionToken
+}
+
+// list หน้าหนึ่งของ ListRecords / ListIdentifiers เรียงตาม datestamp แล้ว id
+func (s *OAIService) list(repo string, args url.Values, withMetadata bool) (*oaiPage, error) {
+	var st *oaiListState
+	if token := args.Get("resumptionToken"); token != "" {
+		var err error
+		if st, err = decodeOAIListState(token); err != nil {
+			return nil, err
+		}
+	} else {
+		if args.Get("set") != "" {
+			return nil, oaiError(OAINoSetHierarchy, "this repository does not support sets")
+		}
+		prefix := args.Get("metadataPrefix")
+		if prefix != OAIMetadataPrefixDC {
+			return nil, oaiError(OAICannotDisseminateFormat, "metadataPrefix %q is not supported", prefix)
+		}
+		st = &oaiListState{prefix: prefix}
+		var fromDay, untilDay bool
+		var err error
+		if v := args.Get("from"); v != "" {
+			if st.from, fromDay, err = parseOAIDate(v, false); err != nil {
+				return nil, oaiError(OAIBadArgument, "from %q is not a valid date", v)
+			}
+		}
+		if v := args.Get("until"); v != "" {
+			if st.until, untilDay, err = parseOAIDate(v, true); err != nil {
+				return nil, oaiError(OAIBadArgument, "until %q is not a valid date", v)
+			}
+		}
+		if st.from != "" && st.until != "" {
+			if fromDay != untilDay {
+				return nil, oaiError(OAIBadArgument, "from and until must have the same granularity")
+			}
+			if st.from > st.until {
+				return nil, oaiError(OAIBadArgument, "from must not be later than until")
+			}
+		}
+	}
+
+	q := s.DB.Unscoped().Model(&entity.Book{})
+	if st.from != "" {
+		q = q.Where(oaiDatestampSQL+" >= ?", st.from)
+	}
+	if st.until != "" {
+		q = q.Where(oaiDatestampSQL+" <= ?", st.until)
+	}
+	if st.afterStamp == "" && st.cursor == 0 {
+		var total int64
+		if err := q.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			return nil, err
+		}
+		if total == 0 {
+			return nil, oaiError(OAINoRecordsMatch, "no records match the request")
+		}
+		st.total = int(total)
+	}
+	if st.afterStamp != "" {
+		q = q.Where("("+oaiDatestampSQL+" > ? OR ("+oaiDatestampSQL+" = ? AND books.id > ?))",
+			st.afterStamp, st.afterStamp, st.afterID)
+	}
+
+	var books []entity.Book
+	if err := q.Select("books.id", "books.updated_at", "books.deleted_at").
+		Order(oaiDatestampSQL).Order("books.id").
+		Limit(oaiPageSize + 1).
+		Find(&books).Error; err != nil {
+		return nil, err
+	}
+	more := len(books) > oaiPageSize
+	if more {
+		books = books[:oaiPageSize]
+	}
+	if len(books) == 0 && st.cursor == 0 {
+		return nil, oaiError(OAINoRecordsMatch, "no records match the request")
+	}
+	records, err := s.records(repo, books, withMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &oaiPage{records: records}
+	// รายการที่ถูกแบ่งหน้า: หน้าสุดท้ายส่ง resumptionToken ว่างเพื่อบอกว่าจบแล้ว
+	if more || st.cursor > 0 {
+		page.token = &oaiResumptionToken{CompleteListSize: st.total, Cursor: st.cursor}
+	}
+	if more {
+		last := &books[len(books)-1]
+		next := *st
+		next.afterStamp = oaiDatestamp(last).Format(oaiSQLTimeLayout)
+		next.afterID = last.ID
+		next.cursor = st.cursor + len(books)
+		if next.total < next.cursor {
+			next.total = next.cursor
+		}
+		page.token.Value = next.encode()
+	}
+	return page, nil
+}
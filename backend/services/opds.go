@@ -0,0 +1,546 @@
+package services
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+)
+
+// ชนิดของเอกสาร OPDS 1.2
+const (
+	OPDSNavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	OPDSAcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	OPDSEntryType       = "application/atom+xml;type=entry;profile=opds-catalog"
+	OpenSearchType      = "application/opensearchdescription+xml"
+)
+
+// rel ของลิงก์ที่ใช้ในฟีด
+const (
+	opdsRelAcquisition = "http://opds-spec.org/acquisition"
+	opdsRelBorrow      = "http://opds-spec.org/acquisition/borrow"
+	opdsRelImage       = "http://opds-spec.org/image"
+	opdsRelThumbnail   = "http://opds-spec.org/image/thumbnail"
+	opdsRelShelf       = "http://opds-spec.org/shelf"
+	opdsRelNew         = "http://opds-spec.org/sort/new"
+)
+
+const (
+	atomNamespace       = "http://www.w3.org/2005/Atom"
+	opdsNamespace       = "http://opds-spec.org/2010/catalog"
+	openSearchNamespace = "http://a9.com/-/spec/opensearch/1.1/"
+	dcTermsNamespace    = "http://purl.org/dc/terms/"
+)
+
+// OPDSPageSize จำนวนรายการต่อหน้าของฟีด
+const OPDSPageSize = 25
+
+var ErrAuthorNotFound = errors.New("author not found")
+
+// OPDSService สร้างฟีด OPDS 1.2 (Atom) ของแค็ตตาล็อกให้แอปอ่าน e-book
+// ฟีดนำทาง: หน้าแรก หมวดหมู่ ผู้แต่ง / ฟีดหนังสือ: ใหม่ล่าสุด ตามหมวดหมู่ ตามผู้แต่ง ผลค้นหา ชั้นหนังสือที่ยืมอยู่
+type OPDSService struct {
+	DB      *gorm.DB
+	Catalog *CatalogService
+	Title   string // ชื่อแค็ตตาล็อก (ว่าง = "Library catalog")
+}
+
+// OPDSRequest ข้อมูลของคำขอที่ใช้สร้างฟีด
+type OPDSRequest struct {
+	BaseURL string // URL ของ /api เช่น https://library.example.ac.th/api ใช้สร้างลิงก์แบบเต็ม
+	UserID  string // ผู้ใช้ที่ login ใช้เลือกระหว่างลิงก์ยืมกับลิงก์ดาวน์โหลด
+	Page    int
+}
+
+func (r OPDSRequest) href(format string, args ...any) string {
+	return r.BaseURL + fmt.Sprintf(format, args...)
+}
+
+type OPDSFeed struct {
+	XMLName    xml.Name `xml:"feed"`
+	Xmlns      string   `xml:"xmlns,attr"`
+	DC         string   `xml:"xmlns:dc,attr"`
+	OPDS       string   `xml:"xmlns:opds,attr"`
+	OpenSearch string   `xml:"xmlns:opensearch,attr"`
+
+	ID           string       `xml:"id"`
+	Title        string       `xml:"title"`
+	Updated      string       `xml:"updated"`
+	Author       *OPDSAuthor  `xml:"author"`
+	TotalResults *int64       `xml:"opensearch:totalResults"`
+	ItemsPerPage *int         `xml:"opensearch:itemsPerPage"`
+	StartIndex   *int         `xml:"opensearch:startIndex"`
+	Links        []OPDSLink   `xml:"link"`
+	Entries      []*OPDSEntry `xml:"entry"`
+
+	Kind string `xml:"-"` // OPDSNavigationType | OPDSAcquisitionType ใช้เป็น Content-Type
+}
+
+type OPDSEntry struct {
+	XMLName xml.Name `xml:"entry"`
+	// namespace ใส่เฉพาะ entry ที่ส่งเป็นเอกสารเดี่ยว
+	Xmlns string `xml:"xmlns,attr,omitempty"`
+	DC    string `xml:"xmlns:dc,attr,omitempty"`
+	OPDS  string `xml:"xmlns:opds,attr,omitempty"`
+
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Authors    []OPDSAuthor   `xml:"author"`
+	Identifier string         `xml:"dc:identifier,omitempty"`
+	Language   string         `xml:"dc:language,omitempty"`
+	Publisher  string         `xml:"dc:publisher,omitempty"`
+	Issued     string         `xml:"dc:issued,omitempty"`
+	Categories []OPDSCategory `xml:"category"`
+	Summary    *OPDSText      `xml:"summary"`
+	Content    *OPDSText      `xml:"content"`
+	Links      []OPDSLink     `xml:"link"`
+}
+
+type OPDSAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type OPDSCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type OPDSText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Text string `xml:",chardata"`
+}
+
+type OPDSLink struct {
+	Rel      string                   `xml:"rel,attr,omitempty"`
+	Href     string                   `xml:"href,attr"`
+	Type     string                   `xml:"type,attr,omitempty"`
+	Title    string                   `xml:"title,attr,omitempty"`
+	Indirect *OPDSIndirectAcquisition `xml:"opds:indirectAcquisition"`
+}
+
+// OPDSIndirectAcquisition ชนิดไฟล์ที่จะได้หลังจากทำตามลิงก์ (เช่นยืมแล้วได้ไฟล์ EPUB)
+type OPDSIndirectAcquisition struct {
+	Type string `xml:"type,attr"`
+}
+
+// OpenSearchDescription บอกแอปว่าค้นหาในแค็ตตาล็อกได้ที่ URL ใด
+type OpenSearchDescription struct {
+	XMLName       xml.Name `xml:"OpenSearchDescription"`
+	Xmlns         string   `xml:"xmlns,attr"`
+	ShortName     string   `xml:"ShortName"`
+	Description   string   `xml:"Description"`
+	InputEncoding string   `xml:"InputEncoding"`
+	URL           struct {
+		Type     string `xml:"type,attr"`
+		Template string `xml:"template,attr"`
+	} `xml:"Url"`
+}
+
+func (s *OPDSService) title() string {
+	if s.Title != "" {
+		return s.Title
+	}
+	return "Library catalog"
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// newFeed ฟีดว่างพร้อมลิงก์ self/start/search path คือ path ใต้ /api ไม่รวม ?page=
+func (s *OPDSService) newFeed(r OPDSRequest, kind, path, title string) *OPDSFeed {
+	return &OPDSFeed{
+		Xmlns:      atomNamespace,
+		DC:         dcTermsNamespace,
+		OPDS:       opdsNamespace,
+		OpenSearch: openSearchNamespace,
+		ID:         r.href("%s", path),
+		Title:      title,
+		Updated:    atomTime(time.Now()),
+		Author:     &OPDSAuthor{Name: s.title()},
+		Links: []OPDSLink{
+			{Rel: "self", Href: r.href("%s", pageURL(path, r.Page)), Type: kind},
+			{Rel: "start", Href: r.href("/opds"), Type: OPDSNavigationType, Title: s.title()},
+			{Rel: "search", Href: r.href("/opds/opensearch.xml"), Type: OpenSearchType},
+		},
+		Kind: kind,
+	}
+}
+
+// pageURL ต่อ ?page= เข้ากับ path (หน้า 1 ไม่ต้องใส่) path อาจมี query อยู่แล้ว
+func pageURL(path string, page int) string {
+	if page <= 1 {
+		return path
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return path
+	}
+	q := u.Query()
+	q.Set("page", strconv.Itoa(page))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// paginate ใส่ลิงก์ first/previous/next และค่า opensearch ของหน้าปัจจุบัน
+func paginate(f *OPDSFeed, r OPDSRequest, path string, total int64) {
+	page := max(r.Page, 1)
+	perPage := OPDSPageSize
+	start := (page-1)*OPDSPageSize + 1
+	f.TotalResults, f.ItemsPerPage, f.StartIndex = &total, &perPage, &start
+	if page > 1 {
+		f.Links = append(f.Links,
+			OPDSLink{Rel: "first", Href: r.href("%s", path), Type: f.Kind},
+			OPDSLink{Rel: "previous", Href: r.href("%s", pageURL(path, page-1)), Type: f.Kind})
+	}
+	if int64(page*OPDSPageSize) < total {
+		f.Links = append(f.Links, OPDSLink{Rel: "next", Href: r.href("%s", pageURL(path, page+1)), Type: f.Kind})
+	}
+}
+
+func offsetOf(page int) int {
+	return (max(page, 1) - 1) * OPDSPageSize
+}
+
+// navEntry entry ของฟีดนำทางที่ชี้ไปยังฟีดอื่น
+func navEntry(r OPDSRequest, path, title, content, kind string) *OPDSEntry {
+	e := &OPDSEntry{
+		Title:   title,
+		ID:      r.href("%s", path),
+		Updated: atomTime(time.Now()),
+		Links:   []OPDSLink{{Rel: "subsection", Href: r.href("%s", path), Type: kind}},
+	}
+	if content != "" {
+		e.Content = &OPDSText{Type: "text", Text: content}
+	}
+	return e
+}
+
+// Root หน้าแรกของแค็ตตาล็อก
+func (s *OPDSService) Root(r OPDSRequest) *OPDSFeed {
+	f := s.newFeed(r, OPDSNavigationType, "/opds", s.title())
+	f.Links = append(f.Links,
+		OPDSLink{Rel: opdsRelShelf, Href: r.href("/opds/shelf"), Type: OPDSAcquisitionType, Title: "My borrowed books"},
+		OPDSLink{Rel: opdsRelNew, Href: r.href("/opds/new"), Type: OPDSAcquisitionType, Title: "New books"})
+	f.Entries = []*OPDSEntry{
+		navEntry(r, "/opds/new", "New books", "Recently added books", OPDSAcquisitionType),
+		navEntry(r, "/opds/categories", "Categories", "Browse books by category", OPDSNavigationType),
+		navEntry(r, "/opds/authors", "Authors", "Browse books by author", OPDSNavigationType),
+		navEntry(r, "/opds/shelf", "My borrowed books", "Books you are borrowing now", OPDSAcquisitionType),
+	}
+	return f
+}
+
+// Categories ฟีดนำทางของหมวดหมู่ใต้ parentID (0 = หมวดหมู่ระดับบนสุด)
+// หมวดที่มีหมวดย่อยชี้ไปยังฟีดนำทางของตัวเอง ส่วนหมวดปลายทางชี้ไปยังรายการหนังสือเลย
+func (s *OPDSService) Categories(r OPDSRequest, parentID uint) (*OPDSFeed, error) {
+	path, title := "/opds/categories", "Categories"
+	q := s.DB.Model(&entity.Category{}).Preload("CategoryStatics")
+	if parentID == 0 {
+		q = q.Where("parent_id IS NULL")
+	} else {
+		parent, err := ensureCategoryExists(s.DB, parentID)
+		if err != nil {
+			return nil, err
+		}
+		path, title = fmt.Sprintf("/opds/categories/%d", parentID), parent.CategoryName
+		q = q.Where("parent_id = ?", parentID)
+	}
+	var cats []entity.Category
+	if err := q.Order("category_name").Find(&cats).Error; err != nil {
+		return nil, err
+	}
+	var parents []uint
+	if err := s.DB.Model(&entity.Category{}).Distinct("parent_id").
+		Where("parent_id IS NOT NULL").Pluck("parent_id", &parents).Error; err != nil {
+		return nil, err
+	}
+	hasChildren := make(map[uint]bool, len(parents))
+	for _, id := range parents {
+		hasChildren[id] = true
+	}
+
+	f := s.newFeed(r, OPDSNavigationType, path, title)
+	if parentID != 0 {
+		f.Entries = append(f.Entries, navEntry(r, fmt.Sprintf("/opds/categories/%d/books", parentID),
+			"All books in "+title, "", OPDSAcquisitionType))
+	}
+	for _, c := range cats {
+		count := 0
+		if c.CategoryStatics != nil {
+			count = c.CategoryStatics.SubtreeBookCount
+		}
+		content := fmt.Sprintf("%d books", count)
+		if hasChildren[c.ID] {
+			f.Entries = append(f.Entries, navEntry(r, fmt.Sprintf("/opds/categories/%d", c.ID), c.CategoryName, content, OPDSNavigationType))
+		} else {
+			f.Entries = append(f.Entries, navEntry(r, fmt.Sprintf("/opds/categories/%d/books", c.ID), c.CategoryName, content, OPDSAcquisitionType))
+		}
+	}
+	return f, nil
+}
+
+// Authors ฟีดนำทางของผู้แต่งที่มีหนังสืออย่างน้อยหนึ่งเล่ม เรียงตามชื่อ
+func (s *OPDSService) Authors(r OPDSRequest) (*OPDSFeed, error) {
+	q := s.DB.Table("authors").
+		Joins("JOIN book_author ba ON ba.author_id = authors.id").
+		Joins("JOIN books ON books.id = ba.book_id AND books.deleted_at IS NULL").
+		Where("authors.deleted_at IS NULL").
+		Session(&gorm.Session{})
+	var total int64
+	if err := q.Distinct("authors.id").Count(&total).Error; err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID         uint
+		AuthorName string
+		BookCount  int64
+	}
+	if err := q.Select("authors.id AS id, authors.author_name AS author_name, COUNT(DISTINCT books.id) AS book_count").
+		Group("authors.id").
+		Order("authors.author_name, authors.id").
+		Offset(offsetOf(r.Page)).Limit(OPDSPageSize).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	f := s.newFeed(r, OPDSNavigationType, "/opds/authors", "Authors")
+	for _, a := range rows {
+		f.Entries = append(f.Entries, navEntry(r, fmt.Sprintf("/opds/authors/%d/books", a.ID), a.AuthorName,
+			fmt.Sprintf("%d books", a.BookCount), OPDSAcquisitionType))
+	}
+	paginate(f, r, "/opds/authors", total)
+	return f, nil
+}
+
+// NewBooks หนังสือที่เพิ่มเข้าระบบล่าสุด
+func (s *OPDSService) NewBooks(r OPDSRequest) (*OPDSFeed, error) {
+	f := s.newFeed(r, OPDSAcquisitionType, "/opds/new", "New books")
+	return f, s.bookPage(f, r, "/opds/new", s.DB.Model(&entity.Book{}), "books.created_at DESC, books.id DESC")
+}
+
+// CategoryBooks หนังสือในหมวดหมู่ รวมหมวดย่อยทุกระดับ
+func (s *OPDSService) CategoryBooks(r OPDSRequest, categoryID uint) (*OPDSFeed, error) {
+	cat, err := ensureCategoryExists(s.DB, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf("/opds/categories/%d/books", categoryID)
+	f := s.newFeed(r, OPDSAcquisitionType, path, cat.CategoryName)
+	q := s.Catalog.filteredBooks(BrowseBooksInput{CategoryIDs: []uint{categoryID}}, "")
+	return f, s.bookPage(f, r, path, q, "books.title, books.id")
+}
+
+// AuthorBooks หนังสือของผู้แต่ง
+func (s *OPDSService) AuthorBooks(r OPDSRequest, authorID uint) (*OPDSFeed, error) {
+	var author entity.Author
+	if err := s.DB.First(&author, authorID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAuthorNotFound
+		}
+		return nil, err
+	}
+	path := fmt.Sprintf("/opds/authors/%d/books", authorID)
+	f := s.newFeed(r, OPDSAcquisitionType, path, author.AuthorName)
+	q := s.Catalog.filteredBooks(BrowseBooksInput{AuthorIDs: []uint{authorID}}, "")
+	return f, s.bookPage(f, r, path, q, "books.published_year DESC, books.title, books.id")
+}
+
+// Shelf หนังสือที่ผู้ใช้ยืมอยู่ เรียงตามวันครบกำหนด
+func (s *OPDSService) Shelf(r OPDSRequest) (*OPDSFeed, error) {
+	f := s.newFeed(r, OPDSAcquisitionType, "/opds/shelf", "My borrowed books")
+	var ids []uint
+	if err := s.DB.Table("borrows").
+		Joins("JOIN book_licenses bl ON bl.id = borrows.book_license_id").
+		Joins("JOIN books ON books.id = bl.book_id AND books.deleted_at IS NULL").
+		Where("borrows.user_id = ? AND borrows.return_date IS NULL AND borrows.due_date > ?", r.UserID, time.Now()).
+		Where("borrows.deleted_at IS NULL").
+		Group("books.id").
+		Order("MIN(borrows.due_date), books.id").
+		Pluck("books.id", &ids).Error; err != nil {
+		return nil, err
+	}
+	entries, err := s.bookEntries(r, ids)
+	if err != nil {
+		return nil, err
+	}
+	f.Entries = entries
+	return f, nil
+}
+
+// Search ผลค้นหาจาก CatalogService.Search ตามลำดับความเกี่ยวข้อง
+func (s *OPDSService) Search(r OPDSRequest, q string) (*OPDSFeed, error) {
+	res, err := s.Catalog.Search(q, max(r.Page, 1), OPDSPageSize)
+	if err != nil {
+		return nil, err
+	}
+	path := "/opds/search?" + url.Values{"q": {q}}.Encode()
+	f := s.newFeed(r, OPDSAcquisitionType, path, "Search: "+q)
+	ids := make([]uint, len(res.Items))
+	for i, hit := range res.Items {
+		ids[i] = hit.ID
+	}
+	if f.Entries, err = s.bookEntries(r, ids); err != nil {
+		return nil, err
+	}
+	paginate(f, r, path, res.Total)
+	return f, nil
+}
+
+// BookEntry entry ของหนังสือเล่มเดียว (คืนหลังยืมผ่านลิงก์ borrow)
+func (s *OPDSService) BookEntry(r OPDSRequest, bookID uint) (*OPDSEntry, error) {
+	entries, err := s.bookEntries(r, []uint{bookID})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrBookNotFound
+	}
+	e := entries[0]
+	e.Xmlns, e.DC, e.OPDS = atomNamespace, dcTermsNamespace, opdsNamespace
+	return e, nil
+}
+
+// OpenSearch คำอธิบาย OpenSearch ของ /opds/search
+func (s *OPDSService) OpenSearch(r OPDSRequest) *OpenSearchDescription {
+	d := &OpenSearchDescription{
+		Xmlns:         "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:     s.title(),
+		Description:   "Search books by title, author, ISBN or category",
+		InputEncoding: "UTF-8",
+	}
+	d.URL.Type = OPDSAcquisitionType
+	d.URL.Template = r.href("/opds/search?q={searchTerms}")
+	return d
+}
+
+// bookPage ใส่หนังสือหน้าปัจจุบันของ q (query บน books) ลงในฟีดพร้อมลิงก์แบ่งหน้า
+func (s *OPDSService) bookPage(f *OPDSFeed, r OPDSRequest, path string, q *gorm.DB, order string) error {
+	var total int64
+	if err := q.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return err
+	}
+	var ids []uint
+	if err := q.Session(&gorm.Session{}).Order(order).
+		Offset(offsetOf(r.Page)).Limit(OPDSPageSize).
+		Pluck("books.id", &ids).Error; err != nil {
+		return err
+	}
+	entries, err := s.bookEntries(r, ids)
+	if err != nil {
+		return err
+	}
+	f.Entries = entries
+	paginate(f, r, path, total)
+	return nil
+}
+
+// bookEntries สร้าง entry ของหนังสือตามลำดับของ ids
+// ผู้ใช้ที่ยืมเล่มนั้นอยู่ได้ลิงก์ดาวน์โหลด ถ้ายังไม่ยืมและมีสำเนาว่างได้ลิงก์ยืม
+func (s *OPDSService) bookEntries(r OPDSRequest, ids []uint) ([]*OPDSEntry, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var books []entity.Book
+	if err := preloadDublinCore(s.DB).Where("id IN ?", ids).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]*entity.Book, len(books))
+	for i := range books {
+		byID[books[i].ID] = &books[i]
+	}
+
+	var borrowed, available []uint
+	if r.UserID != "" {
+		if err := s.DB.Table("borrows").
+			Joins("JOIN book_licenses bl ON bl.id = borrows.book_license_id").
+			Where("borrows.user_id = ? AND bl.book_id IN ?", r.UserID, ids).
+			Where("borrows.return_date IS NULL AND borrows.due_date > ? AND borrows.deleted_at IS NULL", time.Now()).
+			Distinct().Pluck("bl.book_id", &borrowed).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := s.DB.Model(&entity.Book{}).Where("books.id IN ?", ids).
+		Where(bookAvailableSQL, BookStatusAvailable).
+		Pluck("books.id", &available).Error; err != nil {
+		return nil, err
+	}
+	isBorrowed := make(map[uint]bool, len(borrowed))
+	for _, id := range borrowed {
+		isBorrowed[id] = true
+	}
+	isAvailable := make(map[uint]bool, len(available))
+	for _, id := range available {
+		isAvailable[id] = true
+	}
+
+	entries := make([]*OPDSEntry, 0, len(ids))
+	for _, id := range ids {
+		b, ok := byID[id]
+		if !ok {
+			continue
+		}
+		entries = append(entries, s.bookEntry(r, b, isBorrowed[id], isAvailable[id]))
+	}
+	return entries, nil
+}
+
+func (s *OPDSService) bookEntry(r OPDSRequest, b *entity.Book, borrowed, available bool) *OPDSEntry {
+	dc := DublinCoreOf(b)
+	e := &OPDSEntry{
+		Title:   b.Title,
+		ID:      r.href("/catalog/books/%d", b.ID),
+		Updated: atomTime(b.UpdatedAt),
+	}
+	for _, a := range b.Authors {
+		e.Authors = append(e.Authors, OPDSAuthor{Name: a.AuthorName, URI: r.href("/opds/authors/%d/books", a.ID)})
+	}
+	if len(dc.Identifier) > 0 {
+		e.Identifier = dc.Identifier[0]
+	}
+	if len(dc.Language) > 0 {
+		e.Language = dc.Language[0]
+	}
+	if len(dc.Publisher) > 0 {
+		e.Publisher = dc.Publisher[0]
+	}
+	if len(dc.Date) > 0 {
+		e.Issued = dc.Date[0]
+	}
+	for _, c := range b.Categories {
+		e.Categories = append(e.Categories, OPDSCategory{Term: c.CategoryCode, Label: c.CategoryName})
+	}
+	if b.Synopsis != "" {
+		e.Summary = &OPDSText{Type: "text", Text: b.Synopsis}
+	}
+
+	if b.CoverImage != "" {
+		e.Links = append(e.Links,
+			OPDSLink{Rel: opdsRelImage, Href: r.href("/catalog/books/%d/cover?size=large", b.ID), Type: "image/jpeg"},
+			OPDSLink{Rel: opdsRelThumbnail, Href: r.href("/catalog/books/%d/cover?size=small", b.ID), Type: "image/jpeg"})
+	}
+	e.Links = append(e.Links, OPDSLink{Rel: "alternate", Href: r.href("/catalog/books/%d/dc", b.ID), Type: "text/xml", Title: "Dublin Core"})
+	if b.EbookFile == "" {
+		return e
+	}
+	fileType := contentTypeOf(b.EbookFile)
+	switch {
+	case borrowed:
+		e.Links = append(e.Links, OPDSLink{Rel: opdsRelAcquisition, Href: r.href("/opds/books/%d/download", b.ID), Type: fileType})
+	case available:
+		e.Links = append(e.Links, OPDSLink{
+			Rel:      opdsRelBorrow,
+			Href:     r.href("/opds/books/%d/borrow", b.ID),
+			Type:     OPDSEntryType,
+			Indirect: &OPDSIndirectAcquisition{Type: fileType},
+		})
+	}
+	return e
+}
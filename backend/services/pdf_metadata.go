@@ -0,0 +1,488 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ขนาดสูงสุดหลังคลาย object stream หนึ่งก้อน และรวมทั้งไฟล์ (กัน zip bomb)
+const (
+	pdfMaxObjStm   = 16 << 20
+	pdfMaxInflated = 64 << 20
+)
+
+var (
+	pdfObjRe     = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	pdfRefRe     = regexp.MustCompile(`^(\d+)\s+(\d+)\s+R`)
+	pdfTypePage  = regexp.MustCompile(`/Type\s*/Page\b`)
+	pdfTypePages = regexp.MustCompile(`/Type\s*/Pages\b`)
+)
+
+// pdfDoc object ทั้งหมดของไฟล์ (รวม object ที่อยู่ใน object stream ของ PDF 1.5+) และ trailer
+type pdfDoc struct {
+	objects  map[int][]byte
+	trailer  []byte
+	inflated int // จำนวน byte ที่คลายจาก object stream ไปแล้ว
+}
+
+// extractPdfMetadata อ่านจำนวนหน้าจาก page tree และ Title/Author/Subject/Keywords/CreationDate จาก Info dictionary
+// ไม่ใช่ parser เต็มรูปแบบ: อ่านเฉพาะ dictionary ที่ต้องใช้ ไฟล์ที่เข้ารหัสจะได้เฉพาะจำนวนหน้า
+func extractPdfMetadata(r io.ReaderAt, size int64) (*EbookMetadata, error) {
+	data, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	doc := parsePdf(data)
+	if len(doc.objects) == 0 {
+		return nil, fmt.Errorf("%w: no PDF objects found", ErrUploadCorrupt)
+	}
+
+	md := &EbookMetadata{PageCount: doc.pageCount()}
+	if root := doc.resolve(pdfDictValue(doc.trailer, "Root")); root != nil {
+		if lang := pdfDictValue(root, "Lang"); len(lang) > 0 {
+			md.Language = pdfString(doc.resolve(lang))
+		}
+	}
+	// ข้อความใน Info ของไฟล์ที่เข้ารหัสถูกเข้ารหัสด้วย อ่านไม่ได้
+	if pdfDictValue(doc.trailer, "Encrypt") != nil {
+		return md, nil
+	}
+	info := doc.resolve(pdfDictValue(doc.trailer, "Info"))
+	if info == nil {
+		return md, nil
+	}
+	field := func(key string) string {
+		return strings.TrimSpace(pdfString(doc.resolve(pdfDictValue(info, key))))
+	}
+	md.Title = field("Title")
+	md.Authors = splitPdfAuthors(field("Author"))
+	md.Description = field("Subject")
+	md.PublishedYear = leadingYear(field("CreationDate"))
+	md.Isbn = isbnInText(field("Subject") + " " + field("Keywords") + " " + field("Title"))
+	return md, nil
+}
+
+// splitPdfAuthors PDF มีช่อง Author ช่องเดียว หลายคนมักคั่นด้วย ; หรือ &
+func splitPdfAuthors(s string) []string {
+	var out []string
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '&' }) {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func parsePdf(data []byte) *pdfDoc {
+	doc := &pdfDoc{objects: map[int][]byte{}}
+	var xrefStream []byte
+	objs := pdfObjRe.FindAllSubmatchIndex(data, -1)
+	for i, loc := range objs {
+		num, _ := strconv.Atoi(string(data[loc[2]:loc[3]]))
+		// object จบที่ endobj แต่ไม่เกิน object ถัดไป ไฟล์ที่ไม่มี endobj จึงไม่ทำให้สแกนถึงท้ายไฟล์ทุกครั้ง
+		limit := len(data)
+		if i+1 < len(objs) {
+			limit = objs[i+1][0]
+		}
+		body := data[loc[1]:limit]
+		if end := bytes.Index(body, []byte("endobj")); end >= 0 {
+			body = body[:end]
+		}
+		body = bytes.TrimSpace(body)
+		// object ที่อยู่ท้ายไฟล์ (incremental update) แทนที่ฉบับก่อนหน้า
+		doc.objects[num] = body
+		dict := pdfStreamDict(body)
+		switch pdfName(pdfDictValue(dict, "Type")) {
+		case "XRef":
+			xrefStream = dict
+		case "ObjStm":
+			doc.loadObjectStream(body)
+		}
+	}
+	// trailer ตัวสุดท้ายของไฟล์ หรือ dictionary ของ xref stream ใน PDF 1.5+
+	if i := bytes.LastIndex(data, []byte("trailer")); i >= 0 {
+		doc.trailer = pdfDictAt(data[i+len("trailer"):])
+	}
+	if doc.trailer == nil || (xrefStream != nil && pdfDictValue(doc.trailer, "Root") == nil) {
+		doc.trailer = xrefStream
+	}
+	return doc
+}
+
+// pdfStreamDict dictionary ของ object (ส่วนก่อนคำว่า stream)
+func pdfStreamDict(body []byte) []byte {
+	if i := bytes.Index(body, []byte("stream")); i >= 0 {
+		body = body[:i]
+	}
+	return pdfDictAt(body)
+}
+
+// pdfStreamData ข้อมูลของ stream หลังคลาย FlateDecode (filter อื่นไม่รองรับ)
+func pdfStreamData(body []byte) ([]byte, bool) {
+	dict := pdfStreamDict(body)
+	i := bytes.Index(body, []byte("stream"))
+	if i < 0 {
+		return nil, false
+	}
+	raw := body[i+len("stream"):]
+	raw = bytes.TrimPrefix(raw, []byte("\r"))
+	raw = bytes.TrimPrefix(raw, []byte("\n"))
+	if j := bytes.LastIndex(raw, []byte("endstream")); j >= 0 {
+		raw = raw[:j]
+	}
+	switch pdfName(pdfDictValue(dict, "Filter")) {
+	case "":
+		return raw, true
+	case "FlateDecode":
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, false
+		}
+		defer zr.Close()
+		out, err := io.ReadAll(io.LimitReader(zr, pdfMaxObjStm))
+		// stream ที่ตัดท้ายไม่ครบยังใช้ส่วนที่คลายได้
+		if err != nil && len(out) == 0 {
+			return nil, false
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+// loadObjectStream แตก object ที่บีบอัดอยู่ใน /Type /ObjStm (N คู่ "เลข object, offset" แล้วตามด้วยเนื้อ object ตั้งแต่ /First)
+func (d *pdfDoc) loadObjectStream(body []byte) {
+	dict := pdfStreamDict(body)
+	n, _ := strconv.Atoi(string(pdfDictValue(dict, "N")))
+	first, _ := strconv.Atoi(string(pdfDictValue(dict, "First")))
+	if d.inflated >= pdfMaxInflated {
+		return
+	}
+	data, ok := pdfStreamData(body)
+	d.inflated += len(data)
+	if !ok || n <= 0 || first <= 0 || first > len(data) {
+		return
+	}
+	header := strings.Fields(string(data[:first]))
+	if len(header) < 2*n {
+		return
+	}
+	for i := 0; i < n; i++ {
+		num, err1 := strconv.Atoi(header[2*i])
+		off, err2 := strconv.Atoi(header[2*i+1])
+		// offset มาจากไฟล์ ต้องอยู่ในช่วงของ data เสมอ (ค่าติดลบหรือเกินทำให้ slice พัง)
+		if err1 != nil || err2 != nil || off < 0 || off > len(data)-first {
+			return
+		}
+		end := len(data)
+		if i+1 < n {
+			if next, err := strconv.Atoi(header[2*i+3]); err == nil && next >= off && next <= len(data)-first {
+				end = first + next
+			}
+		}
+		d.objects[num] = bytes.TrimSpace(data[first+off : end])
+	}
+}
+
+// resolve ถ้า v เป็น indirect reference (N G R) คืนเนื้อ object นั้น
+func (d *pdfDoc) resolve(v []byte) []byte {
+	for i := 0; i < 8; i++ {
+		m := pdfRefRe.FindSubmatch(v)
+		if m == nil {
+			return v
+		}
+		num, _ := strconv.Atoi(string(m[1]))
+		obj, ok := d.objects[num]
+		if !ok {
+			return nil
+		}
+		v = obj
+	}
+	return nil
+}
+
+// pageCount /Count ของ page tree จาก /Root /Pages ถ้าหาไม่ได้นับ object /Type /Page
+func (d *pdfDoc) pageCount() uint {
+	if root := d.resolve(pdfDictValue(d.trailer, "Root")); root != nil {
+		if pages := d.resolve(pdfDictValue(root, "Pages")); pages != nil {
+			if n, err := strconv.ParseUint(string(d.resolve(pdfDictValue(pages, "Count"))), 10, 32); err == nil && n > 0 {
+				return uint(n)
+			}
+		}
+	}
+	var n uint
+	for _, obj := range d.objects {
+		dict := pdfStreamDict(obj)
+		if pdfTypePage.Match(dict) && !pdfTypePages.Match(dict) {
+			n++
+		}
+	}
+	return n
+}
+
+func isPdfSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPdfDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// pdfDictAt dictionary << ... >> ตัวแรกใน b (รวมวงเล็บ)
+func pdfDictAt(b []byte) []byte {
+	i := bytes.Index(b, []byte("<<"))
+	if i < 0 {
+		return nil
+	}
+	n := pdfValueLen(b[i:])
+	if n <= 0 {
+		return nil
+	}
+	return b[i : i+n]
+}
+
+// pdfDictValue ค่าของ /key ระดับบนสุดใน dictionary (nil ถ้าไม่มี)
+func pdfDictValue(dict []byte, key string) []byte {
+	if len(dict) < 4 || !bytes.HasPrefix(dict, []byte("<<")) {
+		return nil
+	}
+	b := dict[2:]
+	for len(b) > 0 {
+		b = skipPdfSpace(b)
+		if len(b) == 0 || bytes.HasPrefix(b, []byte(">>")) {
+			return nil
+		}
+		if b[0] != '/' {
+			// ข้อมูลเพี้ยน ข้ามไปหนึ่ง token
+			n := pdfValueLen(b)
+			if n <= 0 {
+				return nil
+			}
+			b = b[n:]
+			continue
+		}
+		nameLen := pdfValueLen(b)
+		name := string(b[1:nameLen])
+		b = skipPdfSpace(b[nameLen:])
+		n := pdfValueLen(b)
+		if n <= 0 {
+			return nil
+		}
+		// indirect reference "N G R" เป็นสาม token
+		if m := pdfRefRe.Find(b); m != nil {
+			n = len(m)
+		}
+		if name == key {
+			return bytes.TrimSpace(b[:n])
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func skipPdfSpace(b []byte) []byte {
+	for len(b) > 0 {
+		switch {
+		case isPdfSpace(b[0]):
+			b = b[1:]
+		case b[0] == '%':
+			if i := bytes.IndexAny(b, "\r\n"); i >= 0 {
+				b = b[i:]
+			} else {
+				b = nil
+			}
+		default:
+			return b
+		}
+	}
+	return b
+}
+
+// pdfValueLen ความยาวของค่าหนึ่งตัวที่ต้นของ b: string, hex string, dictionary, array, name หรือ token ธรรมดา
+func pdfValueLen(b []byte) int {
+	if len(b) == 0 {
+		return 0
+	}
+	switch {
+	case bytes.HasPrefix(b, []byte("<<")), b[0] == '[':
+		depth := 0
+		for i := 0; i < len(b); i++ {
+			switch {
+			case b[i] == '(':
+				n := pdfValueLen(b[i:])
+				if n <= 0 {
+					return -1
+				}
+				i += n - 1
+			case bytes.HasPrefix(b[i:], []byte("<<")):
+				depth++
+				i++
+			case b[i] == '<':
+				// hex string ข้างใน ต้องข้ามทั้งก้อนกัน > ปิดท้ายถูกนับรวมกับ >>
+				n := pdfValueLen(b[i:])
+				if n <= 0 {
+					return -1
+				}
+				i += n - 1
+			case bytes.HasPrefix(b[i:], []byte(">>")):
+				depth--
+				i++
+				if depth == 0 {
+					return i + 1
+				}
+			case b[i] == '[':
+				depth++
+			case b[i] == ']':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return -1
+	case b[0] == '(':
+		depth := 0
+		for i := 0; i < len(b); i++ {
+			switch b[i] {
+			case '\\':
+				i++
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return -1
+	case b[0] == '<':
+		if i := bytes.IndexByte(b, '>'); i >= 0 {
+			return i + 1
+		}
+		return -1
+	case b[0] == '/':
+		i := 1
+		for i < len(b) && !isPdfSpace(b[i]) && !isPdfDelim(b[i]) {
+			i++
+		}
+		return i
+	}
+	i := 0
+	for i < len(b) && !isPdfSpace(b[i]) && !isPdfDelim(b[i]) {
+		i++
+	}
+	if i == 0 {
+		return 1
+	}
+	return i
+}
+
+// pdfName ชื่อไม่รวม / นำหน้า เช่น /FlateDecode -> FlateDecode (array ของ filter ใช้ตัวแรก)
+func pdfName(v []byte) string {
+	v = bytes.TrimSpace(bytes.Trim(bytes.TrimSpace(v), "[]"))
+	if !bytes.HasPrefix(v, []byte("/")) {
+		return ""
+	}
+	return string(v[1:pdfValueLen(v)])
+}
+
+// pdfString แปลง string ของ PDF ((literal) หรือ <hex>) เป็นข้อความ UTF-8
+// รองรับ UTF-16BE ที่มี BOM, UTF-8 และ PDFDocEncoding (ถือเป็น Latin-1)
+func pdfString(v []byte) string {
+	v = bytes.TrimSpace(v)
+	var raw []byte
+	switch {
+	case bytes.HasPrefix(v, []byte("(")) && bytes.HasSuffix(v, []byte(")")):
+		raw = unescapePdfLiteral(v[1 : len(v)-1])
+	case bytes.HasPrefix(v, []byte("<")) && bytes.HasSuffix(v, []byte(">")) && !bytes.HasPrefix(v, []byte("<<")):
+		raw = decodePdfHex(v[1 : len(v)-1])
+	default:
+		return ""
+	}
+	switch {
+	case bytes.HasPrefix(raw, []byte{0xFE, 0xFF}):
+		raw = raw[2:]
+		u := make([]uint16, 0, len(raw)/2)
+		for i := 0; i+1 < len(raw); i += 2 {
+			u = append(u, uint16(raw[i])<<8|uint16(raw[i+1]))
+		}
+		return string(utf16.Decode(u))
+	case bytes.HasPrefix(raw, []byte{0xEF, 0xBB, 0xBF}):
+		return string(raw[3:])
+	case utf8.Valid(raw):
+		return string(raw)
+	}
+	runes := make([]rune, len(raw))
+	for i, c := range raw {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+func unescapePdfLiteral(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		if c != '\\' || i+1 >= len(b) {
+			out = append(out, c)
+			continue
+		}
+		i++
+		switch e := b[i]; e {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case '\r':
+			// ขึ้นบรรทัดใหม่หลัง \ คือการต่อบรรทัด
+			if i+1 < len(b) && b[i+1] == '\n' {
+				i++
+			}
+		case '\n':
+		default:
+			if e >= '0' && e <= '7' {
+				v := 0
+				j := i
+				for ; j < len(b) && j < i+3 && b[j] >= '0' && b[j] <= '7'; j++ {
+					v = v*8 + int(b[j]-'0')
+				}
+				out = append(out, byte(v))
+				i = j - 1
+			} else {
+				out = append(out, e)
+			}
+		}
+	}
+	return out
+}
+
+func decodePdfHex(b []byte) []byte {
+	var digits []byte
+	for _, c := range b {
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		v, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		out[i] = byte(v)
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// objStm สร้าง object stream (FlateDecode) ที่มี header ตามที่กำหนด และเนื้อ object ต่อท้าย
+func objStm(num int, header string, n int, content string) string {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte(header + content))
+	zw.Close()
+	return fmt.Sprintf("%d 0 obj\n<< /Type /ObjStm /N %d /First %d /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream\nendobj\n",
+		num, n, len(header), buf.Len(), buf.String())
+}
+
+const pdfPages = "1 0 obj\n<< /Type /Catalog /Pages 2 0 R /Lang (th) >>\nendobj\n" +
+	"2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 3 >>\nendobj\n"
+
+func TestExtractPdfMetadata(t *testing.T) {
+	tests := []struct {
+		name    string
+		pdf     string
+		wantErr error
+		want    EbookMetadata
+	}{
+		{
+			name: "info dictionary",
+			pdf: "%PDF-1.4\n" + pdfPages +
+				"4 0 obj\n<< /Title (Go \\(2nd ed.\\)) /Author (A. Author; B. Author) /CreationDate (D:20210101) /Keywords (ISBN 978-0-13-468599-1) >>\nendobj\n" +
+				"trailer\n<< /Root 1 0 R /Info 4 0 R >>\n%%EOF\n",
+			want: EbookMetadata{
+				Title: "Go (2nd ed.)", Authors: []string{"A. Author", "B. Author"}, Language: "th",
+				PublishedYear: 2021, PageCount: 3, Isbn: "9780134685991",
+			},
+		},
+		{
+			name: "utf-16 title in object stream",
+			pdf: "%PDF-1.5\n" + pdfPages +
+				objStm(5, "4 0 ", 1, "<< /Title <FEFF0E2B0E19> >>") +
+				"6 0 obj\n<< /Type /XRef /Root 1 0 R /Info 4 0 R >>\nstream\nendstream\nendobj\n",
+			want: EbookMetadata{Title: "หน", Language: "th", PageCount: 3},
+		},
+		{
+			name: "negative offset in object stream header",
+			pdf:  "%PDF-1.5\n" + pdfPages + objStm(5, "4 -9 ", 1, "<< /Title (x) >>") + "trailer\n<< /Root 1 0 R /Info 4 0 R >>\n",
+			want: EbookMetadata{Language: "th", PageCount: 3},
+		},
+		{
+			name: "negative next offset in object stream header",
+			pdf:  "%PDF-1.5\n" + pdfPages + objStm(5, "4 0 7 -3 ", 2, "<< /Title (x) >>") + "trailer\n<< /Root 1 0 R /Info 4 0 R >>\n",
+			want: EbookMetadata{Title: "x", Language: "th", PageCount: 3},
+		},
+		{
+			name: "offset past end of object stream",
+			pdf:  "%PDF-1.5\n" + pdfPages + objStm(5, "4 999 ", 1, "<< >>") + "trailer\n<< /Root 1 0 R /Info 4 0 R >>\n",
+			want: EbookMetadata{Language: "th", PageCount: 3},
+		},
+		{
+			name: "missing endobj",
+			pdf:  "%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\n2 0 obj\n<< /Type /Pages /Count 7 >>\ntrailer\n<< /Root 1 0 R >>\n",
+			want: EbookMetadata{PageCount: 7},
+		},
+		{
+			name: "encrypted file reads page count only",
+			pdf: "%PDF-1.4\n" + pdfPages + "4 0 obj\n<< /Title (secret) >>\nendobj\n" +
+				"trailer\n<< /Root 1 0 R /Info 4 0 R /Encrypt 9 0 R >>\n",
+			want: EbookMetadata{Language: "th", PageCount: 3},
+		},
+		{
+			name:    "not a pdf",
+			pdf:     "hello world",
+			wantErr: ErrUploadCorrupt,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := extractPdfMetadata(strings.NewReader(tt.pdf), int64(len(tt.pdf)))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprintf("%+v", *md) != fmt.Sprintf("%+v", tt.want) {
+				t.Errorf("got  %+v\nwant %+v", *md, tt.want)
+			}
+		})
+	}
+}
+
+// ไฟล์ที่มี obj จำนวนมากแต่ไม่มี endobj ต้องใช้เวลาเป็นเส้นตรงกับขนาดไฟล์
+func TestParsePdfWithoutEndobjIsLinear(t *testing.T) {
+	data := bytes.Repeat([]byte("1 0 obj << /A 1 >>\n"), 200000) // ~4 MB
+	start := time.Now()
+	parsePdf(data)
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("parsePdf took %v", d)
+	}
+}
+
+func FuzzExtractPdfMetadata(f *testing.F) {
+	f.Add([]byte("%PDF-1.4\n" + pdfPages + "trailer\n<< /Root 1 0 R >>\n"))
+	f.Add([]byte("%PDF-1.5\n" + pdfPages + objStm(5, "4 -9 ", 1, "<< /Title (x) >>") + "trailer\n<< /Root 1 0 R /Info 4 0 R >>\n"))
+	f.Add([]byte("1 0 obj << /Type /ObjStm /N 2 /First 4 >> stream\n1 0 2 endstream"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// ต้องไม่ panic ไม่ว่าข้อมูลจะเป็นอะไร
+		extractPdfMetadata(bytes.NewReader(data), int64(len(data)))
+	})
+}
@@ -0,0 +1,399 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+)
+
+// ชื่อสถานะของ Reservation (seed ไว้ใน config.CreateDefaultReservationStatus)
+const (
+	ReservationStatusWaiting   = "Waiting"
+	ReservationStatusNotified  = "Notified"
+	ReservationStatusFulfilled = "Fulfilled"
+	ReservationStatusExpired   = "Expired"
+	ReservationStatusCancelled = "Cancelled"
+)
+
+// ระยะเวลาที่เก็บ license ไว้ให้ผู้จองมายืม ถ้าไม่ได้กำหนด HoldPeriod
+const DefaultHoldPeriod = 48 * time.Hour
+
+var (
+	ErrReservationNotFound = errors.New("reservation not found")
+	ErrAlreadyReserved     = errors.New("you already have an active reservation for this book")
+	ErrReservationClosed   = errors.New("reservation is no longer active")
+)
+
+type ReservationService struct {
+	DB            *gorm.DB
+	Notifications *NotificationService
+	HoldPeriod    time.Duration
+}
+
+// ReservationWithPosition รวมลำดับคิว (เฉพาะที่ยัง Waiting) ไปกับ Reservation
+type ReservationWithPosition struct {
+	entity.Reservation
+	QueuePosition int `json:"queue_position"`
+}
+
+func holdPeriodOrDefault(d time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return DefaultHoldPeriod
+}
+
+// reservationStatusID หา id ของ ReservationStatus จากชื่อ
+func reservationStatusID(tx *gorm.DB, name string) (uint, error) {
+	var st entity.ReservationStatus
+	if err := tx.Where("status_name = ?", name).First(&st).Error; err != nil {
+		return 0, fmt.Errorf("reservation status %q not found: %w", name, err)
+	}
+	return st.ID, nil
+}
+
+// nextWaiting คืนการจองที่รอนานที่สุดของหนังสือเล่มนี้ (FIFO) หรือ nil ถ้าไม่มีคิว
+func nextWaiting(tx *gorm.DB, bookID uint) (*entity.Reservation, error) {
+	waitingID, err := reservationStatusID(tx, ReservationStatusWaiting)
+	if err != nil {
+		return nil, err
+	}
+	var r entity.Reservation
+	err = tx.Where("book_id = ? AND reservation_status_id = ?", bookID, waitingID).
+		Order("reservation_date, id").
+		First(&r).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// allocateLicense ส่ง license ที่ว่างลงไปให้คิวถัดไป: ถ้ามีคนรอ license จะเป็น Hold
+// และการจองเปลี่ยนเป็น Notified พร้อม ExpiresAt; ถ้าไม่มีคิว license กลับเป็น Available
+func allocateLicense(tx *gorm.DB, licenseID uint, now time.Time, hold time.Duration) (*entity.Reservation, error) {
+	var lic entity.BookLicense
+	if err := tx.First(&lic, licenseID).Error; err != nil {
+		return nil, err
+	}
+	// license ที่หมดอายุหรือใช้ครบจำนวนครั้งแล้วจะถูก Retired แทนการส่งต่อ
+	if licenseSpent(&lic, now) {
+		return nil, retireLicense(tx, lic.ID)
+	}
+
+	r, err := nextWaiting(tx, lic.BookID)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		availableID, err := bookStatusID(tx, BookStatusAvailable)
+		if err != nil {
+			return nil, err
+		}
+		return nil, tx.Model(&lic).Update("book_status_id", availableID).Error
+	}
+
+	holdID, err := bookStatusID(tx, BookStatusHold)
+	if err != nil {
+		return nil, err
+	}
+	notifiedID, err := reservationStatusID(tx, ReservationStatusNotified)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&lic).Update("book_status_id", holdID).Error; err != nil {
+		return nil, err
+	}
+
+	expires := now.Add(holdPeriodOrDefault(hold))
+	if err := tx.Model(r).Updates(map[string]any{
+		"reservation_status_id":     notifiedID,
+		"allocated_book_license_id": lic.ID,
+		"notified_at":               now,
+		"expires_at":                expires,
+	}).Error; err != nil {
+		return nil, err
+	}
+	r.ReservationStatusID = notifiedID
+	r.AllocatedBookLicenseID = &lic.ID
+	r.NotifiedAt = &now
+	r.ExpiresAt = &expires
+	return r, nil
+}
+
+// allocateAvailable จับคู่ license ที่ยัง Available ของหนังสือกับคิวที่รออยู่
+// (ใช้ตอนเพิ่มการจองใหม่ เผื่อมีเล่มว่างอยู่แล้ว)
+func allocateAvailable(tx *gorm.DB, bookID uint, now time.Time, hold time.Duration) ([]entity.Reservation, error) {
+	availableID, err := bookStatusID(tx, BookStatusAvailable)
+	if err != nil {
+		return nil, err
+	}
+	var lics []entity.BookLicense
+	if err := tx.Where("book_id = ? AND book_status_id = ?", bookID, availableID).
+		Where(licenseUsableSQL, now).
+		Order("id").
+		Find(&lics).Error; err != nil {
+		return nil, err
+	}
+
+	var allocated []entity.Reservation
+	for _, lic := range lics {
+		r, err := allocateLicense(tx, lic.ID, now, hold)
+		if err != nil {
+			return nil, err
+		}
+		if r == nil {
+			break
+		}
+		allocated = append(allocated, *r)
+	}
+	return allocated, nil
+}
+
+// Reserve เข้าคิวจองหนังสือ ถ้ามีเล่มว่างอยู่จะได้รับการจัดสรรทันที
+func (s *ReservationService) Reserve(userID string, bookID uint) (*entity.Reservation, error) {
+	var out entity.Reservation
+	err := s.Notifications.Transaction(s.DB, func(tx *gorm.DB) error {
+		var book entity.Book
+		if err := tx.First(&book, bookID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrBookNotFound
+			}
+			return err
+		}
+
+		waitingID, err := reservationStatusID(tx, ReservationStatusWaiting)
+		if err != nil {
+			return err
+		}
+		notifiedID, err := reservationStatusID(tx, ReservationStatusNotified)
+		if err != nil {
+			return err
+		}
+
+		var dup int64
+		if err := tx.Model(&entity.Reservation{}).
+			Where("user_id = ? AND book_id = ? AND reservation_status_id IN ?", userID, bookID, []uint{waitingID, notifiedID}).
+			Count(&dup).Error; err != nil {
+			return err
+		}
+		if dup > 0 {
+			return ErrAlreadyReserved
+		}
+
+		var borrowing int64
+		if err := tx.Model(&entity.Borrow{}).
+			Joins("JOIN book_licenses ON book_licenses.id = borrows.book_license_id").
+			Where("borrows.user_id = ? AND book_licenses.book_id = ? AND borrows.return_date IS NULL", userID, bookID).
+			Count(&borrowing).Error; err != nil {
+			return err
+		}
+		if borrowing > 0 {
+			return ErrAlreadyBorrowed
+		}
+
+		now := time.Now()
+		out = entity.Reservation{
+			ReservationDate:     now,
+			UserID:              userID,
+			BookID:              bookID,
+			ReservationStatusID: waitingID,
+		}
+		if err := tx.Create(&out).Error; err != nil {
+			return err
+		}
+
+		allocated, err := allocateAvailable(tx, bookID, now, s.HoldPeriod)
+		if err != nil {
+			return err
+		}
+		for i := range allocated {
+			if err := s.Notifications.NotifyReservationReady(tx, &allocated[i]); err != nil {
+				return err
+			}
+		}
+		return tx.Preload("ReservationStatus").First(&out, out.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Cancel ยกเลิกการจอง ถ้ามี license ถูกกันไว้ให้แล้วจะส่งต่อให้คิวถัดไป
+func (s *ReservationService) Cancel(userID string, reservationID uint) (*entity.Reservation, error) {
+	var out entity.Reservation
+	err := s.Notifications.Transaction(s.DB, func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", reservationID, userID).First(&out).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrReservationNotFound
+			}
+			return err
+		}
+		next, err := closeReservation(tx, &out, ReservationStatusCancelled, time.Now(), s.HoldPeriod)
+		if err != nil {
+			return err
+		}
+		if err := s.Notifications.NotifyReservationReady(tx, next); err != nil {
+			return err
+		}
+		return tx.Preload("ReservationStatus").First(&out, out.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// closeReservation ปิดการจองที่ยัง Waiting/Notified ด้วยสถานะ status
+// แล้วปล่อย license ที่ถูก Hold ไว้ให้คิวถัดไป (คืนการจองที่ได้รับ license ต่อ ถ้ามี)
+func closeReservation(tx *gorm.DB, r *entity.Reservation, status string, now time.Time, hold time.Duration) (*entity.Reservation, error) {
+	waitingID, err := reservationStatusID(tx, ReservationStatusWaiting)
+	if err != nil {
+		return nil, err
+	}
+	notifiedID, err := reservationStatusID(tx, ReservationStatusNotified)
+	if err != nil {
+		return nil, err
+	}
+	statusID, err := reservationStatusID(tx, status)
+	if err != nil {
+		return nil, err
+	}
+
+	res := tx.Model(&entity.Reservation{}).
+		Where("id = ? AND reservation_status_id IN ?", r.ID, []uint{waitingID, notifiedID}).
+		Update("reservation_status_id", statusID)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrReservationClosed
+	}
+
+	if r.ReservationStatusID != notifiedID || r.AllocatedBookLicenseID == nil {
+		return nil, nil
+	}
+	return allocateLicense(tx, *r.AllocatedBookLicenseID, now, hold)
+}
+
+// fulfilReservation ใช้ตอน Checkout: ถ้าผู้ใช้มี license ที่ถูก Hold ไว้ให้จะคืน license นั้น
+// และเปลี่ยนการจองเป็น Fulfilled; ถ้าไม่มีคืน nil
+func fulfilReservation(tx *gorm.DB, userID string, bookID uint) (*entity.BookLicense, error) {
+	notifiedID, err := reservationStatusID(tx, ReservationStatusNotified)
+	if err != nil {
+		return nil, err
+	}
+	fulfilledID, err := reservationStatusID(tx, ReservationStatusFulfilled)
+	if err != nil {
+		return nil, err
+	}
+
+	var r entity.Reservation
+	err = tx.Where("user_id = ? AND book_id = ? AND reservation_status_id = ? AND allocated_book_license_id IS NOT NULL",
+		userID, bookID, notifiedID).
+		First(&r).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var lic entity.BookLicense
+	if err := tx.First(&lic, *r.AllocatedBookLicenseID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&r).Update("reservation_status_id", fulfilledID).Error; err != nil {
+		return nil, err
+	}
+	return &lic, nil
+}
+
+// withQueuePositions เติมลำดับคิวให้การจองที่ยัง Waiting
+func withQueuePositions(tx *gorm.DB, items []entity.Reservation) ([]ReservationWithPosition, error) {
+	waitingID, err := reservationStatusID(tx, ReservationStatusWaiting)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ReservationWithPosition, 0, len(items))
+	for _, r := range items {
+		row := ReservationWithPosition{Reservation: r}
+		if r.ReservationStatusID == waitingID {
+			var ahead int64
+			if err := tx.Model(&entity.Reservation{}).
+				Where("book_id = ? AND reservation_status_id = ? AND (reservation_date < ? OR (reservation_date = ? AND id < ?))",
+					r.BookID, waitingID, r.ReservationDate, r.ReservationDate, r.ID).
+				Count(&ahead).Error; err != nil {
+				return nil, err
+			}
+			row.QueuePosition = int(ahead) + 1
+		}
+		out = append(out, row)
+	}
+	return out, nil
+}
+
+// ListReservations รายการจองของผู้ใช้ (activeOnly = เฉพาะ Waiting/Notified)
+func (s *ReservationService) ListReservations(userID string, activeOnly bool) ([]ReservationWithPosition, error) {
+	q := s.DB.Preload("Book").Preload("ReservationStatus").Where("user_id = ?", userID)
+	if activeOnly {
+		waitingID, err := reservationStatusID(s.DB, ReservationStatusWaiting)
+		if err != nil {
+			return nil, err
+		}
+		notifiedID, err := reservationStatusID(s.DB, ReservationStatusNotified)
+		if err != nil {
+			return nil, err
+		}
+		q = q.Where("reservation_status_id IN ?", []uint{waitingID, notifiedID})
+	}
+	var items []entity.Reservation
+	if err := q.Order("reservation_date DESC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return withQueuePositions(s.DB, items)
+}
+
+// GetReservation ดูการจองหนึ่งรายการของผู้ใช้
+func (s *ReservationService) GetReservation(userID string, reservationID uint) (*ReservationWithPosition, error) {
+	var r entity.Reservation
+	if err := s.DB.Preload("Book").Preload("ReservationStatus").
+		Where("id = ? AND user_id = ?", reservationID, userID).
+		First(&r).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReservationNotFound
+		}
+		return nil, err
+	}
+	rows, err := withQueuePositions(s.DB, []entity.Reservation{r})
+	if err != nil {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+
+// BookQueue คิวการจองที่ยังเปิดอยู่ของหนังสือ เรียงตามลำดับ (สำหรับ admin)
+func (s *ReservationService) BookQueue(bookID uint) ([]ReservationWithPosition, error) {
+	waitingID, err := reservationStatusID(s.DB, ReservationStatusWaiting)
+	if err != nil {
+		return nil, err
+	}
+	notifiedID, err := reservationStatusID(s.DB, ReservationStatusNotified)
+	if err != nil {
+		return nil, err
+	}
+	var items []entity.Reservation
+	if err := s.DB.Preload("User").Preload("ReservationStatus").
+		Where("book_id = ? AND reservation_status_id IN ?", bookID, []uint{waitingID, notifiedID}).
+		Order("reservation_date, id").
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return withQueuePositions(s.DB, items)
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultSchedulerInterval = time.Minute
+	dueSoonWindow            = 24 * time.Hour
+)
+
+// Scheduler งานเบื้องหลังที่รันเป็นรอบ ๆ ภายใน process เดียวกับ API
+// Clock ใช้แทน time.Now เพื่อให้ทดสอบด้วยเวลาที่กำหนดเองได้
+type Scheduler struct {
+	DB            *gorm.DB
+	Notifications *NotificationService
+	Clock         func() time.Time
+	Interval      time.Duration
+	HoldPeriod    time.Duration
+}
+
+// SchedulerReport สรุปผลของการรันหนึ่งรอบ
+type SchedulerReport struct {
+	AutoReturned     int `json:"auto_returned"`
+	ExpiredHolds     int `json:"expired_holds"`
+	DueSoonReminders int `json:"due_soon_reminders"`
+	RetiredLicenses  int `json:"retired_licenses"`
+}
+
+func (s *Scheduler) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock()
+	}
+	return time.Now()
+}
+
+// Start รันงานทันทีหนึ่งรอบ แล้ววนตาม Interval จนกว่า ctx จะถูกยกเลิก
+func (s *Scheduler) Start(ctx context.Context) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultSchedulerInterval
+	}
+
+	s.tick()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.tick()
+		}
+	}
+}
+
+func (s *Scheduler) tick() {
+	rep, err := s.RunOnce()
+	if err != nil {
+		log.Println("scheduler:", err)
+	}
+	if rep.AutoReturned+rep.ExpiredHolds+rep.DueSoonReminders+rep.RetiredLicenses > 0 {
+		log.Printf("scheduler: auto-returned %d, expired holds %d, due-soon reminders %d, retired licenses %d\n",
+			rep.AutoReturned, rep.ExpiredHolds, rep.DueSoonReminders, rep.RetiredLicenses)
+	}
+}
+
+// RunOnce รันงานทั้งหมดหนึ่งรอบด้วยเวลาจาก Clock
+func (s *Scheduler) RunOnce() (SchedulerReport, error) {
+	now := s.now()
+	var rep SchedulerReport
+	var errs []error
+
+	n, err := s.AutoReturnOverdue(now)
+	rep.AutoReturned = n
+	errs = append(errs, err)
+
+	n, err = s.ExpireHolds(now)
+	rep.ExpiredHolds = n
+	errs = append(errs, err)
+
+	n, err = s.RemindDueSoon(now)
+	rep.DueSoonReminders = n
+	errs = append(errs, err)
+
+	n, err = s.RetireSpentLicenses(now)
+	rep.RetiredLicenses = n
+	errs = append(errs, err)
+
+	return rep, errors.Join(errs...)
+}
+
+// AutoReturnOverdue คืน e-book ที่เลยกำหนดคืนให้อัตโนมัติ แล้วส่ง license ต่อให้คิวจอง
+func (s *Scheduler) AutoReturnOverdue(now time.Time) (int, error) {
+	var overdue []entity.Borrow
+	if err := s.DB.Model(&entity.Borrow{}).
+		Joins("JOIN book_licenses ON book_licenses.id = borrows.book_license_id").
+		Joins("JOIN books ON books.id = book_licenses.book_id").
+		Where("borrows.return_date IS NULL AND borrows.due_date < ?", now).
+		Where("books.ebook_file <> ''").
+		Preload("BookLicense").
+		Find(&overdue).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var errs []error
+	for _, b := range overdue {
+		returned := false
+		err := s.Notifications.Transaction(s.DB, func(tx *gorm.DB) error {
+			res := tx.Model(&entity.Borrow{}).
+				Where("id = ? AND return_date IS NULL", b.ID).
+				Update("return_date", now)
+			if res.Error != nil || res.RowsAffected == 0 {
+				return res.Error
+			}
+
+			if err := s.Notifications.NotifyAutoReturned(tx, &b, b.BookLicense.BookID); err != nil {
+				return err
+			}
+
+			r, err := allocateLicense(tx, b.BookLicenseID, now, s.HoldPeriod)
+			if err != nil {
+				return err
+			}
+			returned = true
+			return s.Notifications.NotifyReservationReady(tx, r)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("auto-return borrow %d: %w", b.ID, err))
+			continue
+		}
+		// นับหลัง commit เท่านั้น ถ้า rollback รายการยืมนี้ยังไม่ถูกคืน
+		if returned {
+			count++
+		}
+	}
+	return count, errors.Join(errs...)
+}
+
+// ExpireHolds ปิดการจองที่ได้รับแจ้งแล้วแต่ไม่มายืมภายใน ExpiresAt และส่ง license ให้คิวถัดไป
+func (s *Scheduler) ExpireHolds(now time.Time) (int, error) {
+	notifiedID, err := reservationStatusID(s.DB, ReservationStatusNotified)
+	if err != nil {
+		return 0, err
+	}
+	var expired []entity.Reservation
+	if err := s.DB.Where("reservation_status_id = ? AND expires_at IS NOT NULL AND expires_at < ?", notifiedID, now).
+		Find(&expired).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var errs []error
+	for i := range expired {
+		r := expired[i]
+		closed := false
+		err := s.Notifications.Transaction(s.DB, func(tx *gorm.DB) error {
+			next, err := closeReservation(tx, &r, ReservationStatusExpired, now, s.HoldPeriod)
+			if errors.Is(err, ErrReservationClosed) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := s.Notifications.NotifyReservationExpired(tx, &r); err != nil {
+				return err
+			}
+			closed = true
+			return s.Notifications.NotifyReservationReady(tx, next)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("expire reservation %d: %w", r.ID, err))
+			continue
+		}
+		if closed {
+			count++
+		}
+	}
+	return count, errors.Join(errs...)
+}
+
+// RemindDueSoon แจ้งเตือนรายการยืมที่จะครบกำหนดภายใน 24 ชั่วโมง (ครั้งเดียวต่อรายการยืม)
+func (s *Scheduler) RemindDueSoon(now time.Time) (int, error) {
+	var due []entity.Borrow
+	if err := s.DB.Model(&entity.Borrow{}).
+		Where("return_date IS NULL AND due_date >= ? AND due_date < ?", now, now.Add(dueSoonWindow)).
+		// นับรวมการแจ้งเตือนที่ผู้ใช้ลบไปแล้ว (soft delete) ไม่เช่นนั้นจะถูกสร้างใหม่ทุกรอบจนกว่าจะคืนหนังสือ
+		Where("NOT EXISTS (SELECT 1 FROM notifications n WHERE n.borrow_id = borrows.id AND n.type = ?)",
+			NotificationTypeDueSoon).
+		Preload("BookLicense").
+		Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var errs []error
+	for _, b := range due {
+		if err := s.Notifications.NotifyDueSoon(nil, &b, b.BookLicense.BookID); err != nil {
+			errs = append(errs, fmt.Errorf("remind borrow %d: %w", b.ID, err))
+			continue
+		}
+		count++
+	}
+	return count, errors.Join(errs...)
+}
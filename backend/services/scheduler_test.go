@@ -0,0 +1,404 @@
+package services
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// schedulerNow เวลาคงที่ที่ใช้เป็น Clock ของ Scheduler ในทุกกรณีทดสอบ
+var schedulerNow = time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+
+const testHoldPeriod = 48 * time.Hour
+
+// newSchedulerTestDB สร้างฐานข้อมูล SQLite ชั่วคราวพร้อมสถานะและประเภทการแจ้งเตือนที่ Scheduler ใช้
+func newSchedulerTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(
+		&entity.User{},
+		&entity.Book{},
+		&entity.BookStatus{},
+		&entity.BookLicense{},
+		&entity.Borrow{},
+		&entity.Reservation{},
+		&entity.ReservationStatus{},
+		&entity.Notification{},
+		&entity.NotificationType{},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{BookStatusAvailable, BookStatusBorrowed, BookStatusHold, BookStatusRetired} {
+		mustCreate(t, db, &entity.BookStatus{StatusName: name})
+	}
+	for _, name := range []string{ReservationStatusWaiting, ReservationStatusNotified, ReservationStatusFulfilled,
+		ReservationStatusExpired, ReservationStatusCancelled} {
+		mustCreate(t, db, &entity.ReservationStatus{StatusName: name})
+	}
+	for _, name := range []string{NotificationTypeDueSoon, NotificationTypeAutoReturned,
+		NotificationTypeReservationReady, NotificationTypeReservationExpired} {
+		mustCreate(t, db, &entity.NotificationType{TypeName: name})
+	}
+	for _, id := range []string{"S001", "S002", "S003"} {
+		mustCreate(t, db, &entity.User{UserID: id, Password: "x", Firstname: id, Lastname: id, Email: id + "@example.com"})
+	}
+	return db
+}
+
+func newTestScheduler(db *gorm.DB) *Scheduler {
+	return &Scheduler{
+		DB:            db,
+		Notifications: &NotificationService{DB: db},
+		Clock:         func() time.Time { return schedulerNow },
+		HoldPeriod:    testHoldPeriod,
+	}
+}
+
+func mustCreate(t *testing.T, db *gorm.DB, v any) {
+	t.Helper()
+	if err := db.Omit(clause.Associations).Create(v).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustBookStatus(t *testing.T, db *gorm.DB, name string) uint {
+	t.Helper()
+	id, err := bookStatusID(db, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func mustReservationStatus(t *testing.T, db *gorm.DB, name string) uint {
+	t.Helper()
+	id, err := reservationStatusID(db, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// seedEbook สร้างหนังสือ e-book หนึ่งเล่มกับ license หนึ่งชุดในสถานะที่กำหนด
+func seedEbook(t *testing.T, db *gorm.DB, n int, licenseStatus string) (*entity.Book, *entity.BookLicense) {
+	t.Helper()
+	book := &entity.Book{
+		Title: fmt.Sprintf("Book %d", n), Isbn: fmt.Sprintf("isbn-%d", n),
+		EbookFile: fmt.Sprintf("ebooks/%d.epub", n), UserID: "S003",
+	}
+	mustCreate(t, db, book)
+	lic := &entity.BookLicense{
+		BookLicenseID: fmt.Sprintf("LIC-%d", n), BookID: book.ID,
+		BookStatusID: mustBookStatus(t, db, licenseStatus), LicenseModel: LicenseModelPerpetual,
+	}
+	mustCreate(t, db, lic)
+	return book, lic
+}
+
+func seedBorrow(t *testing.T, db *gorm.DB, userID string, lic *entity.BookLicense, due time.Time) *entity.Borrow {
+	t.Helper()
+	b := &entity.Borrow{BorrowDate: due.Add(-14 * 24 * time.Hour), DueDate: due, UserID: userID, BookLicenseID: lic.ID}
+	mustCreate(t, db, b)
+	return b
+}
+
+func seedReservation(t *testing.T, db *gorm.DB, userID string, book *entity.Book, status string, at time.Time) *entity.Reservation {
+	t.Helper()
+	r := &entity.Reservation{
+		ReservationDate: at, UserID: userID, BookID: book.ID,
+		ReservationStatusID: mustReservationStatus(t, db, status),
+	}
+	mustCreate(t, db, r)
+	return r
+}
+
+func notificationCount(t *testing.T, db *gorm.DB, userID, typ string) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Model(&entity.Notification{}).Where("user_id = ? AND type = ?", userID, typ).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func reload[T any](t *testing.T, db *gorm.DB, id uint) T {
+	t.Helper()
+	var v T
+	if err := db.First(&v, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestAutoReturnOverdue(t *testing.T) {
+	db := newSchedulerTestDB(t)
+	s := newTestScheduler(db)
+
+	// เล่มที่ไม่มีคิวจอง: license กลับเป็น Available
+	_, freeLic := seedEbook(t, db, 1, BookStatusBorrowed)
+	freeBorrow := seedBorrow(t, db, "S001", freeLic, schedulerNow.Add(-time.Hour))
+
+	// เล่มที่มีคิวจอง: license เป็น Hold ให้คิวแรก
+	queuedBook, queuedLic := seedEbook(t, db, 2, BookStatusBorrowed)
+	queuedBorrow := seedBorrow(t, db, "S001", queuedLic, schedulerNow.Add(-time.Minute))
+	first := seedReservation(t, db, "S002", queuedBook, ReservationStatusWaiting, schedulerNow.Add(-48*time.Hour))
+	second := seedReservation(t, db, "S003", queuedBook, ReservationStatusWaiting, schedulerNow.Add(-24*time.Hour))
+
+	// ยังไม่ถึงกำหนดคืน
+	_, activeLic := seedEbook(t, db, 3, BookStatusBorrowed)
+	active := seedBorrow(t, db, "S002", activeLic, schedulerNow.Add(time.Hour))
+
+	n, err := s.AutoReturnOverdue(s.now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("auto-returned %d, want 2", n)
+	}
+
+	for _, b := range []*entity.Borrow{freeBorrow, queuedBorrow} {
+		got := reload[entity.Borrow](t, db, b.ID)
+		if got.ReturnDate == nil || !got.ReturnDate.Equal(schedulerNow) {
+			t.Errorf("borrow %d return_date = %v, want %v", b.ID, got.ReturnDate, schedulerNow)
+		}
+	}
+	got := reload[entity.Borrow](t, db, active.ID)
+	if got.ReturnDate != nil {
+		t.Errorf("borrow not yet due was returned at %v", got.ReturnDate)
+	}
+	if c := notificationCount(t, db, "S001", NotificationTypeAutoReturned); c != 2 {
+		t.Errorf("%s notifications = %d, want 2", NotificationTypeAutoReturned, c)
+	}
+
+	lic := reload[entity.BookLicense](t, db, freeLic.ID)
+	if want := mustBookStatus(t, db, BookStatusAvailable); lic.BookStatusID != want {
+		t.Errorf("license without queue status = %d, want Available (%d)", lic.BookStatusID, want)
+	}
+	lic = reload[entity.BookLicense](t, db, queuedLic.ID)
+	if want := mustBookStatus(t, db, BookStatusHold); lic.BookStatusID != want {
+		t.Errorf("license with queue status = %d, want Hold (%d)", lic.BookStatusID, want)
+	}
+
+	r := reload[entity.Reservation](t, db, first.ID)
+	if want := mustReservationStatus(t, db, ReservationStatusNotified); r.ReservationStatusID != want {
+		t.Errorf("first reservation status = %d, want Notified (%d)", r.ReservationStatusID, want)
+	}
+	if r.AllocatedBookLicenseID == nil || *r.AllocatedBookLicenseID != queuedLic.ID {
+		t.Errorf("first reservation allocated license = %v, want %d", r.AllocatedBookLicenseID, queuedLic.ID)
+	}
+	if want := schedulerNow.Add(testHoldPeriod); r.ExpiresAt == nil || !r.ExpiresAt.Equal(want) {
+		t.Errorf("first reservation expires_at = %v, want %v", r.ExpiresAt, want)
+	}
+	if c := notificationCount(t, db, "S002", NotificationTypeReservationReady); c != 1 {
+		t.Errorf("%s notifications = %d, want 1", NotificationTypeReservationReady, c)
+	}
+	r = reload[entity.Reservation](t, db, second.ID)
+	if want := mustReservationStatus(t, db, ReservationStatusWaiting); r.ReservationStatusID != want {
+		t.Errorf("second reservation status = %d, want Waiting (%d)", r.ReservationStatusID, want)
+	}
+
+	// รอบถัดไปต้องไม่คืนซ้ำ
+	if n, err := s.AutoReturnOverdue(s.now()); err != nil || n != 0 {
+		t.Errorf("second run = %d, %v; want 0, nil", n, err)
+	}
+}
+
+// งานที่ rollback (เช่นแจ้งเตือนไม่สำเร็จ) ต้องไม่ถูกนับและไม่มีผลกับฐานข้อมูล
+func TestAutoReturnOverdueCountsOnlyCommitted(t *testing.T) {
+	db := newSchedulerTestDB(t)
+	s := newTestScheduler(db)
+
+	book, lic := seedEbook(t, db, 1, BookStatusBorrowed)
+	b := seedBorrow(t, db, "S001", lic, schedulerNow.Add(-time.Hour))
+	seedReservation(t, db, "S002", book, ReservationStatusWaiting, schedulerNow.Add(-24*time.Hour))
+	// ไม่มีประเภท reservation_ready: NotifyReservationReady ล้มเหลวหลังคืนหนังสือใน transaction แล้ว
+	if err := db.Unscoped().Where("type_name = ?", NotificationTypeReservationReady).Delete(&entity.NotificationType{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.AutoReturnOverdue(s.now())
+	if err == nil {
+		t.Fatal("want error from failed notification")
+	}
+	if n != 0 {
+		t.Errorf("auto-returned %d, want 0 after rollback", n)
+	}
+	if got := reload[entity.Borrow](t, db, b.ID); got.ReturnDate != nil {
+		t.Errorf("rolled-back borrow has return_date %v", got.ReturnDate)
+	}
+	if c := notificationCount(t, db, "S001", NotificationTypeAutoReturned); c != 0 {
+		t.Errorf("%s notifications = %d, want 0 after rollback", NotificationTypeAutoReturned, c)
+	}
+}
+
+func TestExpireHolds(t *testing.T) {
+	db := newSchedulerTestDB(t)
+	s := newTestScheduler(db)
+	notifiedID := mustReservationStatus(t, db, ReservationStatusNotified)
+
+	hold := func(r *entity.Reservation, lic *entity.BookLicense, expires time.Time) {
+		t.Helper()
+		notified := expires.Add(-testHoldPeriod)
+		if err := db.Model(r).Updates(map[string]any{
+			"reservation_status_id":     notifiedID,
+			"allocated_book_license_id": lic.ID,
+			"notified_at":               notified,
+			"expires_at":                expires,
+		}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// หมดเวลาและมีคิวถัดไป: license ยังเป็น Hold แต่ส่งให้คิวถัดไป
+	passedBook, passedLic := seedEbook(t, db, 1, BookStatusHold)
+	expired := seedReservation(t, db, "S001", passedBook, ReservationStatusWaiting, schedulerNow.Add(-72*time.Hour))
+	hold(expired, passedLic, schedulerNow.Add(-time.Minute))
+	next := seedReservation(t, db, "S002", passedBook, ReservationStatusWaiting, schedulerNow.Add(-48*time.Hour))
+
+	// หมดเวลาและไม่มีคิว: license กลับเป็น Available
+	lastBook, lastLic := seedEbook(t, db, 2, BookStatusHold)
+	last := seedReservation(t, db, "S003", lastBook, ReservationStatusWaiting, schedulerNow.Add(-72*time.Hour))
+	hold(last, lastLic, schedulerNow.Add(-time.Hour))
+
+	// ยังไม่หมดเวลา
+	keptBook, keptLic := seedEbook(t, db, 3, BookStatusHold)
+	kept := seedReservation(t, db, "S001", keptBook, ReservationStatusWaiting, schedulerNow.Add(-24*time.Hour))
+	hold(kept, keptLic, schedulerNow.Add(time.Hour))
+
+	n, err := s.ExpireHolds(s.now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expired holds %d, want 2", n)
+	}
+
+	expiredID := mustReservationStatus(t, db, ReservationStatusExpired)
+	var r entity.Reservation
+	for _, e := range []*entity.Reservation{expired, last} {
+		r = reload[entity.Reservation](t, db, e.ID)
+		if r.ReservationStatusID != expiredID {
+			t.Errorf("reservation %d status = %d, want Expired (%d)", e.ID, r.ReservationStatusID, expiredID)
+		}
+		if c := notificationCount(t, db, e.UserID, NotificationTypeReservationExpired); c != 1 {
+			t.Errorf("%s notifications for %s = %d, want 1", NotificationTypeReservationExpired, e.UserID, c)
+		}
+	}
+
+	r = reload[entity.Reservation](t, db, next.ID)
+	if r.ReservationStatusID != notifiedID {
+		t.Errorf("next reservation status = %d, want Notified (%d)", r.ReservationStatusID, notifiedID)
+	}
+	if r.AllocatedBookLicenseID == nil || *r.AllocatedBookLicenseID != passedLic.ID {
+		t.Errorf("next reservation allocated license = %v, want %d", r.AllocatedBookLicenseID, passedLic.ID)
+	}
+	if want := schedulerNow.Add(testHoldPeriod); r.ExpiresAt == nil || !r.ExpiresAt.Equal(want) {
+		t.Errorf("next reservation expires_at = %v, want %v", r.ExpiresAt, want)
+	}
+	if c := notificationCount(t, db, "S002", NotificationTypeReservationReady); c != 1 {
+		t.Errorf("%s notifications = %d, want 1", NotificationTypeReservationReady, c)
+	}
+
+	lic := reload[entity.BookLicense](t, db, passedLic.ID)
+	if want := mustBookStatus(t, db, BookStatusHold); lic.BookStatusID != want {
+		t.Errorf("passed-on license status = %d, want Hold (%d)", lic.BookStatusID, want)
+	}
+	lic = reload[entity.BookLicense](t, db, lastLic.ID)
+	if want := mustBookStatus(t, db, BookStatusAvailable); lic.BookStatusID != want {
+		t.Errorf("released license status = %d, want Available (%d)", lic.BookStatusID, want)
+	}
+
+	r = reload[entity.Reservation](t, db, kept.ID)
+	if r.ReservationStatusID != notifiedID {
+		t.Errorf("unexpired reservation status = %d, want Notified (%d)", r.ReservationStatusID, notifiedID)
+	}
+}
+
+func TestRemindDueSoon(t *testing.T) {
+	db := newSchedulerTestDB(t)
+	s := newTestScheduler(db)
+
+	_, lic1 := seedEbook(t, db, 1, BookStatusBorrowed)
+	soon := seedBorrow(t, db, "S001", lic1, schedulerNow.Add(2*time.Hour))
+	_, lic2 := seedEbook(t, db, 2, BookStatusBorrowed)
+	seedBorrow(t, db, "S002", lic2, schedulerNow.Add(dueSoonWindow+time.Hour))
+	_, lic3 := seedEbook(t, db, 3, BookStatusAvailable)
+	returned := seedBorrow(t, db, "S003", lic3, schedulerNow.Add(3*time.Hour))
+	if err := db.Model(returned).Update("return_date", schedulerNow.Add(-time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.RemindDueSoon(s.now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("reminders %d, want 1", n)
+	}
+	var got entity.Notification
+	if err := db.Where("type = ?", NotificationTypeDueSoon).First(&got).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.BorrowID == nil || *got.BorrowID != soon.ID || got.UserID == nil || *got.UserID != "S001" {
+		t.Errorf("reminder for borrow %v user %v, want borrow %d user S001", got.BorrowID, got.UserID, soon.ID)
+	}
+	for _, u := range []string{"S002", "S003"} {
+		if c := notificationCount(t, db, u, NotificationTypeDueSoon); c != 0 {
+			t.Errorf("%s got %d reminders, want 0", u, c)
+		}
+	}
+
+	// แจ้งเตือนครั้งเดียวต่อรายการยืม
+	if n, err := s.RemindDueSoon(s.now()); err != nil || n != 0 {
+		t.Errorf("second run = %d, %v; want 0, nil", n, err)
+	}
+
+	// ผู้ใช้ลบการแจ้งเตือนแล้ว รอบถัดไปต้องไม่สร้างใหม่
+	if err := s.Notifications.Delete("S001", got.ID); err != nil {
+		t.Fatal(err)
+	}
+	if c := notificationCount(t, db, "S001", NotificationTypeDueSoon); c != 0 {
+		t.Fatalf("reminders after delete = %d, want 0", c)
+	}
+	rep, err := s.RunOnce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.DueSoonReminders != 0 {
+		t.Errorf("run after delete reminded %d, want 0", rep.DueSoonReminders)
+	}
+	if c := notificationCount(t, db, "S001", NotificationTypeDueSoon); c != 0 {
+		t.Errorf("reminders after run = %d, want 0", c)
+	}
+}
+
+func TestRunOnceUsesClock(t *testing.T) {
+	db := newSchedulerTestDB(t)
+	s := newTestScheduler(db)
+
+	_, lic1 := seedEbook(t, db, 1, BookStatusBorrowed)
+	seedBorrow(t, db, "S001", lic1, schedulerNow.Add(-time.Second))
+	_, lic2 := seedEbook(t, db, 2, BookStatusBorrowed)
+	seedBorrow(t, db, "S002", lic2, schedulerNow.Add(time.Second))
+
+	rep, err := s.RunOnce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SchedulerReport{AutoReturned: 1, DueSoonReminders: 1}); rep != want {
+		t.Errorf("report = %+v, want %+v", rep, want)
+	}
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultStorageDir โฟลเดอร์ของ LocalStorage (ไม่อยู่ใต้ ./static จึงไม่ถูกเสิร์ฟสาธารณะ)
+const DefaultStorageDir = "storage"
+
+var (
+	ErrObjectNotFound  = errors.New("stored file not found")
+	ErrInvalidKey      = errors.New("invalid storage key")
+	ErrInvalidFileLink = errors.New("file link is invalid or has expired")
+)
+
+// Storage ที่เก็บไฟล์ที่อัปโหลด อ้างถึงไฟล์ด้วย key แบบ path ที่คั่นด้วย / เช่น covers/x.jpg
+// ค่าใน Book.CoverImage / Book.EbookFile คือ key นี้ ไม่ใช่ path บนดิสก์หรือ URL
+type Storage interface {
+	Put(key string, r io.Reader, size int64, contentType string) error
+	// Get เปิดไฟล์เพื่ออ่าน (ผู้เรียกต้อง Close Body) คืน ErrObjectNotFound ถ้าไม่มี
+	Get(key string) (*StorageObject, error)
+	// Delete ลบไฟล์ ถ้าไม่มีอยู่แล้วถือว่าสำเร็จ
+	Delete(key string) error
+	// SignedURL URL สำหรับดาวน์โหลดไฟล์โดยตรง ใช้ได้ภายใน ttl (รองรับ Range)
+	SignedURL(key string, ttl time.Duration) (string, error)
+	// List รายการไฟล์ทั้งหมดที่ key ขึ้นต้นด้วย prefix ("" = ทุกไฟล์)
+	List(prefix string) ([]StoredFile, error)
+}
+
+// StoredFile ข้อมูลไฟล์จาก Storage.List
+type StoredFile struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// StorageObject ไฟล์ที่เปิดจาก Storage
+type StorageObject struct {
+	Body        io.ReadCloser
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// cleanKey ตรวจ key: ต้องเป็น path แบบ relative ที่ไม่ออกนอก root (ไม่มี .. หรือ / นำหน้า)
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	clean := path.Clean(key)
+	if clean != key || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", ErrInvalidKey
+	}
+	return clean, nil
+}
+
+// contentTypeOf เดาชนิดไฟล์จากนามสกุลของ key (ไฟล์ที่อัปโหลดถูกตั้งนามสกุลตามชนิดที่ตรวจจากเนื้อไฟล์แล้ว)
+func contentTypeOf(key string) string {
+	if ct, ok := uploadExtensionTypes[strings.ToLower(path.Ext(key))]; ok {
+		return ct
+	}
+	if ct := mime.TypeByExtension(path.Ext(key)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// LocalStorage เก็บไฟล์บนดิสก์ใต้ Root
+// SignedURL ชี้ไปที่ BaseURL/<key> ของ API นี้เอง ซึ่งตรวจลายเซ็นด้วย Verify ก่อนส่งไฟล์
+type LocalStorage struct {
+	Root    string
+	BaseURL string // เช่น /api/files
+	Secret  []byte
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	clean, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(clean)), nil
+}
+
+func (s *LocalStorage) Put(key string, r io.Reader, size int64, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+	// เขียนลงไฟล์ชั่วคราวก่อนแล้วค่อย rename กันผู้อ่านเห็นไฟล์ที่เขียนไม่ครบ
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *LocalStorage) Get(key string) (*StorageObject, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if st.IsDir() {
+		f.Close()
+		return nil, ErrObjectNotFound
+	}
+	return &StorageObject{Body: f, Size: st.Size(), ModTime: st.ModTime(), ContentType: contentTypeOf(key)}, nil
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStorage) List(prefix string) ([]StoredFile, error) {
+	var files []StoredFile
+	err := filepath.WalkDir(s.Root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && p == s.Root {
+				return fs.SkipAll
+			}
+			return err
+		}
+		// ข้ามไฟล์ซ่อน (รวมไฟล์ชั่วคราว .upload-* ที่ Put กำลังเขียน)
+		if strings.HasPrefix(d.Name(), ".") && p != s.Root {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, StoredFile{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	return files, err
+}
+
+func (s *LocalStorage) sign(key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.Secret)
+	fmt.Fprintf(mac, "file:%s:%d", key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *LocalStorage) SignedURL(key string, ttl time.Duration) (string, error) {
+	clean, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	exp := time.Now().Add(ttl).Unix()
+	u := url.URL{Path: strings.TrimSuffix(s.BaseURL, "/") + "/" + clean}
+	u.RawQuery = url.Values{"exp": {fmt.Sprint(exp)}, "sig": {s.sign(clean, exp)}}.Encode()
+	return u.String(), nil
+}
+
+// Verify ตรวจลายเซ็นและเวลาหมดอายุของ SignedURL
+func (s *LocalStorage) Verify(key string, expires int64, sig string) error {
+	clean, err := cleanKey(key)
+	if err != nil {
+		return ErrInvalidFileLink
+	}
+	if time.Now().Unix() >= expires || !hmac.Equal([]byte(sig), []byte(s.sign(clean, expires))) {
+		return ErrInvalidFileLink
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+)
+
+// legacyStaticPrefix ไฟล์ปก/e-book รุ่นเก่าถูกอ้างด้วย URL ใต้ /static เช่น /static/covers/x.jpg
+const legacyStaticPrefix = "/static/"
+
+// importLocalFile อัปโหลดไฟล์บนดิสก์เข้า Storage ที่ key คืน false ถ้าไม่มีไฟล์นั้น
+func importLocalFile(store Storage, file, key string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if err := store.Put(key, f, st.Size(), contentTypeOf(key)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// storedObjectExists ตรวจว่ามี key อยู่ใน Storage แล้ว
+func storedObjectExists(store Storage, key string) (bool, error) {
+	obj, err := store.Get(key)
+	if errors.Is(err, ErrObjectNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	obj.Body.Close()
+	return true, nil
+}
+
+// MigrateFilesToStorage ย้ายไฟล์ของหนังสือเข้า Storage ที่ตั้งค่าไว้ และเปลี่ยนค่าในฐานข้อมูลเป็น key
+//   - ปก/ภาพย่อ/e-book ที่ยังอ้างเป็น /static/... : อัปโหลดจาก staticDir แล้วลบไฟล์ใน ./static ทิ้ง
+//   - e-book ทุกไฟล์ที่ยังค้างใน staticDir/ebooks (ดาวน์โหลดได้สาธารณะ) ถูกย้ายเข้า Storage
+//   - key ที่ยังไม่มีใน Storage แต่มีไฟล์ใน localDir (เช่นเพิ่งเปลี่ยนจาก local เป็น s3) ถูกอัปโหลดให้
+func MigrateFilesToStorage(db *gorm.DB, store Storage, staticDir, localDir string) error {
+	ebookDir := filepath.Join(staticDir, "ebooks")
+	entries, err := os.ReadDir(ebookDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		file := filepath.Join(ebookDir, e.Name())
+		if _, err := importLocalFile(store, file, ebookKeyPrefix+e.Name()); err != nil {
+			return fmt.Errorf("move %s: %w", file, err)
+		}
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+
+	columns := []string{"cover_image", "cover_small", "cover_medium", "cover_large", "ebook_file"}
+	var books []entity.Book
+	if err := db.Unscoped().Select(append([]string{"id"}, columns...)).Find(&books).Error; err != nil {
+		return err
+	}
+	var moved []string
+	for _, b := range books {
+		values := []string{b.CoverImage, b.CoverSmall, b.CoverMedium, b.CoverLarge, b.EbookFile}
+		updates := map[string]any{}
+		for i, v := range values {
+			switch {
+			case strings.HasPrefix(v, legacyStaticPrefix):
+				key := strings.TrimPrefix(path.Clean(v), legacyStaticPrefix)
+				file := filepath.Join(staticDir, filepath.FromSlash(key))
+				ok, err := importLocalFile(store, file, key)
+				if err != nil {
+					return fmt.Errorf("book %d %s: %w", b.ID, columns[i], err)
+				}
+				if ok {
+					moved = append(moved, file)
+				}
+				updates[columns[i]] = key
+			case strings.HasPrefix(v, coverKeyPrefix) || strings.HasPrefix(v, ebookKeyPrefix):
+				exists, err := storedObjectExists(store, v)
+				if err != nil {
+					return fmt.Errorf("book %d %s: %w", b.ID, columns[i], err)
+				}
+				if !exists {
+					if _, err := importLocalFile(store, filepath.Join(localDir, filepath.FromSlash(v)), v); err != nil {
+						return fmt.Errorf("book %d %s: %w", b.ID, columns[i], err)
+					}
+				}
+			}
+		}
+		if len(updates) == 0 {
+			continue
+		}
+		if err := db.Unscoped().Model(&entity.Book{}).Where("id = ?", b.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	// ลบไฟล์ต้นฉบับหลังอัปเดตฐานข้อมูลแล้วเท่านั้น (ปกเดียวกันอาจถูกใช้หลายเล่ม)
+	for _, f := range moved {
+		if err := os.Remove(f); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	s3UnsignedBody  = "UNSIGNED-PAYLOAD"
+	s3MaxPresignTTL = 7 * 24 * time.Hour
+)
+
+// S3Storage เก็บไฟล์ใน bucket ของบริการที่ใช้ API แบบ S3 (AWS S3, MinIO ฯลฯ)
+// ลงลายเซ็น request ด้วย AWS Signature Version 4 เอง จึงไม่ต้องพึ่ง SDK
+type S3Storage struct {
+	Endpoint  string // เช่น http://localhost:9000 หรือ https://s3.ap-southeast-1.amazonaws.com
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle ใช้ URL แบบ <endpoint>/<bucket>/<key> (MinIO) แทน <bucket>.<host>/<key>
+	PathStyle bool
+	Client    *http.Client
+	Clock     func() time.Time
+}
+
+func (s *S3Storage) now() time.Time {
+	if s.Clock != nil {
+		return s.Clock().UTC()
+	}
+	return time.Now().UTC()
+}
+
+func (s *S3Storage) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
+
+// objectURL URL ของ object ตาม key (path ยังไม่ encode)
+func (s *S3Storage) objectURL(key string) (*url.URL, error) {
+	clean, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.bucketURL(clean)
+}
+
+// bucketURL URL ของ bucket ต่อท้ายด้วย path (path ว่าง = ตัว bucket ใช้กับการ list)
+func (s *S3Storage) bucketURL(p string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if s.PathStyle {
+		u.Path += "/" + s.Bucket + "/" + p
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path += "/" + p
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	return u, nil
+}
+
+// s3EscapePath encode path ตาม SigV4: เว้นเฉพาะตัวอักษร unreserved และ /
+func s3EscapePath(p string) string {
+	return strings.ReplaceAll(s3Escape(p), "%2F", "/")
+}
+
+// s3Escape URI encode ตามที่ SigV4 กำหนด (RFC 3986, ช่องว่างเป็น %20)
+func s3Escape(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func s3CanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *S3Storage) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.Region + "/s3/aws4_request"
+}
+
+// signature ลายเซ็น SigV4 ของ canonical request
+func (s *S3Storage) signature(t time.Time, canonicalRequest string) string {
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		t.Format("20060102T150405Z"),
+		s.scope(t),
+		sha256Hex(canonicalRequest),
+	}, "\n")
+	k := hmacSHA256([]byte("AWS4"+s.SecretKey), t.Format("20060102"))
+	k = hmacSHA256(k, s.Region)
+	k = hmacSHA256(k, "s3")
+	k = hmacSHA256(k, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(k, stringToSign))
+}
+
+// signRequest ใส่ header Authorization ให้ request (ลงลายเซ็น host, x-amz-content-sha256, x-amz-date, content-type, range)
+// payloadHash = sha256 ของ body หรือ UNSIGNED-PAYLOAD เมื่อส่ง body แบบ stream
+func (s *S3Storage) signRequest(req *http.Request, t time.Time, payloadHash string) {
+	req.Header.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	names := []string{"host"}
+	values := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "x-amz-date" || lk == "x-amz-content-sha256" || lk == "content-type" || lk == "range" {
+			names = append(names, lk)
+			values[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	sort.Strings(names)
+	var headers strings.Builder
+	for _, n := range names {
+		headers.WriteString(n + ":" + values[n] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		headers.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.AccessKey, s.scope(t), signed, s.signature(t, canonical)))
+}
+
+func (s *S3Storage) do(method, key string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.signRequest(req, s.now(), s3UnsignedBody)
+	return s.client().Do(req)
+}
+
+// s3Error อ่านข้อความ error จาก response ที่ไม่สำเร็จ
+func s3Error(op, key string, resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %s: %s: %s", op, key, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+func (s *S3Storage) Put(key string, r io.Reader, size int64, contentType string) error {
+	h := http.Header{}
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(http.MethodPut, key, r, size, h)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return s3Error("put", key, resp)
+	}
+	return nil
+}
+
+func (s *S3Storage) Get(key string) (*StorageObject, error) {
+	resp, err := s.do(http.MethodGet, key, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrObjectNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, s3Error("get", key, resp)
+	}
+	mod, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	ct := resp.Header.Get("Content-Type")
+	if ct == "" {
+		ct = contentTypeOf(key)
+	}
+	return &StorageObject{Body: resp.Body, Size: resp.ContentLength, ModTime: mod, ContentType: ct}, nil
+}
+
+func (s *S3Storage) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return s3Error("delete", key, resp)
+	}
+	return nil
+}
+
+// s3ListResult ผลของ ListObjectsV2
+type s3ListResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// List ใช้ ListObjectsV2 อ่านทีละหน้า (สูงสุด 1000 รายการต่อหน้า) จนครบ
+func (s *S3Storage) List(prefix string) ([]StoredFile, error) {
+	var files []StoredFile
+	token := ""
+	for {
+		u, err := s.bucketURL("")
+		if err != nil {
+			return nil, err
+		}
+		q := url.Values{"list-type": {"2"}}
+		if prefix != "" {
+			q.Set("prefix", prefix)
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = s3CanonicalQuery(q)
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		s.signRequest(req, s.now(), s3UnsignedBody)
+		resp, err := s.client().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode/100 != 2 {
+			err := s3Error("list", prefix, resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var page s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range page.Contents {
+			files = append(files, StoredFile{Key: c.Key, Size: c.Size, ModTime: c.LastModified})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return files, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// SignedURL presigned GET URL (ลายเซ็นอยู่ใน query) S3 จำกัดอายุไม่เกิน 7 วัน
+func (s *S3Storage) SignedURL(key string, ttl time.Duration) (string, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	if ttl > s3MaxPresignTTL {
+		ttl = s3MaxPresignTTL
+	}
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	t := s.now()
+	q := url.Values{
+		"X-Amz-Algorithm":     {s3Algorithm},
+		"X-Amz-Credential":    {s.AccessKey + "/" + s.scope(t)},
+		"X-Amz-Date":          {t.Format("20060102T150405Z")},
+		"X-Amz-Expires":       {fmt.Sprint(int64(ttl / time.Second))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		s3CanonicalQuery(q),
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedBody,
+	}, "\n")
+	q.Set("X-Amz-Signature", s.signature(t, canonical))
+	u.RawQuery = s3CanonicalQuery(q)
+	return u.String(), nil
+}
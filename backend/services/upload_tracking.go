@@ -0,0 +1,342 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ที่เก็บไฟล์ที่ Upload.Store อ้างถึง
+const (
+	UploadStoreMain   = "storage" // config.Storage(): ปก ภาพย่อ e-book
+	UploadStorePublic = "static"  // ./static ที่เสิร์ฟสาธารณะ: รูปโปรไฟล์
+)
+
+// ชนิดระเบียนที่อ้างถึงไฟล์ได้ (UploadReference.OwnerType)
+const (
+	UploadOwnerBook       = "book"
+	UploadOwnerProfile    = "profile"
+	UploadOwnerIssue      = "issue"
+	UploadOwnerAttachment = "file_attachment"
+)
+
+// DefaultUploadGracePeriod ไฟล์ต้องไม่มีใครอ้างถึงนานเท่านี้ก่อนจะถูกลบ
+// (เผื่อไฟล์ที่เพิ่งอัปโหลดแต่ผู้ใช้ยังไม่ได้กดบันทึกฟอร์ม และหนังสือที่ถูกลบแล้วกู้คืน)
+const DefaultUploadGracePeriod = 7 * 24 * time.Hour
+
+var ErrInvalidGracePeriod = errors.New("grace period must not be negative")
+
+// uploadOwner ตารางและคอลัมน์ที่เก็บ key/URL ของไฟล์
+type uploadOwner struct {
+	Table   string
+	Columns []string
+}
+
+var uploadOwners = map[string]uploadOwner{
+	UploadOwnerBook:       {Table: "books", Columns: []string{"cover_image", "cover_small", "cover_medium", "cover_large", "ebook_file"}},
+	UploadOwnerProfile:    {Table: "profiles", Columns: []string{"avatar_url"}},
+	UploadOwnerIssue:      {Table: "issues", Columns: []string{"file_path"}},
+	UploadOwnerAttachment: {Table: "file_attachments", Columns: []string{"file_path"}},
+}
+
+// uploadOwnerTypes ลำดับคงที่สำหรับการ sync ทั้งหมด
+var uploadOwnerTypes = []string{UploadOwnerBook, UploadOwnerProfile, UploadOwnerIssue, UploadOwnerAttachment}
+
+// uploadLocation แปลงค่าในคอลัมน์เป็นที่เก็บและ key
+// "/static/avatars/x.png" -> (static, avatars/x.png), "covers/x.jpg" -> (storage, covers/x.jpg)
+// URL ภายนอก (http/https) และค่าว่างไม่ใช่ไฟล์ของระบบ
+func uploadLocation(value string) (string, string, bool) {
+	v := strings.TrimSpace(value)
+	switch {
+	case v == "", strings.HasPrefix(v, "http://"), strings.HasPrefix(v, "https://"):
+		return "", "", false
+	case strings.HasPrefix(v, legacyStaticPrefix):
+		key, err := cleanKey(strings.TrimPrefix(path.Clean(v), legacyStaticPrefix))
+		if err != nil {
+			return "", "", false
+		}
+		return UploadStorePublic, key, true
+	}
+	key, err := cleanKey(v)
+	if err != nil {
+		return "", "", false
+	}
+	return UploadStoreMain, key, true
+}
+
+// TrackUpload บันทึกไฟล์ที่เพิ่งอัปโหลด (ยังไม่มีใครอ้างถึงจนกว่าระเบียนเจ้าของจะถูกบันทึก)
+func TrackUpload(db *gorm.DB, store, key, contentType string, size int64, userID string) error {
+	now := time.Now()
+	up := entity.Upload{Store: store, Key: key, ContentType: contentType, Size: size, UploadedBy: userID, OrphanedAt: &now}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "store"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"content_type", "size", "uploaded_by", "updated_at"}),
+	}).Create(&up).Error
+}
+
+// ensureUpload หา Upload ของ store/key สร้างให้ถ้ายังไม่มี (ไฟล์ที่อัปโหลดก่อนมีการติดตาม)
+func ensureUpload(tx *gorm.DB, store, key string) (uint, error) {
+	up := entity.Upload{Store: store, Key: key, ContentType: contentTypeOf(key)}
+	if err := tx.Where(entity.Upload{Store: store, Key: key}).FirstOrCreate(&up).Error; err != nil {
+		return 0, err
+	}
+	return up.ID, nil
+}
+
+// SyncUploadReferences อ่านคอลัมน์ไฟล์ของระเบียนเจ้าของใหม่แล้วปรับ UploadReference ให้ตรง
+// เรียกหลังสร้าง/แก้ไข/ลบระเบียน (ระเบียนที่ถูกลบแล้วจะไม่เหลือการอ้างถึง)
+// ownerIDs ว่าง = ทุกระเบียนของชนิดนั้น
+func SyncUploadReferences(tx *gorm.DB, ownerType string, ownerIDs ...uint) error {
+	owner, ok := uploadOwners[ownerType]
+	if !ok {
+		return fmt.Errorf("unknown upload owner %q", ownerType)
+	}
+
+	refs := tx.Where("owner_type = ?", ownerType)
+	rows := tx.Table(owner.Table).Select(append([]string{"id"}, owner.Columns...)).Where("deleted_at IS NULL")
+	if len(ownerIDs) > 0 {
+		refs = refs.Where("owner_id IN ?", ownerIDs)
+		rows = rows.Where("id IN ?", ownerIDs)
+	}
+
+	var oldUploadIDs []uint
+	if err := refs.Session(&gorm.Session{}).Model(&entity.UploadReference{}).Pluck("upload_id", &oldUploadIDs).Error; err != nil {
+		return err
+	}
+	if err := refs.Session(&gorm.Session{}).Delete(&entity.UploadReference{}).Error; err != nil {
+		return err
+	}
+
+	var records []map[string]any
+	if err := rows.Find(&records).Error; err != nil {
+		return err
+	}
+	var newRefs []entity.UploadReference
+	for _, rec := range records {
+		id, err := toUint(rec["id"])
+		if err != nil {
+			return err
+		}
+		for _, col := range owner.Columns {
+			v, _ := rec[col].(string)
+			store, key, ok := uploadLocation(v)
+			if !ok {
+				continue
+			}
+			uploadID, err := ensureUpload(tx, store, key)
+			if err != nil {
+				return err
+			}
+			newRefs = append(newRefs, entity.UploadReference{UploadID: uploadID, OwnerType: ownerType, OwnerID: id, Field: col})
+		}
+	}
+	if len(newRefs) > 0 {
+		if err := tx.CreateInBatches(&newRefs, 200).Error; err != nil {
+			return err
+		}
+	}
+
+	affected := oldUploadIDs
+	for _, r := range newRefs {
+		affected = append(affected, r.UploadID)
+	}
+	if len(ownerIDs) == 0 {
+		// sync ทั้งตาราง: ตรวจทุก Upload
+		affected = nil
+	} else if len(affected) == 0 {
+		return nil
+	}
+	return markOrphanedUploads(tx, affected, time.Now())
+}
+
+// markOrphanedUploads ปรับ OrphanedAt ตามการอ้างถึงปัจจุบัน: ถูกอ้างถึง = nil, ไม่มีใครอ้างถึง = เวลาแรกที่พบ
+// uploadIDs nil = ทุก Upload
+func markOrphanedUploads(tx *gorm.DB, uploadIDs []uint, now time.Time) error {
+	scope := func() *gorm.DB {
+		q := tx.Model(&entity.Upload{})
+		if uploadIDs != nil {
+			q = q.Where("id IN ?", uploadIDs)
+		}
+		return q
+	}
+	referenced := tx.Model(&entity.UploadReference{}).Select("upload_id")
+	if err := scope().Where("orphaned_at IS NOT NULL AND id IN (?)", referenced).
+		Update("orphaned_at", nil).Error; err != nil {
+		return err
+	}
+	return scope().Where("orphaned_at IS NULL AND id NOT IN (?)", referenced).
+		Update("orphaned_at", now).Error
+}
+
+func toUint(v any) (uint, error) {
+	switch n := v.(type) {
+	case int64:
+		return uint(n), nil
+	case int:
+		return uint(n), nil
+	case uint:
+		return n, nil
+	case uint64:
+		return uint(n), nil
+	case int32:
+		return uint(n), nil
+	}
+	return 0, fmt.Errorf("unexpected id type %T", v)
+}
+
+// UploadService ติดตามไฟล์ในที่เก็บทั้งสองแห่งและเก็บกวาดไฟล์ที่ไม่มีใครอ้างถึง
+type UploadService struct {
+	DB     *gorm.DB
+	Store  Storage // config.Storage()
+	Public Storage // ./static
+}
+
+func (s *UploadService) stores() map[string]Storage {
+	return map[string]Storage{UploadStoreMain: s.Store, UploadStorePublic: s.Public}
+}
+
+// uploadScanPrefixes โฟลเดอร์ที่เก็บไฟล์อัปโหลดในแต่ละที่เก็บ (./static อาจมีไฟล์อื่นของเว็บที่ต้องไม่ถูกลบ)
+var uploadScanPrefixes = map[string][]string{
+	UploadStoreMain:   {coverKeyPrefix, ebookKeyPrefix},
+	UploadStorePublic: {"avatars/"},
+}
+
+// GarbageInput ตัวเลือกของการเก็บกวาด
+type GarbageInput struct {
+	DryRun bool
+	Grace  time.Duration
+}
+
+// GarbageFile ไฟล์ที่ถูกลบ (หรือจะถูกลบเมื่อไม่ใช่ dry run)
+type GarbageFile struct {
+	Store      string    `json:"store"`
+	Key        string    `json:"key"`
+	Size       int64     `json:"size"`
+	OrphanedAt time.Time `json:"orphaned_at"`
+}
+
+// GarbageReport ผลการเก็บกวาด
+type GarbageReport struct {
+	DryRun     bool          `json:"dry_run"`
+	GraceHours float64       `json:"grace_hours"`
+	Scanned    int           `json:"scanned"`    // จำนวนไฟล์ที่พบในที่เก็บ
+	Discovered int           `json:"discovered"` // ไฟล์ที่ยังไม่เคยถูกติดตาม (นับเวลา grace จากตอนนี้)
+	Orphaned   int           `json:"orphaned"`   // ไฟล์ที่ไม่มีใครอ้างถึง รวมที่ยังไม่ครบ grace
+	Files      []GarbageFile `json:"files"`      // ไฟล์ที่ไม่มีใครอ้างถึงนานกว่า grace
+	Deleted    int           `json:"deleted"`
+	FreedBytes int64         `json:"freed_bytes"`
+}
+
+// discover ลงทะเบียนไฟล์ในที่เก็บที่ยังไม่มี Upload (เช่นไฟล์ซ้ำที่ค้างมาจากก่อนมีการติดตาม)
+func (s *UploadService) discover(report *GarbageReport) error {
+	for name, store := range s.stores() {
+		if store == nil {
+			continue
+		}
+		for _, prefix := range uploadScanPrefixes[name] {
+			files, err := store.List(prefix)
+			if err != nil {
+				return fmt.Errorf("list %s/%s: %w", name, prefix, err)
+			}
+			report.Scanned += len(files)
+			for _, f := range files {
+				var up entity.Upload
+				err := s.DB.Where(&entity.Upload{Store: name, Key: f.Key}).First(&up).Error
+				if err == nil {
+					if up.Size == 0 && f.Size > 0 {
+						if err := s.DB.Model(&up).Update("size", f.Size).Error; err != nil {
+							return err
+						}
+					}
+					continue
+				}
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					return err
+				}
+				if err := TrackUpload(s.DB, name, f.Key, contentTypeOf(f.Key), f.Size, ""); err != nil {
+					return err
+				}
+				report.Discovered++
+			}
+		}
+	}
+	return nil
+}
+
+// CollectGarbage ตรวจการอ้างถึงของทุกตารางใหม่ แล้วลบไฟล์ที่ไม่มีใครอ้างถึงนานกว่า Grace
+// DryRun รายงานเฉพาะไฟล์ที่จะถูกลบ (ยังบันทึกการติดตามไฟล์ที่พบใหม่)
+func (s *UploadService) CollectGarbage(in GarbageInput) (*GarbageReport, error) {
+	if in.Grace < 0 {
+		return nil, ErrInvalidGracePeriod
+	}
+	report := &GarbageReport{DryRun: in.DryRun, GraceHours: in.Grace.Hours(), Files: []GarbageFile{}}
+	if err := s.discover(report); err != nil {
+		return nil, err
+	}
+	if err := s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, t := range uploadOwnerTypes {
+			if err := SyncUploadReferences(tx, t); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var orphaned int64
+	if err := s.DB.Model(&entity.Upload{}).Where("orphaned_at IS NOT NULL").Count(&orphaned).Error; err != nil {
+		return nil, err
+	}
+	report.Orphaned = int(orphaned)
+
+	var candidates []entity.Upload
+	if err := s.DB.Where("orphaned_at IS NOT NULL AND orphaned_at <= ?", time.Now().Add(-in.Grace)).
+		Order("orphaned_at").Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	stores := s.stores()
+	for _, up := range candidates {
+		file := GarbageFile{Store: up.Store, Key: up.Key, Size: up.Size, OrphanedAt: *up.OrphanedAt}
+		if in.DryRun {
+			report.Files = append(report.Files, file)
+			continue
+		}
+		store := stores[up.Store]
+		if store == nil {
+			continue
+		}
+		// ลบแถวก่อนไฟล์ และตรวจซ้ำว่ายังไม่มีใครอ้างถึงระหว่างนี้ ถ้าลบไฟล์ไม่สำเร็จ รอบถัดไปจะพบไฟล์และติดตามใหม่
+		var removed bool
+		if err := s.DB.Transaction(func(tx *gorm.DB) error {
+			var refs int64
+			if err := tx.Model(&entity.UploadReference{}).Where("upload_id = ?", up.ID).Count(&refs).Error; err != nil {
+				return err
+			}
+			if refs > 0 {
+				return nil
+			}
+			res := tx.Unscoped().Where("orphaned_at IS NOT NULL").Delete(&entity.Upload{}, up.ID)
+			removed = res.RowsAffected > 0
+			return res.Error
+		}); err != nil {
+			return nil, err
+		}
+		if !removed {
+			continue
+		}
+		if err := store.Delete(up.Key); err != nil {
+			return nil, fmt.Errorf("delete %s/%s: %w", up.Store, up.Key, err)
+		}
+		report.Files = append(report.Files, file)
+		report.Deleted++
+		report.FreedBytes += up.Size
+	}
+	return report, nil
+}
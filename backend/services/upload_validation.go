@@ -0,0 +1,143 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ชนิดไฟล์ที่ระบบรับ (ตรวจจาก magic bytes ไม่ได้ดูจากนามสกุลหรือ Content-Type ที่ client ส่งมา)
+const (
+	ContentTypePNG  = "image/png"
+	ContentTypeJPEG = "image/jpeg"
+	ContentTypeWebP = "image/webp"
+	ContentTypePDF  = "application/pdf"
+	ContentTypeEPUB = "application/epub+zip"
+)
+
+var (
+	ErrUploadMissing         = errors.New("no file uploaded (multipart field \"file\")")
+	ErrUploadTooLarge        = errors.New("file is too large")
+	ErrUploadUnsupportedType = errors.New("file content is not an accepted type")
+	ErrUploadCorrupt         = errors.New("file content is damaged or incomplete")
+)
+
+// นามสกุลที่ใช้ตั้งชื่อไฟล์ฝั่ง server ตามชนิดที่ตรวจได้
+var uploadExtensions = map[string]string{
+	ContentTypePNG:  ".png",
+	ContentTypeJPEG: ".jpg",
+	ContentTypeWebP: ".webp",
+	ContentTypePDF:  ".pdf",
+	ContentTypeEPUB: ".epub",
+}
+
+// uploadExtensionTypes ชนิดไฟล์ตามนามสกุล (ย้อนกลับของ uploadExtensions รวม .jpeg จากไฟล์รุ่นเก่า)
+var uploadExtensionTypes = map[string]string{
+	".png":  ContentTypePNG,
+	".jpg":  ContentTypeJPEG,
+	".jpeg": ContentTypeJPEG,
+	".webp": ContentTypeWebP,
+	".pdf":  ContentTypePDF,
+	".epub": ContentTypeEPUB,
+}
+
+// UploadPolicy ชนิดไฟล์ที่รับและขนาดสูงสุดของการอัปโหลดแต่ละประเภท
+type UploadPolicy struct {
+	Kind     string
+	MaxBytes int64
+	Allowed  []string
+}
+
+var (
+	CoverUploadPolicy  = UploadPolicy{Kind: "cover", MaxBytes: 5 << 20, Allowed: []string{ContentTypePNG, ContentTypeJPEG, ContentTypeWebP}}
+	AvatarUploadPolicy = UploadPolicy{Kind: "avatar", MaxBytes: 2 << 20, Allowed: []string{ContentTypePNG, ContentTypeJPEG, ContentTypeWebP}}
+	EbookUploadPolicy  = UploadPolicy{Kind: "ebook", MaxBytes: 100 << 20, Allowed: []string{ContentTypePDF, ContentTypeEPUB}}
+)
+
+// DetectContentType ตรวจชนิดไฟล์จาก magic bytes; EPUB ต้องเป็น zip ที่มี mimetype เป็นไฟล์แรก
+// และมี META-INF/container.xml ตามมาตรฐาน OCF
+func DetectContentType(r io.ReaderAt, size int64) (string, error) {
+	head := make([]byte, 64)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return ContentTypePNG, nil
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return ContentTypeJPEG, nil
+	case len(head) >= 12 && bytes.Equal(head[:4], []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WEBP")):
+		return ContentTypeWebP, nil
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return ContentTypePDF, nil
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		if err := checkEpub(r, size); err != nil {
+			return "", err
+		}
+		return ContentTypeEPUB, nil
+	}
+	return "", ErrUploadUnsupportedType
+}
+
+func checkEpub(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUploadCorrupt, err)
+	}
+	if len(zr.File) == 0 || zr.File[0].Name != "mimetype" {
+		// zip ทั่วไปที่ไม่ใช่ EPUB
+		return ErrUploadUnsupportedType
+	}
+	f, err := zr.File[0].Open()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUploadCorrupt, err)
+	}
+	defer f.Close()
+	mt, err := io.ReadAll(io.LimitReader(f, 64))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUploadCorrupt, err)
+	}
+	if string(bytes.TrimSpace(mt)) != ContentTypeEPUB {
+		return ErrUploadUnsupportedType
+	}
+	for _, zf := range zr.File {
+		if zf.Name == "META-INF/container.xml" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: META-INF/container.xml is missing", ErrUploadCorrupt)
+}
+
+// Check ตรวจขนาดและชนิดไฟล์ตาม policy คืนชนิดไฟล์ที่ตรวจได้
+func (p UploadPolicy) Check(r io.ReaderAt, size int64) (string, error) {
+	if size > p.MaxBytes {
+		return "", fmt.Errorf("%w: %s must not exceed %d MB", ErrUploadTooLarge, p.Kind, p.MaxBytes>>20)
+	}
+	ct, err := DetectContentType(r, size)
+	if err != nil {
+		return "", err
+	}
+	for _, a := range p.Allowed {
+		if ct == a {
+			return ct, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s is not accepted for %s", ErrUploadUnsupportedType, ct, p.Kind)
+}
+
+// RandomUploadName ชื่อไฟล์ฝั่ง server: เวลา + ค่าสุ่ม + นามสกุลตามชนิดที่ตรวจได้ (ไม่ใช้ชื่อไฟล์จาก client)
+func RandomUploadName(contentType string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return time.Now().Format("20060102150405") + "_" + hex.EncodeToString(b) + uploadExtensions[contentType], nil
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// วิธีตั้งรหัสผ่านให้บัญชีที่ import
+const (
+	// ImportPasswordOneTime สุ่มรหัสผ่านชั่วคราวและคืนใน ImportResult ให้ admin แจกเอง
+	ImportPasswordOneTime = "otp"
+	// ImportPasswordReset ตั้งรหัสผ่านสุ่มที่ไม่มีใครรู้ แล้วส่งลิงก์ตั้งรหัสผ่านใหม่ผ่าน Accounts
+	ImportPasswordReset = "reset"
+)
+
+// MaxImportRows จำนวนแถวสูงสุดต่อไฟล์ (ไม่นับหัวตาราง)
+const MaxImportRows = 5000
+
+const oneTimePasswordLength = 12
+
+// ตัดตัวอักษรที่อ่านสับสนง่าย (0/O, 1/l/I) ออก
+const oneTimePasswordAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789"
+
+var (
+	ErrImportHeader       = errors.New("csv header must include user_id, firstname, lastname and email")
+	ErrImportEmpty        = errors.New("csv file has no data rows")
+	ErrImportTooLarge     = fmt.Errorf("csv file has more than %d rows", MaxImportRows)
+	ErrImportPasswordMode = errors.New("password_mode must be \"otp\" or \"reset\"")
+	ErrImportHasErrors    = errors.New("some rows are invalid, nothing was imported")
+)
+
+// คอลัมน์ที่ต้องมีในหัวตาราง (คอลัมน์เสริม: phone_number, role, borrowing_limit)
+var importRequiredColumns = []string{"user_id", "firstname", "lastname", "email"}
+
+type ImportUsersInput struct {
+	DryRun       bool
+	PasswordMode string // ImportPasswordOneTime (ค่าเริ่มต้น) หรือ ImportPasswordReset
+}
+
+// ImportRowResult ผลของหนึ่งแถว Line นับแบบเดียวกับโปรแกรม spreadsheet (หัวตาราง = 1)
+type ImportRowResult struct {
+	Line            int      `json:"line"`
+	UserID          string   `json:"user_id"`
+	Email           string   `json:"email"`
+	Status          string   `json:"status"` // "valid" | "invalid" | "created"
+	Errors          []string `json:"errors,omitempty"`
+	OneTimePassword string   `json:"one_time_password,omitempty"`
+	Warning         string   `json:"warning,omitempty"`
+}
+
+type ImportResult struct {
+	DryRun       bool              `json:"dry_run"`
+	PasswordMode string            `json:"password_mode"`
+	Total        int               `json:"total"`
+	Valid        int               `json:"valid"`
+	Invalid      int               `json:"invalid"`
+	Created      int               `json:"created"`
+	Rows         []ImportRowResult `json:"rows"`
+}
+
+// importRow แถวที่อ่านได้ index ชี้ไปยังผลของแถวนั้นใน ImportResult.Rows
+type importRow struct {
+	index int
+	user  entity.User
+}
+
+// generateOneTimePassword สุ่มรหัสผ่านชั่วคราวด้วย crypto/rand
+func generateOneTimePassword() (string, error) {
+	b := make([]byte, oneTimePasswordLength)
+	max := big.NewInt(int64(len(oneTimePasswordAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = oneTimePasswordAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+// Import นำเข้าผู้ใช้จาก CSV ตรวจทุกแถวก่อนเสมอ
+// DryRun = ตรวจอย่างเดียว; โหมดจริงจะสร้างทั้งหมดใน transaction เดียว และไม่สร้างเลยถ้ามีแถวที่ผิด
+func (s *UserService) Import(r io.Reader, in ImportUsersInput) (*ImportResult, error) {
+	if in.PasswordMode == "" {
+		in.PasswordMode = ImportPasswordOneTime
+	}
+	if in.PasswordMode != ImportPasswordOneTime && in.PasswordMode != ImportPasswordReset {
+		return nil, ErrImportPasswordMode
+	}
+
+	rows, out, err := s.validateImport(r)
+	if err != nil {
+		return nil, err
+	}
+	out.DryRun = in.DryRun
+	out.PasswordMode = in.PasswordMode
+	if in.DryRun {
+		return out, nil
+	}
+	if out.Invalid > 0 {
+		return out, ErrImportHasErrors
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			res := &out.Rows[row.index]
+			password, err := generateOneTimePassword()
+			if err != nil {
+				return err
+			}
+			hash, err := hashPassword(password)
+			if err != nil {
+				return err
+			}
+			u := row.user
+			u.Password = hash
+			u.MustChangePassword = true
+			if err := tx.Omit(clause.Associations).Create(&u).Error; err != nil {
+				return fmt.Errorf("line %d: %w", res.Line, err)
+			}
+			if in.PasswordMode == ImportPasswordOneTime {
+				res.OneTimePassword = password
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		res := &out.Rows[row.index]
+		res.Status = "created"
+		out.Created++
+		if in.PasswordMode == ImportPasswordReset && s.Accounts != nil {
+			// ส่งหลัง commit; ถ้าส่งไม่สำเร็จผู้ใช้ยังขอลิงก์ใหม่เองได้ที่ /auth/password/forgot
+			if err := s.Accounts.RequestPasswordReset(row.user.UserID); err != nil {
+				res.Warning = "reset link not sent: " + err.Error()
+			}
+		}
+	}
+	return out, nil
+}
+
+// validateImport อ่าน CSV และตรวจทุกแถวกับข้อมูลในฐานข้อมูลและแถวอื่นในไฟล์เดียวกัน
+func (s *UserService) validateImport(r io.Reader) ([]importRow, *ImportResult, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, ErrImportEmpty
+		}
+		return nil, nil, err
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		col[h] = i
+	}
+	for _, name := range importRequiredColumns {
+		if _, ok := col[name]; !ok {
+			return nil, nil, ErrImportHeader
+		}
+	}
+	field := func(rec []string, name string) string {
+		i, ok := col[name]
+		if !ok || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	// ข้อมูลอ้างอิง: role ตามชื่อ และ borrowing limit ตามจำนวนเล่ม
+	var roles []entity.Role
+	if err := s.DB.Find(&roles).Error; err != nil {
+		return nil, nil, err
+	}
+	roleByName := map[string]uint{}
+	for _, ro := range roles {
+		roleByName[strings.ToLower(ro.Name)] = ro.ID
+	}
+	var limits []entity.BorrowingLimit
+	if err := s.DB.Order("limit_number").Find(&limits).Error; err != nil {
+		return nil, nil, err
+	}
+	limitByNumber := map[uint]uint{}
+	for _, l := range limits {
+		limitByNumber[l.LimitNumber] = l.ID
+	}
+
+	out := &ImportResult{}
+	var rows []importRow
+	seenID := map[string]int{}
+	seenEmail := map[string]int{}
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				out.Rows = append(out.Rows, ImportRowResult{Line: perr.StartLine, Status: "invalid", Errors: []string{perr.Err.Error()}})
+				out.Invalid++
+				out.Total++
+				continue
+			}
+			return nil, nil, err
+		}
+		if isBlankRecord(rec) {
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+		out.Total++
+		if out.Total > MaxImportRows {
+			return nil, nil, ErrImportTooLarge
+		}
+
+		res := ImportRowResult{Line: line, UserID: field(rec, "user_id"), Email: strings.ToLower(field(rec, "email"))}
+		var errs []string
+
+		if res.UserID == "" {
+			errs = append(errs, "user_id is required")
+		} else if prev, ok := seenID[res.UserID]; ok {
+			errs = append(errs, fmt.Sprintf("user_id duplicates line %d", prev))
+		} else {
+			seenID[res.UserID] = line
+		}
+		firstname, lastname := field(rec, "firstname"), field(rec, "lastname")
+		if firstname == "" {
+			errs = append(errs, "firstname is required")
+		}
+		if lastname == "" {
+			errs = append(errs, "lastname is required")
+		}
+		if email, err := normalizeEmail(res.Email); err != nil {
+			errs = append(errs, "email is invalid")
+		} else if prev, ok := seenEmail[email]; ok {
+			errs = append(errs, fmt.Sprintf("email duplicates line %d", prev))
+		} else {
+			res.Email = email
+			seenEmail[email] = line
+		}
+
+		roleID := roleByName[RoleUser]
+		if v := field(rec, "role"); v != "" {
+			id, ok := roleByName[strings.ToLower(v)]
+			if !ok {
+				errs = append(errs, fmt.Sprintf("unknown role %q", v))
+			}
+			roleID = id
+		}
+		var limitID uint
+		if len(limits) > 0 {
+			limitID = limits[0].ID
+		}
+		if v := field(rec, "borrowing_limit"); v != "" {
+			n, err := strconv.ParseUint(v, 10, 64)
+			id, ok := limitByNumber[uint(n)]
+			if err != nil || !ok {
+				errs = append(errs, fmt.Sprintf("unknown borrowing_limit %q", v))
+			}
+			limitID = id
+		}
+
+		res.Errors = errs
+		out.Rows = append(out.Rows, res)
+		rows = append(rows, importRow{
+			index: len(out.Rows) - 1,
+			user: entity.User{
+				UserID:           res.UserID,
+				Firstname:        firstname,
+				Lastname:         lastname,
+				Email:            res.Email,
+				PhoneNumber:      field(rec, "phone_number"),
+				RoleID:           roleID,
+				BorrowingLimitID: limitID,
+			},
+		})
+	}
+	if out.Total == 0 {
+		return nil, nil, ErrImportEmpty
+	}
+
+	// ตรวจซ้ำกับผู้ใช้ที่มีอยู่แล้วในครั้งเดียว แทนการ query ทีละแถว
+	ids := make([]string, 0, len(seenID))
+	for id := range seenID {
+		ids = append(ids, id)
+	}
+	emails := make([]string, 0, len(seenEmail))
+	for e := range seenEmail {
+		emails = append(emails, e)
+	}
+	var existing []entity.User
+	if err := s.DB.Select("user_id", "email").
+		Where("user_id IN ? OR LOWER(email) IN ?", ids, emails).
+		Find(&existing).Error; err != nil {
+		return nil, nil, err
+	}
+	takenID := map[string]bool{}
+	takenEmail := map[string]bool{}
+	for _, u := range existing {
+		takenID[u.UserID] = true
+		takenEmail[strings.ToLower(u.Email)] = true
+	}
+
+	valid := rows[:0]
+	for _, row := range rows {
+		res := &out.Rows[row.index]
+		if res.UserID != "" && takenID[res.UserID] {
+			res.Errors = append(res.Errors, "user_id already exists")
+		}
+		if takenEmail[res.Email] {
+			res.Errors = append(res.Errors, "email already exists")
+		}
+		if len(res.Errors) > 0 {
+			res.Status = "invalid"
+			out.Invalid++
+			continue
+		}
+		res.Status = "valid"
+		out.Valid++
+		valid = append(valid, row)
+	}
+	return valid, out, nil
+}
+
+func isBlankRecord(rec []string) bool {
+	for _, v := range rec {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,438 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/PIPAT-I/G10-SA/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ชื่อ Role (seed ไว้ใน config.createDefaultRoles)
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var (
+	ErrUserIDTaken          = errors.New("user id is already in use")
+	ErrInvalidUserID        = errors.New("user id is required")
+	ErrRoleNotFound         = errors.New("role not found")
+	ErrLastAdmin            = errors.New("cannot demote, disable or remove the last active admin")
+	ErrUserHasActiveBorrows = errors.New("user still has books that are not returned")
+)
+
+// UserService งานจัดการผู้ใช้ของ admin
+// Notifications/HoldPeriod ใช้ตอนส่ง license ที่ผู้ใช้ถูก Hold ไว้ต่อให้คิวถัดไป เมื่อปิดบัญชีหรือลบผู้ใช้
+// Accounts ใช้ส่งลิงก์ตั้งรหัสผ่านให้บัญชีที่ import ด้วย ImportPasswordReset
+type UserService struct {
+	DB            *gorm.DB
+	Notifications *NotificationService
+	Accounts      *AccountService
+	HoldPeriod    time.Duration
+}
+
+type CreateUserInput struct {
+	UserID           string
+	Password         string
+	Firstname        string
+	Lastname         string
+	Email            string
+	PhoneNumber      string
+	RoleID           uint // 0 = role "user"
+	BorrowingLimitID uint // 0 = ระดับที่ยืมได้น้อยที่สุด
+}
+
+// UpdateUserInput ฟิลด์ที่เป็น nil จะไม่ถูกแก้ไข (Password ว่าง = ไม่เปลี่ยน)
+type UpdateUserInput struct {
+	Firstname        *string
+	Lastname         *string
+	Email            *string
+	PhoneNumber      *string
+	Password         *string
+	RoleID           *uint
+	BorrowingLimitID *uint
+}
+
+type ListUsersInput struct {
+	Q        string // ค้นจาก UserID, ชื่อ, นามสกุล หรืออีเมล
+	RoleID   uint
+	Disabled *bool
+	Page     int
+	PageSize int
+}
+
+type UserPage struct {
+	Items    []entity.User `json:"items"`
+	Total    int64         `json:"total"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+}
+
+func (s *UserService) load(tx *gorm.DB, userID string) (*entity.User, error) {
+	var u entity.User
+	if err := tx.Preload("Role").Preload("BorrowingLimit").Preload("Profile").
+		Where("user_id = ?", userID).
+		First(&u).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+// resolveRole คืน Role ตาม id (0 = role "user")
+func resolveRole(tx *gorm.DB, roleID uint) (*entity.Role, error) {
+	var r entity.Role
+	q := tx
+	if roleID == 0 {
+		q = q.Where("name = ?", RoleUser)
+	} else {
+		q = q.Where("id = ?", roleID)
+	}
+	if err := q.First(&r).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// resolveBorrowingLimit คืน BorrowingLimit ตาม id (0 = ระดับที่ยืมได้น้อยที่สุด)
+func resolveBorrowingLimit(tx *gorm.DB, limitID uint) (*entity.BorrowingLimit, error) {
+	var l entity.BorrowingLimit
+	q := tx
+	if limitID == 0 {
+		q = q.Order("limit_number")
+	} else {
+		q = q.Where("id = ?", limitID)
+	}
+	if err := q.First(&l).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLimitNotFound
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+// ensureEmailFree ตรวจว่าอีเมลยังไม่มีผู้ใช้คนอื่นใช้ (exceptUserID = ตัวเอง)
+func ensureEmailFree(tx *gorm.DB, email, exceptUserID string) error {
+	var n int64
+	if err := tx.Model(&entity.User{}).
+		Where("LOWER(email) = ? AND user_id <> ?", email, exceptUserID).
+		Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrEmailTaken
+	}
+	return nil
+}
+
+// ensureNotLastAdmin กันไม่ให้ระบบเหลือ admin ที่ใช้งานได้เป็นศูนย์
+// เรียกก่อนลด role, ปิดบัญชี หรือลบผู้ใช้ u
+func ensureNotLastAdmin(tx *gorm.DB, u *entity.User) error {
+	if u.Role == nil || u.Role.Name != RoleAdmin || u.DisabledAt != nil {
+		return nil
+	}
+	var others int64
+	if err := tx.Model(&entity.User{}).
+		Joins("JOIN roles ON roles.id = users.role_id").
+		Where("roles.name = ? AND users.disabled_at IS NULL AND users.user_id <> ?", RoleAdmin, u.UserID).
+		Count(&others).Error; err != nil {
+		return err
+	}
+	if others == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// cancelOpenReservations ยกเลิกการจองที่ยังค้างอยู่ของผู้ใช้ และส่ง license ที่ Hold ไว้ให้คิวถัดไป
+func (s *UserService) cancelOpenReservations(tx *gorm.DB, userID string) error {
+	waitingID, err := reservationStatusID(tx, ReservationStatusWaiting)
+	if err != nil {
+		return err
+	}
+	notifiedID, err := reservationStatusID(tx, ReservationStatusNotified)
+	if err != nil {
+		return err
+	}
+	var open []entity.Reservation
+	if err := tx.Where("user_id = ? AND reservation_status_id IN ?", userID, []uint{waitingID, notifiedID}).
+		Find(&open).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range open {
+		next, err := closeReservation(tx, &open[i], ReservationStatusCancelled, now, s.HoldPeriod)
+		if err != nil && !errors.Is(err, ErrReservationClosed) {
+			return err
+		}
+		if err := s.Notifications.NotifyReservationReady(tx, next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List ค้นหาและแบ่งหน้ารายชื่อผู้ใช้ เรียงตาม UserID
+func (s *UserService) List(in ListUsersInput) (*UserPage, error) {
+	q := s.DB.Model(&entity.User{})
+	if kw := strings.TrimSpace(in.Q); kw != "" {
+		like := "%" + strings.ToLower(kw) + "%"
+		q = q.Where("LOWER(user_id) LIKE ? OR LOWER(firstname) LIKE ? OR LOWER(lastname) LIKE ? OR LOWER(email) LIKE ?",
+			like, like, like, like)
+	}
+	if in.RoleID != 0 {
+		q = q.Where("role_id = ?", in.RoleID)
+	}
+	if in.Disabled != nil {
+		if *in.Disabled {
+			q = q.Where("disabled_at IS NOT NULL")
+		} else {
+			q = q.Where("disabled_at IS NULL")
+		}
+	}
+
+	out := UserPage{Page: in.Page, PageSize: in.PageSize}
+	if err := q.Count(&out.Total).Error; err != nil {
+		return nil, err
+	}
+	if err := q.Preload("Role").Preload("BorrowingLimit").
+		Order("user_id").
+		Limit(in.PageSize).
+		Offset((in.Page - 1) * in.PageSize).
+		Find(&out.Items).Error; err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Get ข้อมูลผู้ใช้หนึ่งคน
+func (s *UserService) Get(userID string) (*entity.User, error) {
+	return s.load(s.DB, userID)
+}
+
+// Create สร้างผู้ใช้ใหม่ รหัสผ่านถูก hash ด้วย bcrypt
+func (s *UserService) Create(in CreateUserInput) (*entity.User, error) {
+	in.UserID = strings.TrimSpace(in.UserID)
+	if in.UserID == "" {
+		return nil, ErrInvalidUserID
+	}
+	email, err := normalizeEmail(in.Email)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hashPassword(in.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		var n int64
+		if err := tx.Model(&entity.User{}).Where("user_id = ?", in.UserID).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrUserIDTaken
+		}
+		if err := ensureEmailFree(tx, email, ""); err != nil {
+			return err
+		}
+		role, err := resolveRole(tx, in.RoleID)
+		if err != nil {
+			return err
+		}
+		limit, err := resolveBorrowingLimit(tx, in.BorrowingLimitID)
+		if err != nil {
+			return err
+		}
+
+		u := entity.User{
+			UserID:           in.UserID,
+			Password:         hash,
+			Firstname:        strings.TrimSpace(in.Firstname),
+			Lastname:         strings.TrimSpace(in.Lastname),
+			Email:            email,
+			PhoneNumber:      strings.TrimSpace(in.PhoneNumber),
+			RoleID:           role.ID,
+			BorrowingLimitID: limit.ID,
+		}
+		return tx.Omit(clause.Associations).Create(&u).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(in.UserID)
+}
+
+// Update แก้ไขข้อมูลผู้ใช้ ถ้าเปลี่ยน role หรือรหัสผ่านจะเพิกถอนทุก session ของผู้ใช้คนนั้น
+func (s *UserService) Update(userID string, in UpdateUserInput) (*entity.User, error) {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		u, err := s.load(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		updates := map[string]any{}
+		if in.Firstname != nil {
+			updates["firstname"] = strings.TrimSpace(*in.Firstname)
+		}
+		if in.Lastname != nil {
+			updates["lastname"] = strings.TrimSpace(*in.Lastname)
+		}
+		if in.PhoneNumber != nil {
+			updates["phone_number"] = strings.TrimSpace(*in.PhoneNumber)
+		}
+		if in.Email != nil {
+			email, err := normalizeEmail(*in.Email)
+			if err != nil {
+				return err
+			}
+			if err := ensureEmailFree(tx, email, userID); err != nil {
+				return err
+			}
+			updates["email"] = email
+		}
+		if in.RoleID != nil && *in.RoleID != u.RoleID {
+			role, err := resolveRole(tx, *in.RoleID)
+			if err != nil {
+				return err
+			}
+			if role.Name != RoleAdmin {
+				if err := ensureNotLastAdmin(tx, u); err != nil {
+					return err
+				}
+			}
+			updates["role_id"] = role.ID
+		}
+		if in.BorrowingLimitID != nil {
+			limit, err := resolveBorrowingLimit(tx, *in.BorrowingLimitID)
+			if err != nil {
+				return err
+			}
+			updates["borrowing_limit_id"] = limit.ID
+		}
+		revoke := ""
+		if _, ok := updates["role_id"]; ok {
+			// role อยู่ใน access token: ให้ login ใหม่เพื่อรับสิทธิ์ตาม role ปัจจุบัน
+			revoke = RevokeReasonRoleChanged
+		}
+		if in.Password != nil && *in.Password != "" {
+			hash, err := hashPassword(*in.Password)
+			if err != nil {
+				return err
+			}
+			updates["password"] = hash
+			revoke = RevokeReasonPasswordChange
+		}
+
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(&entity.User{}).Where("user_id = ?", userID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if revoke != "" {
+			return RevokeUserSessions(tx, userID, revoke, "")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(userID)
+}
+
+// SetRole เปลี่ยน role ของผู้ใช้ (ผู้ใช้ต้อง login ใหม่)
+func (s *UserService) SetRole(userID string, roleID uint) (*entity.User, error) {
+	return s.Update(userID, UpdateUserInput{RoleID: &roleID})
+}
+
+// SetDisabled ปิดหรือเปิดบัญชีผู้ใช้ การปิดบัญชีจะเพิกถอนทุก session ทันทีและยกเลิกการจองที่ค้างอยู่
+func (s *UserService) SetDisabled(userID string, disabled bool) (*entity.User, error) {
+	err := s.Notifications.Transaction(s.DB, func(tx *gorm.DB) error {
+		u, err := s.load(tx, userID)
+		if err != nil {
+			return err
+		}
+		if !disabled {
+			return tx.Model(&entity.User{}).Where("user_id = ?", userID).Update("disabled_at", nil).Error
+		}
+		if u.DisabledAt != nil {
+			return nil
+		}
+		if err := ensureNotLastAdmin(tx, u); err != nil {
+			return err
+		}
+		if err := tx.Model(&entity.User{}).Where("user_id = ?", userID).Update("disabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := s.cancelOpenReservations(tx, userID); err != nil {
+			return err
+		}
+		return RevokeUserSessions(tx, userID, RevokeReasonUserDisabled, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(userID)
+}
+
+// Delete ลบผู้ใช้ที่ไม่มีหนังสือค้างคืน ประวัติการยืม/จองยังเก็บไว้ตาม UserID
+// (ถ้าต้องการเก็บบัญชีไว้ให้ใช้ SetDisabled แทน)
+func (s *UserService) Delete(userID string) error {
+	return s.Notifications.Transaction(s.DB, func(tx *gorm.DB) error {
+		u, err := s.load(tx, userID)
+		if err != nil {
+			return err
+		}
+		if err := ensureNotLastAdmin(tx, u); err != nil {
+			return err
+		}
+		var active int64
+		if err := tx.Model(&entity.Borrow{}).
+			Where("user_id = ? AND return_date IS NULL", userID).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrUserHasActiveBorrows
+		}
+		if err := s.cancelOpenReservations(tx, userID); err != nil {
+			return err
+		}
+
+		var profileIDs []uint
+		if err := tx.Model(&entity.Profile{}).Where("user_id = ?", userID).Pluck("id", &profileIDs).Error; err != nil {
+			return err
+		}
+		for _, m := range []any{&entity.RefreshToken{}, &entity.AuthSession{}, &entity.PasswordResetToken{}, &entity.Profile{}} {
+			if err := tx.Unscoped().Where("user_id = ?", userID).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		// รูปโปรไฟล์ของผู้ใช้ที่ถูกลบไม่มีใครอ้างถึงแล้ว
+		if len(profileIDs) > 0 {
+			if err := SyncUploadReferences(tx, UploadOwnerProfile, profileIDs...); err != nil {
+				return err
+			}
+		}
+		return tx.Where("user_id = ?", userID).Delete(&entity.User{}).Error
+	})
+}
+
+// ListRoles รายการ role ทั้งหมด
+func (s *UserService) ListRoles() ([]entity.Role, error) {
+	var items []entity.Role
+	if err := s.DB.Order("id").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}